@@ -0,0 +1,79 @@
+// SPDX-FileCopyrightText: 2023 SUSE LLC
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/spf13/cobra"
+	"github.com/uyuni-project/inter-server-sync/entityDumper"
+	"github.com/uyuni-project/inter-server-sync/iss"
+)
+
+var compareCmd = &cobra.Command{
+	Use:   "compare",
+	Short: "Compare channels content between two servers",
+	Run:   runCompare,
+}
+
+var targetConfig string
+var compareChannels []string
+var compareDigestOnly bool
+
+func init() {
+	compareCmd.Flags().StringVar(&targetConfig, "targetConfig", "", "Configuration file of the server to compare with")
+	compareCmd.Flags().StringSliceVar(&compareChannels, "channels", nil, "Channels to be compared")
+	compareCmd.Flags().BoolVar(&compareDigestOnly, "digestOnly", false, "Only print the content digest of each channel")
+	compareCmd.MarkFlagRequired("targetConfig")
+	compareCmd.MarkFlagRequired("channels")
+	compareCmd.Args = cobra.NoArgs
+
+	rootCmd.AddCommand(compareCmd)
+}
+
+func runCompare(cmd *cobra.Command, args []string) {
+	options := iss.CompareOptions{
+		ServerConfig:  serverConfig,
+		TargetConfig:  targetConfig,
+		ChannelLabels: compareChannels,
+	}
+	ctx, finish := operationContext(cmd, "compare")
+	comparisons, err := iss.Compare(ctx, options)
+	finish(err)
+	exitOnError(err, "Compare failed")
+	printChannelComparisons(cmd.OutOrStdout(), comparisons)
+}
+
+func printChannelComparisons(writer io.Writer, comparisons []entityDumper.ChannelComparison) {
+	for _, comparison := range comparisons {
+		status := "in sync"
+		if !comparison.InSync() {
+			status = "differs"
+		}
+		fmt.Fprintf(writer, "Channel %s: %s\n", comparison.ChannelLabel, status)
+		fmt.Fprintf(writer, "  source digest: %s\n", comparison.SourceDigest)
+		fmt.Fprintf(writer, "  target digest: %s\n", comparison.TargetDigest)
+		if compareDigestOnly {
+			continue
+		}
+		for _, tableDiff := range comparison.Tables {
+			fmt.Fprintf(writer, "  %s: %d only in source, %d differing, %d only in target\n", tableDiff.TableName,
+				len(tableDiff.Inserted), len(tableDiff.Updated), len(tableDiff.Deleted))
+			for _, key := range tableDiff.Inserted {
+				fmt.Fprintf(writer, "    + %s\n", key)
+			}
+			for _, rowChange := range tableDiff.Updated {
+				fmt.Fprintf(writer, "    ~ %s\n", rowChange.Key)
+				for _, change := range rowChange.Changes {
+					fmt.Fprintf(writer, "        %s: target %s, source %s\n", change.Column, change.Before, change.After)
+				}
+			}
+			for _, key := range tableDiff.Deleted {
+				fmt.Fprintf(writer, "    - %s\n", key)
+			}
+		}
+	}
+}
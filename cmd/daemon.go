@@ -0,0 +1,47 @@
+// SPDX-FileCopyrightText: 2023 SUSE LLC
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/uyuni-project/inter-server-sync/daemon"
+)
+
+var daemonCmd = &cobra.Command{
+	Use:   "daemon",
+	Short: "Run the export jobs on their schedule",
+	Run:   runDaemon,
+}
+
+var jobsDir string
+var historyFile string
+var retries int
+var retryDelay time.Duration
+
+func init() {
+	daemonCmd.Flags().StringVar(&jobsDir, "jobsDir", "/etc/iss/jobs", "Location of the YAML export job files")
+	daemonCmd.Flags().StringVar(&historyFile, "historyFile", "/var/lib/inter-server-sync/history.jsonl", "File recording the runs of the jobs")
+	daemonCmd.Flags().IntVar(&retries, "retries", 2, "Number of retries of a job failing with a transient error")
+	daemonCmd.Flags().DurationVar(&retryDelay, "retryDelay", 5*time.Minute, "Delay before retrying a failed job")
+	daemonCmd.Args = cobra.NoArgs
+
+	rootCmd.AddCommand(daemonCmd)
+}
+
+func runDaemon(cmd *cobra.Command, args []string) {
+	options := daemon.Options{
+		JobsDir:      jobsDir,
+		ServerConfig: serverConfig,
+		HistoryFile:  historyFile,
+		Retries:      retries,
+		RetryDelay:   retryDelay,
+	}
+	ctx, finish := operationContext(cmd, "daemon")
+	err := daemon.Run(ctx, options)
+	finish(err)
+	exitOnError(err, "Daemon failed")
+}
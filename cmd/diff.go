@@ -0,0 +1,70 @@
+// SPDX-FileCopyrightText: 2023 SUSE LLC
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/spf13/cobra"
+	"github.com/uyuni-project/inter-server-sync/entityDumper"
+	"github.com/uyuni-project/inter-server-sync/iss"
+)
+
+var diffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Show the changes an import would apply to the server channels",
+	Run:   runDiff,
+}
+
+var diffSummary bool
+
+func init() {
+	diffCmd.Flags().StringVar(&importDir, "importDir", ".", "Location import data from")
+	diffCmd.Flags().BoolVar(&diffSummary, "summary", false, "Only print the number of changed rows per table")
+	diffCmd.Args = cobra.NoArgs
+
+	rootCmd.AddCommand(diffCmd)
+}
+
+func runDiff(cmd *cobra.Command, args []string) {
+	options := iss.ImportOptions{
+		ServerConfig: serverConfig,
+		ImportDir:    importDir,
+	}
+	ctx, finish := operationContext(cmd, "diff")
+	channelDiffs, err := iss.Diff(ctx, options)
+	finish(err)
+	exitOnError(err, "Diff failed")
+	printChannelDiffs(cmd.OutOrStdout(), channelDiffs)
+}
+
+func printChannelDiffs(writer io.Writer, channelDiffs []entityDumper.ChannelDiff) {
+	for _, channelDiff := range channelDiffs {
+		fmt.Fprintf(writer, "Channel %s\n", channelDiff.ChannelLabel)
+		if len(channelDiff.Tables) == 0 {
+			fmt.Fprintf(writer, "  no changes\n")
+		}
+		for _, tableDiff := range channelDiff.Tables {
+			fmt.Fprintf(writer, "  %s: %d to insert, %d to update, %d to delete\n", tableDiff.TableName,
+				len(tableDiff.Inserted), len(tableDiff.Updated), len(tableDiff.Deleted))
+			if diffSummary {
+				continue
+			}
+			for _, key := range tableDiff.Inserted {
+				fmt.Fprintf(writer, "    + %s\n", key)
+			}
+			for _, rowChange := range tableDiff.Updated {
+				fmt.Fprintf(writer, "    ~ %s\n", rowChange.Key)
+				for _, change := range rowChange.Changes {
+					fmt.Fprintf(writer, "        %s: %s -> %s\n", change.Column, change.Before, change.After)
+				}
+			}
+			for _, key := range tableDiff.Deleted {
+				fmt.Fprintf(writer, "    - %s\n", key)
+			}
+		}
+	}
+}
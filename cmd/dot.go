@@ -5,6 +5,7 @@
 package cmd
 
 import (
+	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 	"github.com/uyuni-project/inter-server-sync/entityDumper"
 	"github.com/uyuni-project/inter-server-sync/schemareader"
@@ -16,9 +17,15 @@ var dotCmd = &cobra.Command{
 	Short: "export database schema as dot diagram",
 	Hidden: true,
 	Run: func(cmd *cobra.Command, args []string) {
-		db := schemareader.GetDBconnection(serverConfig)
+		db, err := schemareader.GetDBconnection(serverConfig)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Unable to connect to the database")
+		}
 		defer db.Close()
-		tables := schemareader.ReadTablesSchema(db, entityDumper.SoftwareChannelTableNames())
+		tables, err := schemareader.ReadTablesSchema(db, entityDumper.SoftwareChannelTableNames())
+		if err != nil {
+			log.Fatal().Err(err).Msg("Unable to read the database schema")
+		}
 		schemareader.DumpToGraphviz(tables)
 	},
 }
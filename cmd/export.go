@@ -5,13 +5,15 @@
 package cmd
 
 import (
-	"os"
-	"path"
+	"fmt"
+	"io"
+	"time"
 
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
+	"github.com/uyuni-project/inter-server-sync/dumper"
 	"github.com/uyuni-project/inter-server-sync/entityDumper"
-	"github.com/uyuni-project/inter-server-sync/utils"
+	"github.com/uyuni-project/inter-server-sync/iss"
 )
 
 var exportCmd = &cobra.Command{
@@ -25,62 +27,151 @@ var channelWithChildren []string
 var configChannels []string
 var outputDir string
 var metadataOnly bool
+var errataOnly bool
+var packageArchs []string
+var latestPackageVersions int
+var errataTypes []string
+var errataSeverities []string
+var errataIssuedAfter string
+var asOf string
+var slim bool
+var excludeTables []string
 var startingDate string
 var includeImages bool
 var includeContainers bool
 var orgs []uint
+var compression string
+var linkMode string
+var products []string
+var channelFamilies []string
+var clmEnvironments []string
+var allVendorChannels bool
+var vendorChannelsWithContent bool
+var allCustomChannels bool
+var resolveDependencies bool
+var jobFile string
+
+// exportSelectionFlags cannot be combined with a job file, which declares the same selection
+var exportSelectionFlags = []string{"channels", "channel-with-children", "outputDir", "metadataOnly", "errataOnly",
+	"packageArch", "latestPackageVersions", "errataTypes", "errataSeverity", "errataIssuedAfter", "asOf",
+	"slim", "excludeTables", "packagesOnlyAfter", "configChannels", "images", "containers", "orgLimit",
+	"compression", "linkMode", "product", "channelFamily", "clmEnvironment", "allVendorChannels",
+	"vendorChannelsWithContent", "allCustomChannels", "resolveDependencies"}
 
 func init() {
-	exportCmd.Flags().StringSliceVar(&channels, "channels", nil, "Channels to be exported")
+	exportCmd.Flags().StringSliceVar(&channels, "channels", nil, "Channels to be exported, as labels or glob patterns")
 	exportCmd.Flags().StringSliceVar(&channelWithChildren, "channel-with-children", nil, "Channels to be exported")
 	exportCmd.Flags().StringVar(&outputDir, "outputDir", ".", "Location for generated data")
 	exportCmd.Flags().BoolVar(&metadataOnly, "metadataOnly", false, "export only metadata")
+	exportCmd.Flags().BoolVar(&errataOnly, "errataOnly", false, "export only the errata of the channels, for packages already on the target server")
+	exportCmd.Flags().StringSliceVar(&packageArchs, "packageArch", nil, "Export only the packages of these architectures, e.g. x86_64,noarch")
+	exportCmd.Flags().IntVar(&latestPackageVersions, "latestPackageVersions", 0, "Export only the newest versions of each package of a channel, 0 for all")
+	exportCmd.Flags().StringSliceVar(&errataTypes, "errataTypes", nil, "Export only the errata of these advisory types, e.g. 'Security Advisory'")
+	exportCmd.Flags().StringSliceVar(&errataSeverities, "errataSeverity", nil, "Export only the errata of these severities: critical, important, moderate, low or unspecified")
+	exportCmd.Flags().StringVar(&errataIssuedAfter, "errataIssuedAfter", "", "Export only the errata issued after the specified date (date format can be 'YYYY-MM-DD' or 'YYYY-MM-DD hh:mm:ss')")
+	exportCmd.Flags().StringVar(&asOf, "asOf", "", "Export the channels with the packages and errata they had at the specified date (date format can be 'YYYY-MM-DD' or 'YYYY-MM-DD hh:mm:ss')")
+	exportCmd.Flags().BoolVar(&slim, "slim", false, "Leave the package changelogs and file lists out of the export")
+	exportCmd.Flags().StringSliceVar(&excludeTables, "excludeTables", nil, "Leave these package tables out of the export, e.g. rhnpackagechangelogrec,rhnpackagechangelogdata")
 	exportCmd.Flags().StringVar(&startingDate, "packagesOnlyAfter", "", "Only export packages added or modified after the specified date (date format can be 'YYYY-MM-DD' or 'YYYY-MM-DD hh:mm:ss')")
 	exportCmd.Flags().StringSliceVar(&configChannels, "configChannels", nil, "Configuration Channels to be exported")
 	exportCmd.Flags().BoolVar(&includeImages, "images", false, "Export OS images and associated metadata")
 	exportCmd.Flags().BoolVar(&includeContainers, "containers", false, "Export containers metadata")
-	exportCmd.Flags().UintSliceVar(&orgs, "orgLimit", nil, "Export only for specified organizations")
+	exportCmd.Flags().UintSliceVar(&orgs, "orgLimit", nil, "Export only vendor content and the content of the specified organizations")
+	exportCmd.Flags().BoolVar(&allVendorChannels, "allVendorChannels", false, "Export all the vendor channels, each base channel followed by its children")
+	exportCmd.Flags().BoolVar(&vendorChannelsWithContent, "vendorChannelsWithContent", false, "Limit --allVendorChannels to the channels with packages or errata")
+	exportCmd.Flags().BoolVar(&allCustomChannels, "allCustomChannels", false, "Export all the custom channels of the organizations of --orgLimit")
+	exportCmd.Flags().BoolVar(&resolveDependencies, "resolveDependencies", false, "Add the base channels and clone originals of the exported channels to the export")
+	exportCmd.Flags().StringSliceVar(&products, "product", nil, "Export the channels of the products, as name/version[/arch] e.g. SLES/15.5/x86_64")
+	exportCmd.Flags().StringSliceVar(&channelFamilies, "channelFamily", nil, "Export the channels of the channel families")
+	exportCmd.Flags().StringSliceVar(&clmEnvironments, "clmEnvironment", nil, "Export the channels of the content lifecycle management environments, as project:environment")
+	exportCmd.Flags().StringVar(&compression, "compression", "gzip", "Compression of the exported SQL statements: gzip or none")
+	exportCmd.Flags().StringVar(&linkMode, "linkMode", dumper.LinkModeCopy,
+		"How package and image files are put in the export: auto, hardlink, reflink or copy. Files are copied when they cannot be linked")
+	exportCmd.Flags().StringVar(&jobFile, "job", "", "Export as declared in the YAML job file")
 	exportCmd.Args = cobra.NoArgs
 
 	rootCmd.AddCommand(exportCmd)
 }
 
 func runExport(cmd *cobra.Command, args []string) {
-	log.Info().Msg("Export started")
-	// check output dir existence and create it if needed.
-
-	// Validate data
-	validatedDate, ok := utils.ValidateDate(startingDate)
-	if !ok {
-		log.Fatal().Msg("Unable to validate the date. Allowed formats are 'YYYY-MM-DD' or 'YYYY-MM-DD hh:mm:ss'")
+	if jobFile != "" {
+		runExportJob(cmd)
+		return
 	}
-
-	options := entityDumper.DumperOptions{
+	options := iss.Options{
 		ServerConfig:              serverConfig,
 		ChannelLabels:             channels,
 		ConfigLabels:              configChannels,
 		ChannelWithChildrenLabels: channelWithChildren,
 		OutputFolder:              outputDir,
 		MetadataOnly:              metadataOnly,
-		StartingDate:              validatedDate,
+		ErrataOnly:                errataOnly,
+		PackageArchs:              packageArchs,
+		LatestPackageVersions:     latestPackageVersions,
+		ErrataTypes:               errataTypes,
+		ErrataSeverities:          errataSeverities,
+		ErrataIssuedAfter:         errataIssuedAfter,
+		AsOf:                      asOf,
+		Slim:                      slim,
+		ExcludedTables:            excludeTables,
+		StartingDate:              startingDate,
 		OSImages:                  includeImages,
 		Containers:                includeContainers,
 		Orgs:                      orgs,
+		Compression:               compression,
+		LinkMode:                  linkMode,
+		Products:                  products,
+		ChannelFamilies:           channelFamilies,
+		ClmEnvironments:           clmEnvironments,
+		AllVendorChannels:         allVendorChannels,
+		VendorChannelsWithContent: vendorChannelsWithContent,
+		AllCustomChannels:         allCustomChannels,
+		ResolveDependencies:       resolveDependencies,
+	}
+	ctx, finish := operationContext(cmd, "export")
+	// invalid selectors are reported by the export validation
+	if expansions, err := iss.ExpandChannels(ctx, options); err == nil {
+		printChannelExpansions(cmd.OutOrStdout(), expansions)
 	}
-	entityDumper.DumpAllEntities(options)
-	var versionfile string
-	versionfile = path.Join(utils.GetAbsPath(outputDir), "version.txt")
-	vf, err := os.Open(versionfile)
-	defer vf.Close()
-	if os.IsNotExist(err) {
-		f, err := os.Create(versionfile)
-		if err != nil {
-			log.Panic().Msg("Unable to create version file")
+	report, err := iss.Export(ctx, options)
+	finish(err)
+	printDroppedRelations(cmd.OutOrStdout(), report.DroppedRelations)
+	exitOnError(err, "Export failed")
+}
+
+func runExportJob(cmd *cobra.Command) {
+	for _, flag := range exportSelectionFlags {
+		if cmd.Flags().Changed(flag) {
+			log.Fatal().Msgf("--%s cannot be used together with --job", flag)
 		}
-		vf = f
 	}
-	version, product := utils.GetCurrentServerVersion(serverConfig)
-	vf.WriteString("product_name = " + product + "\n" + "version = " + version + "\n")
+	job, err := iss.LoadJob(jobFile)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid export job")
+	}
+	ctx, finish := operationContext(cmd, "export")
+	report, err := iss.RunJob(ctx, job, serverConfig, time.Now())
+	finish(err)
+	printDroppedRelations(cmd.OutOrStdout(), report.DroppedRelations)
+	exitOnError(err, "Export failed")
+}
 
-	log.Info().Msgf("Export done. Directory: %s", outputDir)
+// printDroppedRelations prints the channel relations the export left out, whatever the log level
+func printDroppedRelations(writer io.Writer, droppedRelations []string) {
+	if len(droppedRelations) == 0 {
+		return
+	}
+	fmt.Fprintln(writer, "dropped channel relations:")
+	for _, relation := range droppedRelations {
+		fmt.Fprintf(writer, "  %s\n", relation)
+	}
+}
+
+func printChannelExpansions(writer io.Writer, expansions []entityDumper.ChannelExpansion) {
+	for _, expansion := range expansions {
+		fmt.Fprintf(writer, "%s:\n", expansion.Selector)
+		for _, label := range expansion.Channels {
+			fmt.Fprintf(writer, "  %s\n", label)
+		}
+	}
 }
@@ -0,0 +1,43 @@
+// SPDX-FileCopyrightText: 2023 SUSE LLC
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/uyuni-project/inter-server-sync/iss"
+)
+
+var rollbackCmd = &cobra.Command{
+	Use:   "rollback",
+	Short: "Restore the channels as they were before an import",
+	Run:   runRollback,
+}
+
+var rollbackBundle string
+
+func init() {
+	rollbackCmd.Flags().StringVar(&rollbackBundle, "bundle", "", "Rollback bundle written by the import, see the import report")
+	rollbackCmd.MarkFlagRequired("bundle")
+	rollbackCmd.Args = cobra.NoArgs
+
+	rootCmd.AddCommand(rollbackCmd)
+}
+
+func runRollback(cmd *cobra.Command, args []string) {
+	options := iss.RollbackOptions{
+		ServerConfig: serverConfig,
+		Bundle:       rollbackBundle,
+	}
+	ctx, finish := operationContext(cmd, "rollback")
+	statements, err := iss.Rollback(ctx, options)
+	finish(err)
+	exitOnError(err, "Rollback failed")
+	for _, statementReport := range statements {
+		fmt.Fprintf(cmd.OutOrStdout(), "%s %s: %d statements, %d rows\n", statementReport.Class, statementReport.Table,
+			statementReport.Statements, statementReport.RowsAffected)
+	}
+}
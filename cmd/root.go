@@ -5,17 +5,26 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log/syslog"
+	"net"
+	"net/http"
 	"os"
+	"os/signal"
 	"runtime/pprof"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
+
+	"github.com/uyuni-project/inter-server-sync/metrics"
+	"github.com/uyuni-project/inter-server-sync/progress"
 )
 
 var Version = "0.0.0"
@@ -26,8 +35,81 @@ var rootCmd = &cobra.Command{
 	Version: Version,
 }
 
+// exit code of a command interrupted by SIGINT or SIGTERM, following the shell convention 128 + SIGINT
+const interruptedExitCode = 130
+
 func Execute() {
-	cobra.CheckErr(rootCmd.Execute())
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		// restore the default behaviour, so a second signal terminates the process immediately
+		<-ctx.Done()
+		stop()
+	}()
+	cobra.CheckErr(rootCmd.ExecuteContext(ctx))
+}
+
+// exitOnError terminates the process if err is not nil, with a distinct exit code if the command was interrupted
+func exitOnError(err error, msg string) {
+	if err == nil {
+		return
+	}
+	if errors.Is(err, context.Canceled) {
+		log.Error().Err(err).Msgf("%s: interrupted", msg)
+		cpuProfileTearDown()
+		os.Exit(interruptedExitCode)
+	}
+	log.Fatal().Err(err).Msg(msg)
+}
+
+// operationContext returns the context to run operation in, carrying the progress reporter and the metrics collector
+// requested on the command line. The returned function must be called with the result of the operation.
+func operationContext(cmd *cobra.Command, operation string) (context.Context, func(err error)) {
+	ctx := cmd.Context()
+	switch progressFormat {
+	case "":
+	case "json":
+		if progressFd == 0 {
+			log.Fatal().Msgf("--progress %s cannot be written to stdin, --progressFd has to be 1 or more", progressFormat)
+		}
+		ctx = progress.WithReporter(ctx, progress.NewJSONReporter(os.NewFile(uintptr(progressFd), "progress")))
+	default:
+		log.Fatal().Msgf("unsupported progress format: %s", progressFormat)
+	}
+
+	if metricsFile == "" && metricsListen == "" {
+		return ctx, func(err error) {}
+	}
+	collector := metrics.NewCollector(operation)
+	ctx = metrics.WithCollector(ctx, collector)
+
+	var server *http.Server
+	if metricsListen != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", collector)
+		server = &http.Server{Addr: metricsListen, Handler: mux}
+		listener, err := net.Listen("tcp", metricsListen)
+		if err != nil {
+			log.Fatal().Err(err).Msgf("unable to listen for metrics on %s", metricsListen)
+		}
+		go func() {
+			if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Error().Err(err).Msg("metrics server failed")
+			}
+		}()
+	}
+
+	return ctx, func(err error) {
+		collector.Finish(err)
+		if metricsFile != "" {
+			if err := collector.WriteTextfile(metricsFile); err != nil {
+				log.Error().Err(err).Msg("unable to write metrics")
+			}
+		}
+		if server != nil {
+			server.Close()
+		}
+	}
 }
 
 // var cfgFile string
@@ -35,9 +117,18 @@ var logLevel string
 var serverConfig string
 var cpuProfile string
 var memProfile string
+var progressFormat string
+var progressFd uint
+var metricsFile string
+var metricsListen string
 
 func init() {
 	rootCmd.PersistentPreRun = func(cmd *cobra.Command, args []string) {
+		if progressFormat != "" && progressFd == 1 {
+			// the progress events keep stdout for themselves: the log output, the printed channels and the output
+			// of the commands run go to stderr
+			os.Stdout = os.Stderr
+		}
 		logInit()
 		cpuProfileInit()
 		memProfileDump()
@@ -49,6 +140,10 @@ func init() {
 	rootCmd.PersistentFlags().StringVar(&serverConfig, "serverConfig", "/etc/rhn/rhn.conf", "Server configuration file")
 	rootCmd.PersistentFlags().StringVar(&cpuProfile, "cpuProfile", "", "cpuProfile export folder location")
 	rootCmd.PersistentFlags().StringVar(&memProfile, "memProfile", "", "memProfile export folder location")
+	rootCmd.PersistentFlags().StringVar(&progressFormat, "progress", "", "emit progress events in the given format, supported: json")
+	rootCmd.PersistentFlags().UintVar(&progressFd, "progressFd", 1, "file descriptor progress events are written to, stdout by default, which sends the log output to stderr")
+	rootCmd.PersistentFlags().StringVar(&metricsFile, "metricsFile", "", "write Prometheus metrics of the run to this file, for the node_exporter textfile collector")
+	rootCmd.PersistentFlags().StringVar(&metricsListen, "metricsListen", "", "serve Prometheus metrics on this address while running, e.g. ':9911'")
 }
 
 func logCallerMarshalFunction(file string, line int) string {
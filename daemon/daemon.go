@@ -0,0 +1,226 @@
+// SPDX-FileCopyrightText: 2023 SUSE LLC
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package daemon runs the export jobs of a directory on their schedule, until the context is cancelled
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/uyuni-project/inter-server-sync/iss"
+)
+
+// Options describes where the jobs are and how they are run
+type Options struct {
+	JobsDir      string
+	ServerConfig string
+	// HistoryFile receives one JSON HistoryEntry per line for each run, if set
+	HistoryFile string
+	// Retries is the number of additional attempts of a run failing with a transient error
+	Retries    int
+	RetryDelay time.Duration
+}
+
+// HistoryEntry records an attempt to run a job
+type HistoryEntry struct {
+	Job       string    `json:"job"`
+	OutputDir string    `json:"output_dir"`
+	StartTime time.Time `json:"start_time"`
+	EndTime   time.Time `json:"end_time"`
+	Attempt   int       `json:"attempt"`
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+}
+
+const (
+	StatusSuccess = "success"
+	StatusFailed  = "failed"
+	// StatusSkipped is recorded when another job is still exporting to the same output directory
+	StatusSkipped = "skipped"
+)
+
+type scheduledJob struct {
+	job      iss.Job
+	schedule Schedule
+}
+
+type daemon struct {
+	options Options
+	jobs    []scheduledJob
+	// busyOutputs holds the absolute output directories being exported to, with {date} replaced
+	busyOutputs  map[string]bool
+	mutex        sync.Mutex
+	historyMutex sync.Mutex
+}
+
+// Run starts the jobs of options.JobsDir on their schedule until ctx is cancelled, then waits for the running jobs
+func Run(ctx context.Context, options Options) error {
+	jobs, err := loadJobs(options.JobsDir)
+	if err != nil {
+		return err
+	}
+	d := &daemon{options: options, jobs: jobs, busyOutputs: make(map[string]bool)}
+	log.Info().Msgf("Daemon started with %d jobs", len(jobs))
+
+	var running sync.WaitGroup
+	for {
+		next := time.Now().Truncate(time.Minute).Add(time.Minute)
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			log.Info().Msg("Daemon stopping, waiting for running jobs")
+			running.Wait()
+			return nil
+		case <-timer.C:
+		}
+		d.startDueJobs(ctx, next, &running)
+	}
+}
+
+// startDueJobs starts the jobs scheduled at now, each in its own goroutine: every export has its own state,
+// only exports to the same output directory are serialised
+func (d *daemon) startDueJobs(ctx context.Context, now time.Time, running *sync.WaitGroup) {
+	for _, scheduled := range d.jobs {
+		if !scheduled.schedule.Matches(now) {
+			continue
+		}
+		running.Add(1)
+		go func(job iss.Job) {
+			defer running.Done()
+			d.runJob(ctx, job)
+		}(scheduled.job)
+	}
+}
+
+// loadJobs reads all the YAML job files of jobsDir, failing if any of them is invalid
+func loadJobs(jobsDir string) ([]scheduledJob, error) {
+	entries, err := os.ReadDir(jobsDir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading jobs directory: %w", err)
+	}
+	jobs := make([]scheduledJob, 0)
+	names := make(map[string]string)
+	for _, entry := range entries {
+		extension := filepath.Ext(entry.Name())
+		if entry.IsDir() || (extension != ".yaml" && extension != ".yml") {
+			continue
+		}
+		jobPath := filepath.Join(jobsDir, entry.Name())
+		job, err := iss.LoadJob(jobPath)
+		if err != nil {
+			return nil, err
+		}
+		if job.Schedule == "" {
+			return nil, fmt.Errorf("job %s in %s has no schedule", job.Name, jobPath)
+		}
+		schedule, err := ParseSchedule(job.Schedule)
+		if err != nil {
+			return nil, fmt.Errorf("job %s: %w", job.Name, err)
+		}
+		if other, ok := names[job.Name]; ok {
+			return nil, fmt.Errorf("job %s is defined in both %s and %s", job.Name, other, jobPath)
+		}
+		names[job.Name] = jobPath
+		jobs = append(jobs, scheduledJob{job: job, schedule: schedule})
+	}
+	if len(jobs) == 0 {
+		return nil, fmt.Errorf("no job found in %s", jobsDir)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].job.Name < jobs[j].job.Name })
+	return jobs, nil
+}
+
+// runJob runs the job unless its output directory is busy, retrying on transient failures
+func (d *daemon) runJob(ctx context.Context, job iss.Job) {
+	for attempt := 1; ; attempt++ {
+		entry := HistoryEntry{Job: job.Name, OutputDir: job.OutputDir, StartTime: time.Now(), Attempt: attempt}
+		outputDir, err := job.OutputFolder(entry.StartTime)
+		if err == nil {
+			entry.OutputDir = outputDir
+			if !d.acquireOutput(outputDir) {
+				log.Warn().Msgf("Skipping job %s, an export to %s is still running", job.Name, outputDir)
+				entry.EndTime = time.Now()
+				entry.Status = StatusSkipped
+				d.recordHistory(entry)
+				return
+			}
+			_, err = iss.RunJob(ctx, job, d.options.ServerConfig, entry.StartTime)
+			d.releaseOutput(outputDir)
+		}
+		entry.EndTime = time.Now()
+		if err == nil {
+			entry.Status = StatusSuccess
+			d.recordHistory(entry)
+			log.Info().Msgf("Job %s done", job.Name)
+			return
+		}
+		entry.Status = StatusFailed
+		entry.Error = err.Error()
+		d.recordHistory(entry)
+		if !isTransient(err) || attempt > d.options.Retries {
+			log.Error().Err(err).Msgf("Job %s failed", job.Name)
+			return
+		}
+		log.Warn().Err(err).Msgf("Job %s failed, retrying in %s", job.Name, d.options.RetryDelay)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(d.options.RetryDelay):
+		}
+	}
+}
+
+// isTransient returns false for the failures that a retry cannot fix
+func isTransient(err error) bool {
+	return !errors.Is(err, iss.ErrInvalidOptions) && !errors.Is(err, iss.ErrOutputNotEmpty) && !errors.Is(err, context.Canceled)
+}
+
+func (d *daemon) acquireOutput(outputDir string) bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.busyOutputs[outputDir] {
+		return false
+	}
+	d.busyOutputs[outputDir] = true
+	return true
+}
+
+func (d *daemon) releaseOutput(outputDir string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	delete(d.busyOutputs, outputDir)
+}
+
+func (d *daemon) recordHistory(entry HistoryEntry) {
+	if d.options.HistoryFile == "" {
+		return
+	}
+	d.historyMutex.Lock()
+	defer d.historyMutex.Unlock()
+	content, err := json.Marshal(entry)
+	if err != nil {
+		log.Error().Err(err).Msg("unable to encode the run history")
+		return
+	}
+	file, err := os.OpenFile(d.options.HistoryFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		log.Error().Err(err).Msg("unable to open the run history")
+		return
+	}
+	defer file.Close()
+	if _, err := file.Write(append(content, '\n')); err != nil {
+		log.Error().Err(err).Msg("unable to write the run history")
+	}
+}
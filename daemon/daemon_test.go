@@ -0,0 +1,159 @@
+// SPDX-FileCopyrightText: 2023 SUSE LLC
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/uyuni-project/inter-server-sync/iss"
+)
+
+func readHistory(t *testing.T, historyFile string) []HistoryEntry {
+	content, err := os.ReadFile(historyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := make([]HistoryEntry, 0)
+	for _, line := range strings.Split(strings.TrimSpace(string(content)), "\n") {
+		var entry HistoryEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestRunJobInvalidOptionsNotRetried(t *testing.T) {
+	historyFile := path.Join(t.TempDir(), "history.jsonl")
+	d := &daemon{options: Options{HistoryFile: historyFile, Retries: 3, RetryDelay: time.Hour},
+		busyOutputs: make(map[string]bool)}
+	job := iss.Job{Name: "job", Channels: []string{"base"}, OutputDir: t.TempDir(), PackagesOnlyAfter: "yesterday"}
+
+	d.runJob(context.Background(), job)
+
+	entries := readHistory(t, historyFile)
+	if len(entries) != 1 || entries[0].Status != StatusFailed || entries[0].Attempt != 1 {
+		t.Errorf("expected a single failed attempt, got %+v", entries)
+	}
+	if len(d.busyOutputs) != 0 {
+		t.Errorf("output not released")
+	}
+}
+
+func TestRunJobSkippedWhenOutputBusy(t *testing.T) {
+	historyFile := path.Join(t.TempDir(), "history.jsonl")
+	d := &daemon{options: Options{HistoryFile: historyFile}, busyOutputs: make(map[string]bool)}
+	// the same directory, written differently
+	job := iss.Job{Name: "job", Channels: []string{"base"}, OutputDir: "/var/iss/./export/"}
+	d.acquireOutput("/var/iss/export")
+
+	d.runJob(context.Background(), job)
+
+	entries := readHistory(t, historyFile)
+	if len(entries) != 1 || entries[0].Status != StatusSkipped || entries[0].OutputDir != "/var/iss/export" {
+		t.Errorf("expected a skipped run, got %+v", entries)
+	}
+}
+
+func TestRunJobOutputNotEmptyNotRetried(t *testing.T) {
+	historyFile := path.Join(t.TempDir(), "history.jsonl")
+	d := &daemon{options: Options{HistoryFile: historyFile, Retries: 3, RetryDelay: time.Hour},
+		busyOutputs: make(map[string]bool)}
+	outputDir := t.TempDir()
+	if err := os.WriteFile(path.Join(outputDir, "export-complete"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	job := iss.Job{Name: "job", Channels: []string{"base"}, OutputDir: outputDir}
+
+	d.runJob(context.Background(), job)
+
+	entries := readHistory(t, historyFile)
+	if len(entries) != 1 || entries[0].Status != StatusFailed || entries[0].Attempt != 1 {
+		t.Errorf("expected a single failed attempt, got %+v", entries)
+	}
+}
+
+func TestStartDueJobsConcurrently(t *testing.T) {
+	historyFile := path.Join(t.TempDir(), "history.jsonl")
+	schedule, err := ParseSchedule("* * * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &daemon{options: Options{HistoryFile: historyFile}, busyOutputs: make(map[string]bool)}
+	for _, name := range []string{"east", "west"} {
+		job := iss.Job{Name: name, Channels: []string{"base"}, OutputDir: path.Join(t.TempDir(), "{date}"),
+			ServerConfig: path.Join(t.TempDir(), "missing.conf")}
+		d.jobs = append(d.jobs, scheduledJob{job: job, schedule: schedule})
+	}
+
+	var running sync.WaitGroup
+	d.startDueJobs(context.Background(), time.Now(), &running)
+	running.Wait()
+
+	entries := readHistory(t, historyFile)
+	jobs := make(map[string]string)
+	for _, entry := range entries {
+		jobs[entry.Job] = entry.Status
+	}
+	if len(entries) != 2 || jobs["east"] != StatusFailed || jobs["west"] != StatusFailed {
+		t.Errorf("expected one failed attempt of each job, got %+v", entries)
+	}
+	if len(d.busyOutputs) != 0 {
+		t.Errorf("outputs not released")
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	for err, expected := range map[error]bool{
+		fmt.Errorf("job: %w", iss.ErrInvalidOptions):       false,
+		fmt.Errorf("job: %w: /tmp", iss.ErrOutputNotEmpty): false,
+		fmt.Errorf("job: %w", context.Canceled):            false,
+		fmt.Errorf("job: connection refused"):              true,
+	} {
+		if isTransient(err) != expected {
+			t.Errorf("isTransient(%v) should be %t", err, expected)
+		}
+	}
+}
+
+func TestLoadJobsRequiresSchedule(t *testing.T) {
+	jobsDir := t.TempDir()
+	err := os.WriteFile(path.Join(jobsDir, "job.yaml"), []byte("channels: [base]\noutputDir: /tmp/export\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadJobs(jobsDir); err == nil {
+		t.Fatal("expected an error for a job without schedule")
+	}
+
+	err = os.WriteFile(path.Join(jobsDir, "job.yaml"), []byte("channels: [base]\noutputDir: /tmp/export\nschedule: '@daily'\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadJobs(jobsDir); err == nil {
+		t.Fatal("expected an error for a scheduled job always exporting to the same directory")
+	}
+
+	err = os.WriteFile(path.Join(jobsDir, "job.yaml"), []byte("channels: [base]\noutputDir: /tmp/export/{date}\nschedule: '@daily'\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobs, err := loadJobs(jobsDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 || jobs[0].job.Name != "job" {
+		t.Errorf("unexpected jobs %+v", jobs)
+	}
+}
@@ -0,0 +1,121 @@
+// SPDX-FileCopyrightText: 2023 SUSE LLC
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package daemon
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a cron-like schedule, with a minute precision
+type Schedule struct {
+	minutes     [60]bool
+	hours       [24]bool
+	daysOfMonth [32]bool
+	months      [13]bool
+	daysOfWeek  [7]bool
+	// as in cron, when both days of month and days of week are restricted, a match of either is enough
+	anyDayOfMonth bool
+	anyDayOfWeek  bool
+}
+
+var scheduleShortcuts = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+}
+
+// ParseSchedule parses a cron expression with the five fields minute, hour, day of month, month and day of week,
+// each a list of values, ranges and steps like "*/15" or "1-5,10", or one of @hourly, @daily, @weekly and @monthly
+func ParseSchedule(expression string) (Schedule, error) {
+	var schedule Schedule
+	if shortcut, ok := scheduleShortcuts[strings.TrimSpace(expression)]; ok {
+		expression = shortcut
+	}
+	fields := strings.Fields(expression)
+	if len(fields) != 5 {
+		return schedule, fmt.Errorf("invalid schedule %q: expected 5 fields, found %d", expression, len(fields))
+	}
+	// day of week 7 is Sunday as well
+	var daysOfWeek [8]bool
+	err := firstError(
+		parseScheduleField(fields[0], 0, 59, schedule.minutes[:]),
+		parseScheduleField(fields[1], 0, 23, schedule.hours[:]),
+		parseScheduleField(fields[2], 1, 31, schedule.daysOfMonth[:]),
+		parseScheduleField(fields[3], 1, 12, schedule.months[:]),
+		parseScheduleField(fields[4], 0, 7, daysOfWeek[:]),
+	)
+	if err != nil {
+		return schedule, fmt.Errorf("invalid schedule %q: %w", expression, err)
+	}
+	copy(schedule.daysOfWeek[:], daysOfWeek[:7])
+	schedule.daysOfWeek[0] = daysOfWeek[0] || daysOfWeek[7]
+	schedule.anyDayOfMonth = fields[2] == "*"
+	schedule.anyDayOfWeek = fields[4] == "*"
+	return schedule, nil
+}
+
+// Matches returns true if the schedule runs at the minute of t
+func (schedule Schedule) Matches(t time.Time) bool {
+	if !schedule.minutes[t.Minute()] || !schedule.hours[t.Hour()] || !schedule.months[t.Month()] {
+		return false
+	}
+	dayOfMonth := schedule.daysOfMonth[t.Day()]
+	dayOfWeek := schedule.daysOfWeek[t.Weekday()]
+	if schedule.anyDayOfMonth || schedule.anyDayOfWeek {
+		return dayOfMonth && dayOfWeek
+	}
+	return dayOfMonth || dayOfWeek
+}
+
+func parseScheduleField(field string, low int, high int, values []bool) error {
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			rangePart = part[:i]
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step <= 0 {
+				return fmt.Errorf("invalid step in %q", part)
+			}
+		}
+		start, end := low, high
+		if rangePart != "*" {
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err error
+			if start, err = strconv.Atoi(bounds[0]); err != nil {
+				return fmt.Errorf("invalid value in %q", part)
+			}
+			end = start
+			if len(bounds) == 2 {
+				if end, err = strconv.Atoi(bounds[1]); err != nil {
+					return fmt.Errorf("invalid value in %q", part)
+				}
+			} else if step > 1 {
+				// "5/15" means from 5 to the maximum every 15
+				end = high
+			}
+		}
+		if start < low || end > high || start > end {
+			return fmt.Errorf("%q out of range %d-%d", part, low, high)
+		}
+		for value := start; value <= end; value += step {
+			values[value] = true
+		}
+	}
+	return nil
+}
+
+func firstError(errs ...error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
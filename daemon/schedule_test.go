@@ -0,0 +1,50 @@
+// SPDX-FileCopyrightText: 2023 SUSE LLC
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package daemon
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleMatches(t *testing.T) {
+	// 2023-05-01 is a Monday
+	monday := time.Date(2023, 5, 1, 2, 30, 0, 0, time.Local)
+	cases := []struct {
+		expression string
+		time       time.Time
+		matches    bool
+	}{
+		{"30 2 * * *", monday, true},
+		{"30 2 * * *", monday.Add(time.Minute), false},
+		{"*/15 * * * *", monday, true},
+		{"*/15 * * * *", monday.Add(5 * time.Minute), false},
+		{"0-40/10 1-3 * * 1-5", monday, true},
+		{"30 2 * * 0,6", monday, false},
+		{"30 2 * * 7", monday.AddDate(0, 0, 6), true},
+		{"30 2 15 * 1", monday, true},
+		{"30 2 15 * 2", monday, false},
+		{"30 2 1 6 *", monday, false},
+		{"@daily", time.Date(2023, 5, 1, 0, 0, 0, 0, time.Local), true},
+		{"@hourly", monday, false},
+	}
+	for _, c := range cases {
+		schedule, err := ParseSchedule(c.expression)
+		if err != nil {
+			t.Fatalf("%s: %v", c.expression, err)
+		}
+		if schedule.Matches(c.time) != c.matches {
+			t.Errorf("%s at %s: expected %v", c.expression, c.time, c.matches)
+		}
+	}
+}
+
+func TestParseInvalidSchedule(t *testing.T) {
+	for _, expression := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+		if _, err := ParseSchedule(expression); err == nil {
+			t.Errorf("%q: expected an error", expression)
+		}
+	}
+}
@@ -5,6 +5,7 @@
 package dumper
 
 import (
+	"context"
 	"reflect"
 	"testing"
 
@@ -52,7 +53,8 @@ func TestShouldCreateDataDumper(t *testing.T) {
 	testCase.repo.Expect("SELECT id FROM v36 WHERE id = $1;", testCase.schemaMetadata["v36"].Columns, 1)
 
 	// Act
-	dataDumper := DataCrawler(
+	dataDumper, err := DataCrawler(
+		context.Background(),
 		testCase.repo.DB,
 		testCase.schemaMetadata,
 		testCase.startTable,
@@ -61,6 +63,9 @@ func TestShouldCreateDataDumper(t *testing.T) {
 	)
 
 	// Assert
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
 	if dataDumper.TableData == nil || dataDumper.Paths == nil {
 		t.Errorf("DataDumper was not initiated")
 	}
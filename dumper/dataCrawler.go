@@ -5,26 +5,35 @@
 package dumper
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/rs/zerolog/log"
 
+	"github.com/uyuni-project/inter-server-sync/progress"
 	"github.com/uyuni-project/inter-server-sync/schemareader"
 	"github.com/uyuni-project/inter-server-sync/sqlUtil"
 )
 
+// number of rows found between two progress events
+const crawlProgressInterval = 1000
+
 // DataCrawler will go through all the elements in the initialDataSet an extract related data
 // for all tables presented in the schemaMetadata by following foreign keys and references to the table row
 // The result will be a structure containing ID of each row which should be exported per table
-func DataCrawler(db *sql.DB, schemaMetadata map[string]schemareader.Table, startTable schemareader.Table,
-	startQueryFilter string, startingDate string) DataDumper {
+func DataCrawler(ctx context.Context, db *sql.DB, schemaMetadata map[string]schemareader.Table, startTable schemareader.Table,
+	startQueryFilter string, startingDate string) (DataDumper, error) {
 
 	result := DataDumper{make(map[string]TableDump, 0), make(map[string]bool)}
 
-	itemsToProcess := initialDataSet(db, startTable, startQueryFilter)
+	itemsToProcess, err := initialDataSet(ctx, db, startTable, startQueryFilter)
+	if err != nil {
+		return result, err
+	}
 
 	if log.Debug().Enabled() {
 		go func() {
@@ -51,6 +60,11 @@ func DataCrawler(db *sql.DB, schemaMetadata map[string]schemareader.Table, start
 		}()
 	}
 
+	crawledRows := 0
+	defer func() {
+		progress.Report(ctx, progress.Event{Event: progress.RowsCrawled, Table: startTable.Name, Rows: crawledRows})
+	}()
+
 IterateItemsLoop:
 	for len(itemsToProcess) > 0 {
 
@@ -79,31 +93,53 @@ IterateItemsLoop:
 		resultTableValues.Keys = append(resultTableValues.Keys, keyColumnData)
 
 		result.TableData[table.Name] = resultTableValues
+		crawledRows++
+		if crawledRows%crawlProgressInterval == 0 {
+			progress.Report(ctx, progress.Event{Event: progress.RowsCrawled, Table: startTable.Name, Rows: crawledRows})
+		}
 		_, okPath := result.Paths[strings.Join(itemToProcess.path, ",")]
 		if !okPath {
 			result.Paths[strings.Join(itemToProcess.path, ",")] = true
 		}
 
-		newItems := append(followReferencesTo(db, schemaMetadata, table, itemToProcess, startingDate),
-			followReferencesFrom(db, schemaMetadata, table, itemToProcess, startingDate)...)
-		itemsToProcess = append(itemsToProcess, newItems...)
+		itemsTo, err := followReferencesTo(ctx, db, schemaMetadata, table, itemToProcess, startingDate)
+		if err != nil {
+			return result, err
+		}
+		itemsFrom, err := followReferencesFrom(ctx, db, schemaMetadata, table, itemToProcess, startingDate)
+		if err != nil {
+			return result, err
+		}
+		itemsToProcess = append(append(itemsToProcess, itemsTo...), itemsFrom...)
 
 	}
-	return result
+	crawledTables := make([]string, 0, len(result.TableData))
+	for tableName := range result.TableData {
+		crawledTables = append(crawledTables, tableName)
+	}
+	sort.Strings(crawledTables)
+	for _, tableName := range crawledTables {
+		progress.Report(ctx, progress.Event{Event: progress.TableCrawled, Table: tableName,
+			Rows: len(result.TableData[tableName].Keys)})
+	}
+	return result, nil
 }
 
-func initialDataSet(db *sql.DB, startTable schemareader.Table, whereFilter string) []processItem {
+func initialDataSet(ctx context.Context, db *sql.DB, startTable schemareader.Table, whereFilter string) ([]processItem, error) {
 	whereClause := ""
 	if len(whereFilter) > 0 {
 		whereClause = fmt.Sprintf("WHERE %s", whereFilter)
 	}
 	sql := fmt.Sprintf(`SELECT * FROM %s %s ;`, startTable.Name, whereClause)
-	rows := sqlUtil.ExecuteQueryWithResults(db, sql)
+	rows, err := sqlUtil.ExecuteQueryWithResults(ctx, db, sql)
+	if err != nil {
+		return nil, err
+	}
 	initialDataSet := make([]processItem, 0)
 	for _, row := range rows {
 		initialDataSet = append(initialDataSet, processItem{startTable.Name, row, []string{startTable.Name}})
 	}
-	return initialDataSet
+	return initialDataSet, nil
 }
 
 func generateKeyIdToMap(data TableKey) string {
@@ -135,7 +171,18 @@ func shouldApplyStartingDate(startingDate string, tableName string) bool {
 			tableName == "susemddata" || tableName == "rhnerratafilechannel")
 }
 
-func followReferencesFrom(db *sql.DB, schemaMetadata map[string]schemareader.Table, table schemareader.Table, row processItem, startingDate string) []processItem {
+// crawlConditions returns the filters of the rows of table to crawl
+func crawlConditions(table schemareader.Table) []string {
+	conditions := make([]string, 0)
+	for _, condition := range []string{table.RowFilter, table.CrawlFilter} {
+		if condition != "" {
+			conditions = append(conditions, condition)
+		}
+	}
+	return conditions
+}
+
+func followReferencesFrom(ctx context.Context, db *sql.DB, schemaMetadata map[string]schemareader.Table, table schemareader.Table, row processItem, startingDate string) ([]processItem, error) {
 	result := make([]processItem, 0)
 
 	for _, reference := range table.References {
@@ -165,11 +212,15 @@ func followReferencesFrom(db *sql.DB, schemaMetadata map[string]schemareader.Tab
 			whereParameters = append(whereParameters, fmt.Sprintf("%s >= '$%d'::timestamp", "modified", len(whereParameters)+1))
 			scanParameters = append(scanParameters, startingDate)
 		}
+		whereParameters = append(whereParameters, crawlConditions(foreignTable)...)
 
 		formattedColumns := strings.Join(foreignTable.Columns, ", ")
 		formattedWhereParameters := strings.Join(whereParameters, " and ")
 		sql := fmt.Sprintf(`SELECT %s FROM %s WHERE %s;`, formattedColumns, reference.TableName, formattedWhereParameters)
-		followRows := sqlUtil.ExecuteQueryWithResults(db, sql, scanParameters...)
+		followRows, err := sqlUtil.ExecuteQueryWithResults(ctx, db, sql, scanParameters...)
+		if err != nil {
+			return nil, err
+		}
 
 		if len(followRows) > 0 {
 			for _, followRow := range followRows {
@@ -180,7 +231,7 @@ func followReferencesFrom(db *sql.DB, schemaMetadata map[string]schemareader.Tab
 			}
 		}
 	}
-	return result
+	return result, nil
 }
 
 func shouldFollowToLinkPreOrder(path []string, currentTable schemareader.Table, referencedTable schemareader.Table) bool {
@@ -246,7 +297,7 @@ func shouldFollowReferenceToLink(path []string, currentTable schemareader.Table,
 	return false
 }
 
-func followReferencesTo(db *sql.DB, schemaMetadata map[string]schemareader.Table, table schemareader.Table, row processItem, startingDate string) []processItem {
+func followReferencesTo(ctx context.Context, db *sql.DB, schemaMetadata map[string]schemareader.Table, table schemareader.Table, row processItem, startingDate string) ([]processItem, error) {
 	result := make([]processItem, 0)
 
 	for _, reference := range table.ReferencedBy {
@@ -269,11 +320,15 @@ func followReferencesTo(db *sql.DB, schemaMetadata map[string]schemareader.Table
 			whereParameters = append(whereParameters, fmt.Sprintf("%s >= $%d::timestamp", "modified", len(whereParameters)+1))
 			scanParameters = append(scanParameters, startingDate)
 		}
+		whereParameters = append(whereParameters, crawlConditions(referencedTable)...)
 
 		formattedColumns := strings.Join(referencedTable.Columns, ", ")
 		formattedWhereParameters := strings.Join(whereParameters, " and ")
 		sql := fmt.Sprintf(`SELECT %s FROM %s WHERE %s;`, formattedColumns, reference.TableName, formattedWhereParameters)
-		followRows := sqlUtil.ExecuteQueryWithResults(db, sql, scanParameters...)
+		followRows, err := sqlUtil.ExecuteQueryWithResults(ctx, db, sql, scanParameters...)
+		if err != nil {
+			return nil, err
+		}
 
 		if len(followRows) > 0 {
 			for _, followRow := range followRows {
@@ -284,5 +339,5 @@ func followReferencesTo(db *sql.DB, schemaMetadata map[string]schemareader.Table
 			}
 		}
 	}
-	return result
+	return result, nil
 }
@@ -6,14 +6,16 @@ package dumper
 
 import (
 	"bufio"
+	"context"
 	"database/sql"
 	"encoding/hex"
-	"encoding/json"
 	"fmt"
 	"strings"
 	"time"
 
 	"github.com/rs/zerolog/log"
+	"github.com/uyuni-project/inter-server-sync/metrics"
+	"github.com/uyuni-project/inter-server-sync/progress"
 	"github.com/uyuni-project/inter-server-sync/sqlUtil"
 
 	"github.com/lib/pq"
@@ -21,34 +23,34 @@ import (
 	"github.com/uyuni-project/inter-server-sync/utils"
 )
 
-var cache = make(map[string]string)
+func PrintTableDataOrdered(ctx context.Context, db *sql.DB, writer *bufio.Writer, schemaMetadata map[string]schemareader.Table,
+	startingTable schemareader.Table, data DataDumper, options PrintSqlOptions) error {
 
-var referrencesCall = make(map[string]int)
+	// each channel is exported with an empty cache
+	ctx = WithReferenceCache(ctx)
 
-func PrintTableDataOrdered(db *sql.DB, writer *bufio.Writer, schemaMetadata map[string]schemareader.Table,
-	startingTable schemareader.Table, data DataDumper, options PrintSqlOptions) {
-
-	printCleanTables(db, writer, schemaMetadata, startingTable, make(map[string]bool), make([]string, 0), options)
+	err := printCleanTables(ctx, db, writer, schemaMetadata, startingTable, make(map[string]bool), make([]string, 0), options)
+	if err != nil {
+		return err
+	}
 	writer.WriteString("-- end of clean tables")
 	writer.WriteString("\n")
 	orderedTables := getTablesExportOrder(schemaMetadata, startingTable, make(map[string]bool), make([]string, 0))
-	exportTablesData(db, writer, schemaMetadata, orderedTables, data, options)
-	// clean cache for the next channel that can be exported
-	cache = make(map[string]string)
+	return exportTablesData(ctx, db, writer, schemaMetadata, orderedTables, data, options)
 }
 
 /*
 *
 clear tables need to be printed in reverse order, otherwise it will not work
 */
-func printCleanTables(db *sql.DB, writer *bufio.Writer, schemaMetadata map[string]schemareader.Table, table schemareader.Table,
-	processedTables map[string]bool, path []string, options PrintSqlOptions) {
+func printCleanTables(ctx context.Context, db *sql.DB, writer *bufio.Writer, schemaMetadata map[string]schemareader.Table, table schemareader.Table,
+	processedTables map[string]bool, path []string, options PrintSqlOptions) error {
 
 	_, tableProcessed := processedTables[table.Name]
 	// if the current table should not be export we are interrupting the crawler process for these table
 	// not exporting other tables relations
 	if tableProcessed || !table.Export {
-		return
+		return nil
 	}
 	processedTables[table.Name] = true
 	path = append(path, table.Name)
@@ -63,11 +65,15 @@ func printCleanTables(db *sql.DB, writer *bufio.Writer, schemaMetadata map[strin
 		if !shouldFollowReferenceToLink(path, table, tableReference) {
 			continue
 		}
-		printCleanTables(db, writer, schemaMetadata, tableReference, processedTables, path, options)
+		if err := printCleanTables(ctx, db, writer, schemaMetadata, tableReference, processedTables, path, options); err != nil {
+			return err
+		}
 	}
 
 	if utils.Contains(options.TablesToClean, table.Name) {
-		generateClearTable(db, writer, table, path, schemaMetadata, options)
+		if err := generateClearTable(ctx, db, writer, table, path, schemaMetadata, options); err != nil {
+			return err
+		}
 	}
 
 	for _, reference := range table.References {
@@ -75,22 +81,25 @@ func printCleanTables(db *sql.DB, writer *bufio.Writer, schemaMetadata map[strin
 		if !ok || !tableReference.Export {
 			continue
 		}
-		printCleanTables(db, writer, schemaMetadata, tableReference, processedTables, path, options)
+		if err := printCleanTables(ctx, db, writer, schemaMetadata, tableReference, processedTables, path, options); err != nil {
+			return err
+		}
 	}
+	return nil
 }
 
-func exportTablesData(db *sql.DB, writer *bufio.Writer, schemaMetadata map[string]schemareader.Table,
-	tablesOrdered []schemareader.Table, data DataDumper, options PrintSqlOptions) {
+func exportTablesData(ctx context.Context, db *sql.DB, writer *bufio.Writer, schemaMetadata map[string]schemareader.Table,
+	tablesOrdered []schemareader.Table, data DataDumper, options PrintSqlOptions) error {
 
+	cache := referenceCacheFrom(ctx)
 	processing := true
+	defer func() { processing = false }()
 	totalExportedRecords := 0
+	totalRecords := 0
+	for _, value := range data.TableData {
+		totalRecords = totalRecords + len(value.Keys)
+	}
 	if log.Debug().Enabled() {
-		totalRecords := 0
-
-		for _, value := range data.TableData {
-			totalRecords = totalRecords + len(value.Keys)
-		}
-
 		go func() {
 			count := 0
 			for {
@@ -99,7 +108,7 @@ func exportTablesData(db *sql.DB, writer *bufio.Writer, schemaMetadata map[strin
 					break
 				}
 				log.Debug().Msgf("#count: %d #cacheSize %d -- #writtenRows: #%d of %d",
-					count, len(cache), totalExportedRecords, totalRecords)
+					count, cache.size(), totalExportedRecords, totalRecords)
 				count++
 			}
 		}()
@@ -109,29 +118,38 @@ func exportTablesData(db *sql.DB, writer *bufio.Writer, schemaMetadata map[strin
 	for _, table := range tablesOrdered {
 		// export current table data
 		log.Debug().Msg(fmt.Sprintf("Writing data for table [%d/%d] %s", tableCount, len(tablesOrdered), table.Name))
+		progress.Report(ctx, progress.Event{Event: progress.TableStarted, Table: table.Name,
+			Current: tableCount, Total: len(tablesOrdered)})
 		tableCount++
-		totalExportedRecords += exportCurrentTableData(db, writer, schemaMetadata, table, data, options)
+		exportedRecords, err := exportCurrentTableData(ctx, db, writer, schemaMetadata, table, data, options)
+		if err != nil {
+			return err
+		}
+		totalExportedRecords += exportedRecords
+		metrics.AddTableRows(ctx, table.Name, exportedRecords)
+		progress.Report(ctx, progress.Event{Event: progress.RowsWritten, Table: table.Name,
+			Rows: exportedRecords, Current: totalExportedRecords, Total: totalRecords})
 	}
 	// post-processing callback
 	for _, table := range tablesOrdered {
 		if options.PostOrderCallback != nil {
-			options.PostOrderCallback(db, writer, schemaMetadata, table, data)
+			if err := options.PostOrderCallback(ctx, db, writer, schemaMetadata, table, data); err != nil {
+				return err
+			}
 		}
 	}
 
-	processing = false
-
 	if log.Debug().Enabled() {
-		valMarshal, errMarshal := json.Marshal(referrencesCall)
+		valMarshal, errMarshal := cache.marshalCalls()
 		if errMarshal == nil {
 			log.Debug().Msg(fmt.Sprintf("Referrence count resolver by table: %s", string(valMarshal)))
 		}
 	}
-
+	return nil
 }
 
-func exportCurrentTableData(db *sql.DB, writer *bufio.Writer, schemaMetadata map[string]schemareader.Table,
-	table schemareader.Table, data DataDumper, options PrintSqlOptions) int {
+func exportCurrentTableData(ctx context.Context, db *sql.DB, writer *bufio.Writer, schemaMetadata map[string]schemareader.Table,
+	table schemareader.Table, data DataDumper, options PrintSqlOptions) (int, error) {
 
 	totalExportedRecords := 0
 	tableData, dataOK := data.TableData[table.Name]
@@ -143,16 +161,22 @@ func exportCurrentTableData(db *sql.DB, writer *bufio.Writer, schemaMetadata map
 			if upperLimit > len(tableData.Keys) {
 				upperLimit = len(tableData.Keys)
 			}
-			rows := GetRowsFromKeys(db, table, tableData.Keys[exportPoint:upperLimit])
+			rows, err := GetRowsFromKeys(ctx, db, table, tableData.Keys[exportPoint:upperLimit])
+			if err != nil {
+				return totalExportedRecords, err
+			}
 			totalExportedRecords = totalExportedRecords + len(rows)
 			for _, rowValue := range rows {
-				rowToInsert := generateRowInsertStatement(db, rowValue, table, schemaMetadata, options.OnlyIfParentExistsTables)
+				rowToInsert, err := generateRowInsertStatement(ctx, db, rowValue, table, schemaMetadata, options.OnlyIfParentExistsTables)
+				if err != nil {
+					return totalExportedRecords, err
+				}
 				writer.WriteString(rowToInsert + "\n")
 			}
 			exportPoint = upperLimit
 		}
 	}
-	return totalExportedRecords
+	return totalExportedRecords, nil
 }
 
 func getTablesExportOrder(schemaMetadata map[string]schemareader.Table,
@@ -189,9 +213,9 @@ func getTablesExportOrder(schemaMetadata map[string]schemareader.Table,
 }
 
 // GetRowsFromKeys check if we should move this to a method in the type tableData
-func GetRowsFromKeys(db *sql.DB, table schemareader.Table, keys []TableKey) [][]sqlUtil.RowDataStructure {
+func GetRowsFromKeys(ctx context.Context, db *sql.DB, table schemareader.Table, keys []TableKey) ([][]sqlUtil.RowDataStructure, error) {
 	if len(keys) == 0 {
-		return make([][]sqlUtil.RowDataStructure, 0)
+		return make([][]sqlUtil.RowDataStructure, 0), nil
 	}
 	formattedColumns := strings.Join(table.Columns, ", ")
 
@@ -221,7 +245,7 @@ func GetRowsFromKeys(db *sql.DB, table schemareader.Table, keys []TableKey) [][]
 	}
 
 	sql := fmt.Sprintf(`SELECT %s FROM %s %s;`, formattedColumns, table.Name, where_clause)
-	return sqlUtil.ExecuteQueryWithResults(db, sql)
+	return sqlUtil.ExecuteQueryWithResults(ctx, db, sql)
 }
 
 func filterRowData(value []sqlUtil.RowDataStructure, table schemareader.Table) []sqlUtil.RowDataStructure {
@@ -241,10 +265,9 @@ func filterRowData(value []sqlUtil.RowDataStructure, table schemareader.Table) [
 	return value
 }
 
-func substituteKeys(db *sql.DB, table schemareader.Table, row []sqlUtil.RowDataStructure, tableMap map[string]schemareader.Table) []sqlUtil.RowDataStructure {
+func substituteKeys(ctx context.Context, db *sql.DB, table schemareader.Table, row []sqlUtil.RowDataStructure, tableMap map[string]schemareader.Table) ([]sqlUtil.RowDataStructure, error) {
 	values := substitutePrimaryKey(table, row)
-	values = SubstituteForeignKey(db, table, tableMap, values)
-	return values
+	return SubstituteForeignKey(ctx, db, table, tableMap, values)
 }
 
 func substitutePrimaryKey(table schemareader.Table, row []sqlUtil.RowDataStructure) []sqlUtil.RowDataStructure {
@@ -265,15 +288,19 @@ func substitutePrimaryKey(table schemareader.Table, row []sqlUtil.RowDataStructu
 	return rowResult
 }
 
-func SubstituteForeignKey(db *sql.DB, table schemareader.Table, tables map[string]schemareader.Table, row []sqlUtil.RowDataStructure) []sqlUtil.RowDataStructure {
+func SubstituteForeignKey(ctx context.Context, db *sql.DB, table schemareader.Table, tables map[string]schemareader.Table, row []sqlUtil.RowDataStructure) ([]sqlUtil.RowDataStructure, error) {
 	for _, reference := range table.References {
-		row = substituteForeignKeyReference(db, table, tables, reference, row)
+		var err error
+		row, err = substituteForeignKeyReference(ctx, db, table, tables, reference, row)
+		if err != nil {
+			return nil, err
+		}
 	}
-	return row
+	return row, nil
 }
 
-func substituteForeignKeyReference(db *sql.DB, table schemareader.Table,
-	tables map[string]schemareader.Table, reference schemareader.Reference, row []sqlUtil.RowDataStructure) []sqlUtil.RowDataStructure {
+func substituteForeignKeyReference(ctx context.Context, db *sql.DB, table schemareader.Table,
+	tables map[string]schemareader.Table, reference schemareader.Reference, row []sqlUtil.RowDataStructure) ([]sqlUtil.RowDataStructure, error) {
 	foreignTable := tables[reference.TableName]
 
 	foreignMainUniqueColumns := foreignTable.UniqueIndexes[foreignTable.MainUniqueIndexName].Columns
@@ -296,26 +323,27 @@ func substituteForeignKeyReference(db *sql.DB, table schemareader.Table,
 	sql := fmt.Sprintf(`SELECT %s FROM %s WHERE %s;`, formattedColumns, reference.TableName, formattedWhereParameters)
 	key := fmt.Sprintf("%s,%s,%s", reference.TableName, formattedWhereParameters, scanParameters)
 
-	cachedValue, found := cache[key]
+	cache := referenceCacheFrom(ctx)
+	cachedValue, found := cache.get(key)
 
 	if found {
+		metrics.ReferenceCacheHit(ctx, reference.TableName)
 		//Assuming there will be one entry in reference.ColumnMapping
 		row[table.ColumnIndexes[localColumns[0]]].Value = cachedValue
 		row[table.ColumnIndexes[localColumns[0]]].ColumnType = "SQL"
 	} else {
-		rows := sqlUtil.ExecuteQueryWithResults(db, sql, scanParameters...)
+		metrics.ReferenceCacheMiss(ctx, reference.TableName)
+		rows, err := sqlUtil.ExecuteQueryWithResults(ctx, db, sql, scanParameters...)
+		if err != nil {
+			return nil, err
+		}
 		// we will only change for a sub query if we were able to find the target Value
 		// other wise we keep the pre existing Value.
 		// this can happen when the column for the reference is null. Example rhnchanel->org_id
 		if len(rows) > 0 {
 			whereParameters = make([]string, 0)
 
-			countVal, findCountVal := referrencesCall[reference.TableName]
-			if !findCountVal {
-				countVal = 0
-			}
-			countVal++
-			referrencesCall[reference.TableName] = countVal
+			cache.countCall(reference.TableName)
 
 			for _, foreignColumn := range foreignMainUniqueColumns {
 				// produce the where clause
@@ -332,7 +360,10 @@ func substituteForeignKeyReference(db *sql.DB, table schemareader.Table,
 							} else {
 								//copiedrow := make([]sqlUtil.RowDataStructure, len(rows[0]))
 								//copy(copiedrow, rows[0])
-								rowResultTemp := substituteForeignKeyReference(db, foreignTable, tables, foreignReference, rows[0])
+								rowResultTemp, err := substituteForeignKeyReference(ctx, db, foreignTable, tables, foreignReference, rows[0])
+								if err != nil {
+									return nil, err
+								}
 								fieldToUpdate := formatField(c)
 								for _, field := range rowResultTemp {
 									if strings.Compare(field.ColumnName, foreignColumn) == 0 {
@@ -354,11 +385,11 @@ func substituteForeignKeyReference(db *sql.DB, table schemareader.Table,
 				updateSql := fmt.Sprintf(`SELECT %s FROM %s WHERE %s LIMIT 1`, foreignColumn, reference.TableName, strings.Join(whereParameters, " AND "))
 				row[table.ColumnIndexes[localColumn]].Value = updateSql
 				row[table.ColumnIndexes[localColumn]].ColumnType = "SQL"
-				cache[key] = updateSql
+				cache.put(key, updateSql)
 			}
 		}
 	}
-	return row
+	return row, nil
 }
 
 func formatRowValue(value []sqlUtil.RowDataStructure) string {
@@ -482,8 +513,8 @@ func formatOnConflict(row []sqlUtil.RowDataStructure, table schemareader.Table)
 	return fmt.Sprintf("%s DO UPDATE SET %s", constraint, columnAssignment)
 }
 
-func generateClearTable(db *sql.DB, writer *bufio.Writer, table schemareader.Table, path []string,
-	schemaMetadata map[string]schemareader.Table, options PrintSqlOptions) {
+func generateClearTable(ctx context.Context, db *sql.DB, writer *bufio.Writer, table schemareader.Table, path []string,
+	schemaMetadata map[string]schemareader.Table, options PrintSqlOptions) error {
 
 	// generates the delete statement for the table
 	existingRecords := buildQueryToGetExistingRecords(path, table, schemaMetadata, options.CleanWhereClause)
@@ -493,15 +524,26 @@ func generateClearTable(db *sql.DB, writer *bufio.Writer, table schemareader.Tab
 		table.Name, mainUniqueColumns, existingRecords)
 	writer.WriteString(cleanEmptyTable + "\n")
 
-	// repopulate all pre-existing data
+	// repopulate all pre-existing data, except the rows left out of the crawl
 	allTableRecordsSql := fmt.Sprintf("SELECT * FROM %s WHERE (%s) IN (%s);",
 		table.Name, mainUniqueColumns, existingRecords)
-	allTableRecords := sqlUtil.ExecuteQueryWithResults(db, allTableRecordsSql)
+	if table.CrawlFilter != "" {
+		allTableRecordsSql = fmt.Sprintf("SELECT * FROM %s WHERE (%s) IN (%s) AND %s;",
+			table.Name, mainUniqueColumns, existingRecords, table.CrawlFilter)
+	}
+	allTableRecords, err := sqlUtil.ExecuteQueryWithResults(ctx, db, allTableRecordsSql)
+	if err != nil {
+		return err
+	}
 	for _, record := range allTableRecords {
-		insertStatement := generateRowInsertStatement(db, record, table, schemaMetadata, []string{table.Name})
+		insertStatement, err := generateRowInsertStatement(ctx, db, record, table, schemaMetadata, []string{table.Name})
+		if err != nil {
+			return err
+		}
 		writer.WriteString(insertStatement + "\n")
 		//fmt.Println(insertStatement)
 	}
+	return nil
 }
 
 func buildQueryToGetExistingRecords(path []string, table schemareader.Table, schemaMetadata map[string]schemareader.Table, cleanWhereClause string) string {
@@ -513,6 +555,14 @@ func buildQueryToGetExistingRecords(path []string, table schemareader.Table, sch
 		mainUniqueColumns = mainUniqueColumns + table.Name + "." + column
 	}
 
+	// rows excluded by the filter are neither exported nor cleaned
+	if table.RowFilter != "" {
+		if cleanWhereClause == "" {
+			cleanWhereClause = "WHERE " + table.RowFilter
+		} else {
+			cleanWhereClause = fmt.Sprintf("%s AND %s", cleanWhereClause, table.RowFilter)
+		}
+	}
 	joinsClause := getJoinsClause(path, schemaMetadata)
 	return fmt.Sprintf(`SELECT %s FROM %s %s %s`, mainUniqueColumns, table.Name, joinsClause, cleanWhereClause)
 }
@@ -576,12 +626,15 @@ func prepareColumnNames(table schemareader.Table) string {
 	return returnColumn
 }
 
-func generateRowInsertStatement(db *sql.DB, values []sqlUtil.RowDataStructure, table schemareader.Table,
-	schemaMetadata map[string]schemareader.Table, onlyIfParentExistsTables []string) string {
+func generateRowInsertStatement(ctx context.Context, db *sql.DB, values []sqlUtil.RowDataStructure, table schemareader.Table,
+	schemaMetadata map[string]schemareader.Table, onlyIfParentExistsTables []string) (string, error) {
 
 	tableName := table.Name
 	columnNames := prepareColumnNames(table)
-	rowKeysProcessed := substituteKeys(db, table, values, schemaMetadata)
+	rowKeysProcessed, err := substituteKeys(ctx, db, table, values, schemaMetadata)
+	if err != nil {
+		return "", err
+	}
 	valueFiltered := filterRowData(rowKeysProcessed, table)
 
 	if strings.Compare(table.MainUniqueIndexName, schemareader.VirtualIndexName) == 0 || utils.Contains(onlyIfParentExistsTables, table.Name) {
@@ -617,16 +670,16 @@ func generateRowInsertStatement(db *sql.DB, values []sqlUtil.RowDataStructure, t
 			}
 			parentRecordsExistsClause := strings.Join(parentsRecordsCheckList, " AND ")
 			return fmt.Sprintf(`INSERT INTO %s (%s)	SELECT %s WHERE NOT EXISTS (SELECT 1 FROM %s WHERE %s) AND %s;`,
-				tableName, columnNames, formatRowValue(valueFiltered), tableName, whereClause, parentRecordsExistsClause)
+				tableName, columnNames, formatRowValue(valueFiltered), tableName, whereClause, parentRecordsExistsClause), nil
 		}
 
 		return fmt.Sprintf(`INSERT INTO %s (%s)	SELECT %s WHERE NOT EXISTS (SELECT 1 FROM %s WHERE %s);`,
-			tableName, columnNames, formatRowValue(valueFiltered), tableName, whereClause)
+			tableName, columnNames, formatRowValue(valueFiltered), tableName, whereClause), nil
 
 	} else {
 		onConflictFormatted := formatOnConflict(valueFiltered, table)
 		return fmt.Sprintf(`INSERT INTO %s (%s)	VALUES (%s) ON CONFLICT %s;`,
-			tableName, columnNames, formatRowValue(valueFiltered), onConflictFormatted)
+			tableName, columnNames, formatRowValue(valueFiltered), onConflictFormatted), nil
 	}
 
 }
@@ -6,6 +6,7 @@ package dumper
 
 import (
 	"bufio"
+	"context"
 	"database/sql"
 	"fmt"
 	"strings"
@@ -15,11 +16,15 @@ import (
 	"github.com/uyuni-project/inter-server-sync/sqlUtil"
 )
 
-func DumpAllTablesData(db *sql.DB, writer *bufio.Writer, schemaMetadata map[string]schemareader.Table,
-	startingTables []schemareader.Table, whereFilterClause func(table schemareader.Table) string, onlyIfParentExistsTables []string) {
+func DumpAllTablesData(ctx context.Context, db *sql.DB, writer *bufio.Writer, schemaMetadata map[string]schemareader.Table,
+	startingTables []schemareader.Table, whereFilterClause func(table schemareader.Table) string, onlyIfParentExistsTables []string) error {
 
+	ctx = ensureReferenceCache(ctx)
 	// exporting from the starting tables.
-	processedTables := DumpReachableTablesData(db, writer, schemaMetadata, startingTables, whereFilterClause, onlyIfParentExistsTables, make(map[string]bool))
+	processedTables, err := DumpReachableTablesData(ctx, db, writer, schemaMetadata, startingTables, whereFilterClause, onlyIfParentExistsTables, make(map[string]bool))
+	if err != nil {
+		return err
+	}
 	// Export tables not visited when exporting the starting tables
 	for schemaTableName, schemaTable := range schemaMetadata {
 		if !schemaTable.Export {
@@ -29,31 +34,39 @@ func DumpAllTablesData(db *sql.DB, writer *bufio.Writer, schemaMetadata map[stri
 		if ok {
 			continue
 		}
-		exportAllTableData(db, writer, schemaMetadata, schemaTable, whereFilterClause, onlyIfParentExistsTables)
+		if err := exportAllTableData(ctx, db, writer, schemaMetadata, schemaTable, whereFilterClause, onlyIfParentExistsTables); err != nil {
+			return err
+		}
 	}
+	return nil
 }
 
-func DumpReachableTablesData(db *sql.DB, writer *bufio.Writer, schemaMetadata map[string]schemareader.Table,
-	startingTables []schemareader.Table, whereFilterClause func(table schemareader.Table) string, onlyIfParentExistsTables []string, processedTables map[string]bool) map[string]bool {
+func DumpReachableTablesData(ctx context.Context, db *sql.DB, writer *bufio.Writer, schemaMetadata map[string]schemareader.Table,
+	startingTables []schemareader.Table, whereFilterClause func(table schemareader.Table) string, onlyIfParentExistsTables []string, processedTables map[string]bool) (map[string]bool, error) {
 
+	ctx = ensureReferenceCache(ctx)
 	for _, startingTable := range startingTables {
 		_, ok := processedTables[startingTable.Name]
 		if ok {
 			continue
 		}
-		processedTables = processTableDataWithLinks(db, writer, schemaMetadata, startingTable, whereFilterClause, processedTables, make([]string, 0), onlyIfParentExistsTables)
+		var err error
+		processedTables, err = processTableDataWithLinks(ctx, db, writer, schemaMetadata, startingTable, whereFilterClause, processedTables, make([]string, 0), onlyIfParentExistsTables)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	return processedTables
+	return processedTables, nil
 }
 
-func processTableDataWithLinks(db *sql.DB, writer *bufio.Writer, schemaMetadata map[string]schemareader.Table, table schemareader.Table,
-	whereFilterClause func(table schemareader.Table) string, processedTables map[string]bool, path []string, onlyIfParentExistsTables []string) map[string]bool {
+func processTableDataWithLinks(ctx context.Context, db *sql.DB, writer *bufio.Writer, schemaMetadata map[string]schemareader.Table, table schemareader.Table,
+	whereFilterClause func(table schemareader.Table) string, processedTables map[string]bool, path []string, onlyIfParentExistsTables []string) (map[string]bool, error) {
 	log.Trace().Msgf("Processing table: %s", table.Name)
 	_, tableProcessed := processedTables[table.Name]
 	currentTable := schemaMetadata[table.Name]
 	if tableProcessed || !currentTable.Export {
-		return processedTables
+		return processedTables, nil
 	}
 	path = append(path, table.Name)
 	processedTables[table.Name] = true
@@ -64,11 +77,15 @@ func processTableDataWithLinks(db *sql.DB, writer *bufio.Writer, schemaMetadata
 			continue
 		}
 		log.Trace().Msgf("Table processed: %s", table.Name)
-		processTableDataWithLinks(db, writer, schemaMetadata, tableReference, whereFilterClause, processedTables, path, onlyIfParentExistsTables)
+		if _, err := processTableDataWithLinks(ctx, db, writer, schemaMetadata, tableReference, whereFilterClause, processedTables, path, onlyIfParentExistsTables); err != nil {
+			return nil, err
+		}
 
 	}
 
-	exportAllTableData(db, writer, schemaMetadata, table, whereFilterClause, onlyIfParentExistsTables)
+	if err := exportAllTableData(ctx, db, writer, schemaMetadata, table, whereFilterClause, onlyIfParentExistsTables); err != nil {
+		return nil, err
+	}
 
 	for _, reference := range table.ReferencedBy {
 		tableReference, ok := schemaMetadata[reference.TableName]
@@ -78,22 +95,31 @@ func processTableDataWithLinks(db *sql.DB, writer *bufio.Writer, schemaMetadata
 		if !shouldFollowReferenceToLink(path, table, tableReference) {
 			continue
 		}
-		processTableDataWithLinks(db, writer, schemaMetadata, tableReference, whereFilterClause, processedTables, path, onlyIfParentExistsTables)
+		if _, err := processTableDataWithLinks(ctx, db, writer, schemaMetadata, tableReference, whereFilterClause, processedTables, path, onlyIfParentExistsTables); err != nil {
+			return nil, err
+		}
 
 	}
-	return processedTables
+	return processedTables, nil
 }
 
-func exportAllTableData(db *sql.DB, writer *bufio.Writer, schemaMetadata map[string]schemareader.Table, table schemareader.Table,
-	whereFilterClause func(table schemareader.Table) string, onlyIfParentExistsTables []string) {
+func exportAllTableData(ctx context.Context, db *sql.DB, writer *bufio.Writer, schemaMetadata map[string]schemareader.Table, table schemareader.Table,
+	whereFilterClause func(table schemareader.Table) string, onlyIfParentExistsTables []string) error {
 
 	log.Trace().Msgf("Exporting data for table %s", table.Name)
 	formattedColumns := strings.Join(table.Columns, ", ")
 	sql := fmt.Sprintf(`SELECT %s FROM %s %s;`, formattedColumns, table.Name, whereFilterClause(table))
-	rows := sqlUtil.ExecuteQueryWithResults(db, sql)
+	rows, err := sqlUtil.ExecuteQueryWithResults(ctx, db, sql)
+	if err != nil {
+		return err
+	}
 
 	for _, row := range rows {
-		writer.WriteString(generateRowInsertStatement(db, row, table, schemaMetadata, onlyIfParentExistsTables) + "\n")
+		insertStatement, err := generateRowInsertStatement(ctx, db, row, table, schemaMetadata, onlyIfParentExistsTables)
+		if err != nil {
+			return err
+		}
+		writer.WriteString(insertStatement + "\n")
 	}
-
+	return nil
 }
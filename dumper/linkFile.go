@@ -0,0 +1,70 @@
+// SPDX-FileCopyrightText: 2023 SUSE LLC
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package dumper
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Link modes putting the files of the server in an export
+const (
+	// LinkModeAuto tries a reflink, then a hardlink, then copies the file
+	LinkModeAuto     = "auto"
+	LinkModeHardlink = "hardlink"
+	LinkModeReflink  = "reflink"
+	LinkModeCopy     = "copy"
+)
+
+// LinkModes are the supported link modes
+var LinkModes = []string{LinkModeAuto, LinkModeHardlink, LinkModeReflink, LinkModeCopy}
+
+// LinkOrCopy puts the file src at dst as linkMode tells, copying it when it cannot be linked,
+// e.g. when src and dst are not on the same filesystem. A copy is made when linkMode is empty.
+// It returns the link mode used and the size of the file.
+func LinkOrCopy(ctx context.Context, src, dst string, linkMode string) (string, int64, error) {
+	sourceFileStat, err := os.Stat(src)
+	if err != nil {
+		return "", 0, err
+	}
+	if !sourceFileStat.Mode().IsRegular() {
+		return "", 0, fmt.Errorf("%s is not a regular file", src)
+	}
+	// an existing dst may be a hardlink to src: writing through it would overwrite the server file
+	if err := os.Remove(dst); err != nil && !os.IsNotExist(err) {
+		return "", 0, err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0770); err != nil {
+		return "", 0, err
+	}
+
+	var attempts []string
+	switch linkMode {
+	case LinkModeAuto:
+		attempts = []string{LinkModeReflink, LinkModeHardlink}
+	case LinkModeReflink, LinkModeHardlink:
+		attempts = []string{linkMode}
+	}
+	for _, mode := range attempts {
+		if err := ctx.Err(); err != nil {
+			return "", 0, err
+		}
+		if mode == LinkModeHardlink {
+			err = os.Link(src, dst)
+		} else {
+			err = reflink(src, dst)
+		}
+		if err == nil {
+			return mode, sourceFileStat.Size(), nil
+		}
+		log.Trace().Err(err).Msgf("unable to %s %s, falling back", mode, src)
+	}
+	copiedBytes, err := Copy(ctx, src, dst)
+	return LinkModeCopy, copiedBytes, err
+}
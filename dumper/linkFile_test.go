@@ -0,0 +1,54 @@
+// SPDX-FileCopyrightText: 2023 SUSE LLC
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package dumper
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLinkOrCopy(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "package.rpm")
+	if err := os.WriteFile(src, []byte("package"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for linkMode, expected := range map[string]string{"": LinkModeCopy, LinkModeCopy: LinkModeCopy, LinkModeHardlink: LinkModeHardlink} {
+		dst := filepath.Join(dir, "export", linkMode, "package.rpm")
+		used, size, err := LinkOrCopy(context.Background(), src, dst, linkMode)
+		if err != nil {
+			t.Fatalf("%q: %v", linkMode, err)
+		}
+		if used != expected || size != 7 {
+			t.Errorf("%q: unexpected link mode %s and size %d", linkMode, used, size)
+		}
+		sourceStat, _ := os.Stat(src)
+		targetStat, _ := os.Stat(dst)
+		if os.SameFile(sourceStat, targetStat) != (expected == LinkModeHardlink) {
+			t.Errorf("%q: unexpected link between the source and the export", linkMode)
+		}
+	}
+}
+
+func TestLinkOrCopyKeepsLinkedSource(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "package.rpm")
+	dst := filepath.Join(dir, "export", "package.rpm")
+	if err := os.WriteFile(src, []byte("package"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := LinkOrCopy(context.Background(), src, dst, LinkModeHardlink); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := LinkOrCopy(context.Background(), src, dst, LinkModeCopy); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(src)
+	if err != nil || string(content) != "package" {
+		t.Errorf("source file changed by copying over its link: %q %v", content, err)
+	}
+}
@@ -5,27 +5,32 @@
 package osImageDumper
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path"
 
 	"github.com/rs/zerolog/log"
 	"github.com/uyuni-project/inter-server-sync/dumper"
+	"github.com/uyuni-project/inter-server-sync/progress"
 )
 
 var serverDataFolder = "/srv/www/os-images/"
 
 //FIXME: we have no relation from db tables to actial data so for now copy content of serverDataFolder
 //func DumpOsImages(db *sql.DB, schemaMetadata map[string]schemareader.Table, data dumper.DataDumper, outputFolder string) {
-func DumpOsImages(outputFolder string, orgIds []uint) {
+func DumpOsImages(ctx context.Context, outputFolder string, orgIds []uint, linkMode string) error {
 	log.Debug().Msg("Images data dump")
 
 	imagesDir, err := os.Open(serverDataFolder)
 	if err != nil {
-		log.Fatal().Err(err)
+		return fmt.Errorf("couldn't open images folder: %w", err)
 	}
 	defer imagesDir.Close()
 	orgDirInfo, err := imagesDir.ReadDir(-1)
+	if err != nil {
+		return fmt.Errorf("couldn't read images folder: %w", err)
+	}
 
 	if len(orgIds) == 0 {
 		orgIds = []uint{0}
@@ -37,27 +42,37 @@ func DumpOsImages(outputFolder string, orgIds []uint) {
 				var orgDirPath = path.Join(serverDataFolder, org.Name())
 				orgDir, err := os.Open(orgDirPath)
 				if err != nil {
-					log.Fatal().Err(err)
+					return fmt.Errorf("couldn't open images folder %s: %w", orgDirPath, err)
 				}
 				defer orgDir.Close()
 				orgDirInfo, err := orgDir.ReadDir(-1)
+				if err != nil {
+					return fmt.Errorf("couldn't read images folder %s: %w", orgDirPath, err)
+				}
 
 				for _, image := range orgDirInfo {
 					if image.Type().IsRegular() {
-						DumpOsImage(path.Join(outputFolder, org.Name(), image.Name()), path.Join(orgDirPath, image.Name()))
+						err := DumpOsImage(ctx, path.Join(outputFolder, org.Name(), image.Name()), path.Join(orgDirPath, image.Name()), linkMode)
+						if err != nil {
+							return err
+						}
 					}
 				}
 			}
 		}
 	}
+	return nil
 }
 
-func DumpOsImage(outputFolder string, source string) {
+// DumpOsImage puts the image file source at outputFolder, linked as linkMode tells
+func DumpOsImage(ctx context.Context, outputFolder string, source string, linkMode string) error {
 	log.Trace().Msgf("Copying image %s to %s", source, outputFolder)
-	_, err := dumper.Copy(source, outputFolder)
+	usedLinkMode, copiedBytes, err := dumper.LinkOrCopy(ctx, source, outputFolder, linkMode)
 	if err != nil {
-		log.Fatal().Err(err)
+		return fmt.Errorf("couldn't copy image %s: %w", source, err)
 	}
+	progress.Report(ctx, progress.Event{Event: progress.FilesCopied, File: source, Bytes: copiedBytes, LinkMode: usedLinkMode})
+	return nil
 }
 
 func GetImagePathForImage(filepath string, org_id string, prefixOpt ...string) string {
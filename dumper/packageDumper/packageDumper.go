@@ -5,28 +5,62 @@
 package packageDumper
 
 import (
+	"bufio"
+	"context"
 	"database/sql"
 	"fmt"
-	"github.com/rs/zerolog/log"
+	"os"
+	"path"
+	"strings"
 	"time"
 
+	"github.com/rs/zerolog/log"
+
 	"github.com/uyuni-project/inter-server-sync/dumper"
+	"github.com/uyuni-project/inter-server-sync/progress"
 	"github.com/uyuni-project/inter-server-sync/schemareader"
+	"github.com/uyuni-project/inter-server-sync/sqlUtil"
+	"github.com/uyuni-project/inter-server-sync/utils"
 )
 
 var serverDataFolder = "/var/spacewalk"
 
-func DumpPackageFiles(db *sql.DB, schemaMetadata map[string]schemareader.Table, data dumper.DataDumper, outputFolder string) {
+// ChecksumsFile lists the checksums of the exported package files, as "type checksum path" lines
+const ChecksumsFile = "package-checksums.txt"
+
+// Checksum of a package file, Type being a label of rhnchecksumtype like sha256
+type Checksum struct {
+	Type  string
+	Value string
+}
+
+var packageChecksumsSql = `SELECT c.id, ct.label, c.checksum FROM rhnchecksum c
+	JOIN rhnchecksumtype ct ON ct.id = c.checksum_type_id WHERE c.id IN (%s)`
+
+// DumpPackageFiles copies the files of the packages of data to outputFolder.
+// Files in copiedFiles, shared with packages exported before, are copied once. Files are linked as linkMode tells.
+// Their checksums are appended to the ChecksumsFile of outputFolder, for the import to verify them.
+func DumpPackageFiles(ctx context.Context, db *sql.DB, schemaMetadata map[string]schemareader.Table, data dumper.DataDumper,
+	outputFolder string, copiedFiles map[string]bool, linkMode string) error {
 
 	packageKeysData := data.TableData["rhnpackage"]
 	table := schemaMetadata[packageKeysData.TableName]
 	pathIndex := table.ColumnIndexes["path"]
+	checksumIndex := table.ColumnIndexes["checksum_id"]
+
+	checksumsFile, err := os.OpenFile(path.Join(outputFolder, ChecksumsFile), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("could not open package checksums file: %w", err)
+	}
+	defer checksumsFile.Close()
+	checksumsWriter := bufio.NewWriter(checksumsFile)
 
 	totalPackages := len(packageKeysData.Keys)
 	log.Debug().Msgf("Total package files to copy: %d", totalPackages)
 
 	exportedpackages := 0
 	processing := true
+	defer func() { processing = false }()
 
 	if log.Debug().Enabled() {
 		go func() {
@@ -51,18 +85,78 @@ func DumpPackageFiles(db *sql.DB, schemaMetadata map[string]schemareader.Table,
 		if upperLimit > len(packageKeysData.Keys) {
 			upperLimit = len(packageKeysData.Keys)
 		}
-		rows := dumper.GetRowsFromKeys(db, table, packageKeysData.Keys[exportPoint:upperLimit])
+		rows, err := dumper.GetRowsFromKeys(ctx, db, table, packageKeysData.Keys[exportPoint:upperLimit])
+		if err != nil {
+			return err
+		}
+		checksums, err := getChecksums(ctx, db, rows, checksumIndex)
+		if err != nil {
+			return err
+		}
 		for _, rowPackage := range rows {
 			path := rowPackage[pathIndex]
+			pathValue := fmt.Sprintf("%v", path.Value)
+			if copiedFiles[pathValue] {
+				totalPackages--
+				continue
+			}
+			copiedFiles[pathValue] = true
 			source := fmt.Sprintf("%s/%s", serverDataFolder, path.Value)
 			target := fmt.Sprintf("%s/%s", outputFolder, path.Value)
-			_, error := dumper.Copy(source, target)
-			if error != nil {
-				log.Panic().Err(error).Msg("could not Copy File")
+			usedLinkMode, copiedBytes, err := dumper.LinkOrCopy(ctx, source, target, linkMode)
+			if err != nil {
+				return fmt.Errorf("could not copy package file %s: %w", source, err)
+			}
+			if checksum, ok := checksums[fmt.Sprintf("%v", rowPackage[checksumIndex].Value)]; ok {
+				fmt.Fprintf(checksumsWriter, "%s %s %s\n", checksum.Type, checksum.Value, pathValue)
 			}
 			exportedpackages++
+			progress.Report(ctx, progress.Event{Event: progress.FilesCopied, File: source, Bytes: copiedBytes,
+				LinkMode: usedLinkMode, Current: exportedpackages, Total: totalPackages})
 		}
 		exportPoint = upperLimit
 	}
-	processing = false
+	if err := checksumsWriter.Flush(); err != nil {
+		return fmt.Errorf("could not write package checksums file: %w", err)
+	}
+	return nil
+}
+
+// getChecksums returns the checksums of the package rows, by checksum id
+func getChecksums(ctx context.Context, db *sql.DB, rows [][]sqlUtil.RowDataStructure, checksumIndex int) (map[string]Checksum, error) {
+	ids := make([]string, 0, len(rows))
+	for _, row := range rows {
+		if row[checksumIndex].Value != nil {
+			ids = append(ids, fmt.Sprintf("%v", row[checksumIndex].Value))
+		}
+	}
+	checksums := make(map[string]Checksum, len(ids))
+	if len(ids) == 0 {
+		return checksums, nil
+	}
+	checksumRows, err := sqlUtil.ExecuteQueryWithResults(ctx, db, fmt.Sprintf(packageChecksumsSql, strings.Join(ids, ",")))
+	if err != nil {
+		return nil, fmt.Errorf("could not read package checksums: %w", err)
+	}
+	for _, row := range checksumRows {
+		checksums[fmt.Sprintf("%v", row[0].Value)] = Checksum{Type: fmt.Sprintf("%v", row[1].Value), Value: fmt.Sprintf("%v", row[2].Value)}
+	}
+	return checksums, nil
+}
+
+// ReadChecksums returns the checksums listed in checksumsFile, by package path
+func ReadChecksums(checksumsFile string) (map[string]Checksum, error) {
+	lines, err := utils.ReadFileByLine(checksumsFile)
+	if err != nil {
+		return nil, err
+	}
+	checksums := make(map[string]Checksum, len(lines))
+	for _, line := range lines {
+		fields := strings.SplitN(line, " ", 3)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("invalid line in %s: %q", checksumsFile, line)
+		}
+		checksums[fields[2]] = Checksum{Type: fields[0], Value: fields[1]}
+	}
+	return checksums, nil
 }
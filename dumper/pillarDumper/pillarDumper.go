@@ -5,6 +5,7 @@
 package pillarDumper
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
@@ -20,17 +21,20 @@ import (
 var serverDataDir = "/srv/susemanager/pillar_data/"
 var replacePattern = "{SERVER_FQDN}"
 
-func DumpImagePillars(outputDir string, orgIds []uint, serverConfig string) {
+func DumpImagePillars(outputDir string, orgIds []uint, serverConfig string) error {
 	log.Debug().Msgf("Dumping pillars to %s", outputDir)
 	fqdn := utils.GetCurrentServerFQDN(serverConfig)
 
 	sourceDir := filepath.Join(serverDataDir, "images")
 	orgDir, err := os.Open(sourceDir)
 	if err != nil {
-		log.Fatal().Err(err)
+		return fmt.Errorf("couldn't open pillar folder: %w", err)
 	}
 	defer orgDir.Close()
 	orgDirInfo, err := orgDir.ReadDir(-1)
+	if err != nil {
+		return fmt.Errorf("couldn't read pillar folder: %w", err)
+	}
 
 	// If orgIds is empty, set it to 0 so all orgs would be exported
 	if len(orgIds) == 0 {
@@ -40,22 +44,29 @@ func DumpImagePillars(outputDir string, orgIds []uint, serverConfig string) {
 	for _, org := range orgDirInfo {
 		for _, orgId := range orgIds {
 			if org.Type().IsDir() && (orgId == 0 || org.Name() == fmt.Sprintf("org%d", orgId)) {
-				DumpPillars(path.Join(sourceDir, org.Name()), path.Join(outputDir, org.Name()), fqdn, replacePattern)
+				err := DumpPillars(path.Join(sourceDir, org.Name()), path.Join(outputDir, org.Name()), fqdn, replacePattern)
+				if err != nil {
+					return err
+				}
 			}
 		}
 
 	}
+	return nil
 }
 
-func DumpPillars(sourceDir, outputDir, sourceFQDN, targetFQDN string) {
+func DumpPillars(sourceDir, outputDir, sourceFQDN, targetFQDN string) error {
 	log.Trace().Msgf("Pillar dump for %s, replacing FQDN %s", sourceDir, sourceFQDN)
 
 	pillarDir, err := os.Open(sourceDir)
 	if err != nil {
-		log.Fatal().Err(err)
+		return fmt.Errorf("couldn't open pillar folder %s: %w", sourceDir, err)
 	}
 	defer pillarDir.Close()
 	pillarDirInfo, err := pillarDir.ReadDir(-1)
+	if err != nil {
+		return fmt.Errorf("couldn't read pillar folder %s: %w", sourceDir, err)
+	}
 
 	for _, pillar := range pillarDirInfo {
 		if pillar.Type().IsRegular() {
@@ -67,7 +78,7 @@ func DumpPillars(sourceDir, outputDir, sourceFQDN, targetFQDN string) {
 				pillarTargetPath,
 				sourceFQDN, targetFQDN)
 			if err != nil {
-				log.Fatal().Err(err)
+				return fmt.Errorf("couldn't copy pillar %s: %w", pillarFilePath, err)
 			}
 			os.Chmod(pillarTargetPath, 0640)
 			cmd := exec.Command("chown", "salt:susemanager", pillarTargetPath)
@@ -75,70 +86,76 @@ func DumpPillars(sourceDir, outputDir, sourceFQDN, targetFQDN string) {
 			cmd.Stderr = os.Stderr
 			err = cmd.Run()
 			if err != nil {
-				log.Fatal().Err(err).Msg("Error processing image pillar files")
+				return fmt.Errorf("error processing image pillar files: %w", err)
 			}
 		}
 	}
+	return nil
 }
 
 // 4.2 and older stores pillars in files
 // image export replaces hostnames in image pillars, we need to replace them to correct SUMA on import
-func ImportImagePillars(sourceDir string, fqdn string) {
+func ImportImagePillars(sourceDir string, fqdn string) error {
 	log.Debug().Msgf("Importing image pillars from %s", sourceDir)
 	orgDir, err := os.Open(sourceDir)
 	if err != nil {
-		log.Fatal().Err(err)
+		return fmt.Errorf("couldn't open pillar folder %s: %w", sourceDir, err)
 	}
 	defer orgDir.Close()
 	orgDirInfo, err := orgDir.ReadDir(-1)
+	if err != nil {
+		return fmt.Errorf("couldn't read pillar folder %s: %w", sourceDir, err)
+	}
 
 	for _, org := range orgDirInfo {
 		if org.Type().IsDir() {
 			targetDir := path.Join(serverDataDir, "images", org.Name())
-			DumpPillars(path.Join(sourceDir, org.Name()), targetDir, replacePattern, fqdn)
+			err := DumpPillars(path.Join(sourceDir, org.Name()), targetDir, replacePattern, fqdn)
+			if err != nil {
+				return err
+			}
 
 			cmd := exec.Command("chown", "salt:susemanager", targetDir)
 			cmd.Stdout = os.Stdout
 			cmd.Stderr = os.Stderr
 			err = cmd.Run()
 			if err != nil {
-				log.Fatal().Err(err).Msg("Error importing image pillar files")
-
+				return fmt.Errorf("error importing image pillar files: %w", err)
 			}
 		}
 	}
+	return nil
 }
 
 // 4.3 and newer stores pillars in database
-// image export replaces hostnames in image pillars, we need to replace them to correct SUMA on import
-func UpdateImagePillars(serverConfig string) {
+// image export replaces hostnames in image pillars, we need to replace them to correct SUMA on import.
+// Returns the number of updated pillars
+func UpdateImagePillars(ctx context.Context, serverConfig string) (int64, error) {
 	fqdn := utils.GetCurrentServerFQDN(serverConfig)
 
 	checkQuery := "SELECT EXISTS (SELECT FROM pg_tables WHERE schemaname = 'public' AND tablename = 'susesaltpillar')"
-	db := schemareader.GetDBconnection(serverConfig)
-	rows, err := db.Query(checkQuery)
+	db, err := schemareader.GetDBconnection(serverConfig)
 	if err != nil {
-		log.Fatal().Err(err).Msgf("Error while executing '%s'", checkQuery)
-	}
-	if !rows.Next() {
-		log.Fatal().Msgf("No return on pillar database table check")
+		return 0, err
 	}
+	defer db.Close()
 	var hasPillars bool
-	err = rows.Scan(&hasPillars)
+	err = db.QueryRowContext(ctx, checkQuery).Scan(&hasPillars)
 	if err != nil {
-		log.Fatal().Err(err).Msgf("Unexpected query result")
+		return 0, fmt.Errorf("error on pillar database table check: %w", err)
 	}
 	if !hasPillars {
 		log.Debug().Msgf("Pillars not backed by database")
-		return
+		return 0, nil
 	}
 
 	sqlQuery := fmt.Sprintf("UPDATE susesaltpillar SET pillar = REPLACE(pillar::text, '%s', '%s')::jsonb WHERE category LIKE 'Image%%';",
 		replacePattern, fqdn)
 	log.Trace().Msgf("Updating pillar files using query '%s'", sqlQuery)
 	log.Info().Msg("Updating image pillars if needed")
-	rows, err = db.Query(sqlQuery)
+	result, err := db.ExecContext(ctx, sqlQuery)
 	if err != nil {
-		log.Fatal().Err(err).Msgf("Error updating image pillars")
+		return 0, fmt.Errorf("error updating image pillars: %w", err)
 	}
+	return result.RowsAffected()
 }
@@ -0,0 +1,75 @@
+// SPDX-FileCopyrightText: 2023 SUSE LLC
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package dumper
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+)
+
+// referenceCache holds the sub queries replacing the foreign keys already resolved by an export.
+// Each export has its own cache in its context, so exports running at the same time never share one.
+type referenceCache struct {
+	mutex      sync.Mutex
+	subQueries map[string]string
+	// calls counts the references resolved with a query, per referenced table
+	calls map[string]int
+}
+
+type referenceCacheKey struct{}
+
+// WithReferenceCache returns a context carrying an empty foreign key reference cache, used by the exports run with it
+func WithReferenceCache(ctx context.Context) context.Context {
+	cache := &referenceCache{subQueries: make(map[string]string), calls: make(map[string]int)}
+	return context.WithValue(ctx, referenceCacheKey{}, cache)
+}
+
+// ensureReferenceCache returns ctx if it carries a cache, or a context carrying an empty one
+func ensureReferenceCache(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(referenceCacheKey{}).(*referenceCache); ok {
+		return ctx
+	}
+	return WithReferenceCache(ctx)
+}
+
+// referenceCacheFrom returns the cache of ctx, or an empty one not kept anywhere if ctx has none
+func referenceCacheFrom(ctx context.Context) *referenceCache {
+	if cache, ok := ctx.Value(referenceCacheKey{}).(*referenceCache); ok {
+		return cache
+	}
+	return &referenceCache{subQueries: make(map[string]string), calls: make(map[string]int)}
+}
+
+func (cache *referenceCache) get(key string) (string, bool) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	subQuery, found := cache.subQueries[key]
+	return subQuery, found
+}
+
+func (cache *referenceCache) put(key string, subQuery string) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	cache.subQueries[key] = subQuery
+}
+
+func (cache *referenceCache) countCall(tableName string) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	cache.calls[tableName]++
+}
+
+func (cache *referenceCache) size() int {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	return len(cache.subQueries)
+}
+
+func (cache *referenceCache) marshalCalls() ([]byte, error) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	return json.Marshal(cache.calls)
+}
@@ -0,0 +1,74 @@
+// SPDX-FileCopyrightText: 2023 SUSE LLC
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package dumper
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/uyuni-project/inter-server-sync/schemareader"
+	"github.com/uyuni-project/inter-server-sync/tests"
+)
+
+// TestConcurrentExportsReferenceCache runs exports at the same time, as the daemon does with jobs due together:
+// each one must resolve its foreign keys with its own database, not with the references cached by another one
+func TestConcurrentExportsReferenceCache(t *testing.T) {
+	nameIndex := "rhn_pn_name_uq"
+	schemaMetadata := map[string]schemareader.Table{
+		"rhnpackage": {
+			Name:                "rhnpackage",
+			Export:              true,
+			Columns:             []string{"id", "name_id"},
+			ColumnIndexes:       map[string]int{"id": 0, "name_id": 1},
+			PKColumns:           map[string]bool{"id": true},
+			MainUniqueIndexName: schemareader.VirtualIndexName,
+			UniqueIndexes:       map[string]schemareader.UniqueIndex{schemareader.VirtualIndexName: {Name: schemareader.VirtualIndexName, Columns: []string{"id"}}},
+			References:          []schemareader.Reference{{TableName: "rhnpackagename", ColumnMapping: map[string]string{"name_id": "id"}}},
+		},
+		"rhnpackagename": {
+			Name:                "rhnpackagename",
+			Columns:             []string{"id", "name"},
+			ColumnIndexes:       map[string]int{"id": 0, "name": 1},
+			PKColumns:           map[string]bool{"id": true},
+			MainUniqueIndexName: nameIndex,
+			UniqueIndexes:       map[string]schemareader.UniqueIndex{nameIndex: {Name: nameIndex, Columns: []string{"name"}}},
+		},
+	}
+
+	var running sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		running.Add(1)
+		go func(name string) {
+			defer running.Done()
+			repo := tests.CreateDataRepository()
+			repo.ExpectWithRecords("SELECT id, name_id FROM rhnpackage ;",
+				sqlmock.NewRows([]string{"id", "name_id"}).AddRow("1", "1").AddRow("2", "1"))
+			// the second package is resolved from the cache of this export
+			repo.ExpectWithRecords("SELECT id, name FROM rhnpackagename WHERE id = $1;",
+				sqlmock.NewRows([]string{"id", "name"}).AddRow("1", name), "1")
+
+			err := DumpAllTablesData(context.Background(), repo.DB, repo.Writer, schemaMetadata,
+				[]schemareader.Table{schemaMetadata["rhnpackage"]}, func(table schemareader.Table) string { return "" }, []string{})
+
+			if err != nil {
+				t.Errorf("export of %s failed: %v", name, err)
+				return
+			}
+			if err := repo.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations for %s: %s", name, err)
+			}
+			output := strings.Join(repo.GetWriterBuffer(), "")
+			expected := fmt.Sprintf("(SELECT id FROM rhnpackagename WHERE name = '%s' LIMIT 1)", name)
+			if strings.Count(output, expected) != 2 {
+				t.Errorf("expected both packages of %s to reference %s:\n%s", name, expected, output)
+			}
+		}(fmt.Sprintf("package-%d", i))
+	}
+	running.Wait()
+}
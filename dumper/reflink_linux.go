@@ -0,0 +1,34 @@
+// SPDX-FileCopyrightText: 2023 SUSE LLC
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package dumper
+
+import (
+	"os"
+	"syscall"
+)
+
+// ficlone is the FICLONE ioctl request, sharing the extents of a file with another one on filesystems like XFS or Btrfs
+const ficlone = 0x40049409
+
+// reflink creates dst sharing the content of src, dst is removed if the filesystem cannot clone src
+func reflink(src, dst string) error {
+	source, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	destination, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		return err
+	}
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, destination.Fd(), ficlone, source.Fd())
+	closeErr := destination.Close()
+	if errno != 0 {
+		os.Remove(dst)
+		return &os.PathError{Op: "ficlone", Path: dst, Err: errno}
+	}
+	return closeErr
+}
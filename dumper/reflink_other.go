@@ -0,0 +1,15 @@
+// SPDX-FileCopyrightText: 2023 SUSE LLC
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !linux
+
+package dumper
+
+import "errors"
+
+var errReflinkUnsupported = errors.New("reflinks are not supported on this platform")
+
+func reflink(src, dst string) error {
+	return errReflinkUnsupported
+}
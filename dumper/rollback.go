@@ -0,0 +1,304 @@
+// SPDX-FileCopyrightText: 2023 SUSE LLC
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package dumper
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/uyuni-project/inter-server-sync/schemareader"
+	"github.com/uyuni-project/inter-server-sync/sqlUtil"
+	"github.com/uyuni-project/inter-server-sync/utils"
+)
+
+// PrintRollbackStatements writes the statements restoring the rows of the tables linked by paths to the records selected
+// by whereClause, as they are now. The rows of tablesToClean linked by then are deleted and the current ones inserted
+// back, with the same joins as the clean statements. The rows of the other tables are updated back to their current values.
+func PrintRollbackStatements(ctx context.Context, db sqlUtil.Querier, writer *bufio.Writer, schemaMetadata map[string]schemareader.Table,
+	paths map[string][]string, tablesToClean []string, whereClause string) error {
+
+	tableNames := make([]string, 0, len(paths))
+	for tableName := range paths {
+		tableNames = append(tableNames, tableName)
+	}
+	sort.Strings(tableNames)
+	// the rows are only updated: the rows linked later by the cleaned tables still reference them
+	for _, tableName := range tableNames {
+		if utils.Contains(tablesToClean, tableName) {
+			continue
+		}
+		rows, err := readExistingRows(ctx, db, schemaMetadata, schemaMetadata[tableName], paths[tableName], whereClause)
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			if statement := formatRestoreUpdate(schemaMetadata[tableName], row); statement != "" {
+				writer.WriteString(statement + "\n")
+			}
+		}
+	}
+	for _, tableName := range tablesToClean {
+		path, ok := paths[tableName]
+		if !ok {
+			continue
+		}
+		table := schemaMetadata[tableName]
+		rows, err := readExistingRows(ctx, db, schemaMetadata, table, path, whereClause)
+		if err != nil {
+			return err
+		}
+		writer.WriteString(fmt.Sprintf("DELETE FROM %s WHERE (%s) IN (%s);\n", table.Name,
+			strings.Join(table.UniqueIndexes[table.MainUniqueIndexName].Columns, ","),
+			buildQueryToGetExistingRecords(path, table, schemaMetadata, whereClause)))
+		for _, row := range rows {
+			writer.WriteString(formatRestoreInsert(table, row) + "\n")
+		}
+	}
+	return nil
+}
+
+func readExistingRows(ctx context.Context, db sqlUtil.Querier, schemaMetadata map[string]schemareader.Table, table schemareader.Table,
+	path []string, whereClause string) ([][]sqlUtil.RowDataStructure, error) {
+
+	qualifiedColumns := make([]string, 0, len(table.Columns))
+	for _, column := range table.Columns {
+		qualifiedColumns = append(qualifiedColumns, table.Name+"."+column)
+	}
+	sql := fmt.Sprintf(`SELECT %s FROM %s %s %s;`, strings.Join(qualifiedColumns, ", "), table.Name,
+		getJoinsClause(path, schemaMetadata), whereClause)
+	rows, err := sqlUtil.ExecuteQueryWithResults(ctx, db, sql)
+	if err != nil {
+		return nil, err
+	}
+	// the joins return a row once for each record linking it
+	result := make([][]sqlUtil.RowDataStructure, 0, len(rows))
+	found := make(map[string]bool, len(rows))
+	for _, row := range rows {
+		values := make([]string, 0, len(row))
+		for _, column := range row {
+			values = append(values, formatField(column))
+		}
+		key := strings.Join(values, ",")
+		if !found[key] {
+			found[key] = true
+			result = append(result, row)
+		}
+	}
+	return result, nil
+}
+
+// formatRestoreInsert inserts the row with all its values, ids included, unless the table already has it
+func formatRestoreInsert(table schemareader.Table, row []sqlUtil.RowDataStructure) string {
+	columns := make([]string, 0, len(row))
+	values := make([]string, 0, len(row))
+	for _, column := range row {
+		columns = append(columns, column.ColumnName)
+		values = append(values, formatField(column))
+	}
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) ON CONFLICT DO NOTHING;", table.Name,
+		strings.Join(columns, ", "), strings.Join(values, ", "))
+}
+
+// formatRestoreUpdate sets back the values of the row, identified by its primary key or, without one, its main unique index
+func formatRestoreUpdate(table schemareader.Table, row []sqlUtil.RowDataStructure) string {
+	keyColumns := make(map[string]bool)
+	for column := range table.PKColumns {
+		keyColumns[column] = true
+	}
+	if len(keyColumns) == 0 {
+		for _, column := range table.UniqueIndexes[table.MainUniqueIndexName].Columns {
+			keyColumns[column] = true
+		}
+	}
+	assignments := make([]string, 0, len(row))
+	conditions := make([]string, 0, len(keyColumns))
+	for _, column := range row {
+		if keyColumns[column.ColumnName] {
+			if column.Value == nil {
+				conditions = append(conditions, fmt.Sprintf("%s IS NULL", column.ColumnName))
+			} else {
+				conditions = append(conditions, fmt.Sprintf("%s = %s", column.ColumnName, formatField(column)))
+			}
+		} else {
+			assignments = append(assignments, fmt.Sprintf("%s = %s", column.ColumnName, formatField(column)))
+		}
+	}
+	if len(assignments) == 0 || len(conditions) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("UPDATE %s SET %s WHERE %s;", table.Name, strings.Join(assignments, ", "), strings.Join(conditions, " AND "))
+}
+
+// ReadLastIds returns the highest value of the primary key of the tables having a single column one: the rows created
+// later have a higher value
+func ReadLastIds(ctx context.Context, db sqlUtil.Querier, schemaMetadata map[string]schemareader.Table, tableNames []string) (map[string]string, error) {
+	lastIds := make(map[string]string)
+	for _, tableName := range tableNames {
+		column, ok := singleKeyColumn(schemaMetadata[tableName])
+		if !ok {
+			continue
+		}
+		rows, err := sqlUtil.ExecuteQueryWithResults(ctx, db,
+			fmt.Sprintf("SELECT COALESCE(MAX(%s), 0) FROM %s;", column, tableName))
+		if err != nil {
+			return nil, err
+		}
+		if len(rows) == 0 || len(rows[0]) == 0 {
+			continue
+		}
+		lastIds[tableName] = formatField(rows[0][0])
+	}
+	return lastIds, nil
+}
+
+// PrintCreatedRowsTables writes the statements creating the temporary tables collecting the keys of the rows created after
+// lastIds were read, dropped at the end of the transaction
+func PrintCreatedRowsTables(writer *bufio.Writer, schemaMetadata map[string]schemareader.Table, tableNames []string,
+	lastIds map[string]string) {
+
+	for _, tableName := range tableNames {
+		if createdRowsCondition(schemaMetadata[tableName], schemaMetadata, lastIds) == "" {
+			continue
+		}
+		writer.WriteString(fmt.Sprintf("CREATE TEMPORARY TABLE %s ON COMMIT DROP AS SELECT %s FROM %s WITH NO DATA;\n",
+			createdRowsTable(tableName), strings.Join(rowKeyColumns(schemaMetadata[tableName]), ", "), tableName))
+	}
+}
+
+// PrintCreatedRowsCollection writes the statements collecting the keys of the rows of the tables linked by paths to the
+// records selected by whereClause, created after lastIds were read. The rows without a single column primary key are
+// collected when they reference a created row.
+func PrintCreatedRowsCollection(writer *bufio.Writer, schemaMetadata map[string]schemareader.Table, paths map[string][]string,
+	tableNames []string, whereClause string, lastIds map[string]string) {
+
+	for _, tableName := range tableNames {
+		path, ok := paths[tableName]
+		if !ok {
+			continue
+		}
+		table := schemaMetadata[tableName]
+		condition := createdRowsCondition(table, schemaMetadata, lastIds)
+		if condition == "" {
+			continue
+		}
+		qualifiedColumns := make([]string, 0)
+		for _, column := range rowKeyColumns(table) {
+			qualifiedColumns = append(qualifiedColumns, table.Name+"."+column)
+		}
+		writer.WriteString(fmt.Sprintf("INSERT INTO %s SELECT %s FROM %s %s %s AND (%s);\n", createdRowsTable(tableName),
+			strings.Join(qualifiedColumns, ", "), table.Name, getJoinsClause(path, schemaMetadata), whereClause, condition))
+	}
+}
+
+// PrintCreatedRowsDeletion writes the statements deleting the rows collected by PrintCreatedRowsCollection, the rows
+// referencing others first. Rows with a single column primary key still referenced by other rows are kept.
+func PrintCreatedRowsDeletion(writer *bufio.Writer, schemaMetadata map[string]schemareader.Table, tableNames []string,
+	lastIds map[string]string) {
+
+	for _, tableName := range orderReferencingFirst(schemaMetadata, tableNames) {
+		table := schemaMetadata[tableName]
+		if createdRowsCondition(table, schemaMetadata, lastIds) == "" {
+			continue
+		}
+		keyColumns := strings.Join(rowKeyColumns(table), ", ")
+		statement := fmt.Sprintf("DELETE FROM %s WHERE (%s) IN (SELECT %s FROM %s)", table.Name, keyColumns, keyColumns,
+			createdRowsTable(tableName))
+		if column, ok := singleKeyColumn(table); ok {
+			for _, reference := range table.ReferencedBy {
+				for referencingColumn, referencedColumn := range reference.ColumnMapping {
+					if len(reference.ColumnMapping) == 1 && referencedColumn == column {
+						statement += fmt.Sprintf(" AND NOT EXISTS (SELECT 1 FROM %s referencing WHERE referencing.%s = %s.%s)",
+							reference.TableName, referencingColumn, table.Name, column)
+					}
+				}
+			}
+		}
+		writer.WriteString(statement + ";\n")
+	}
+}
+
+// createdRowsTable is the temporary table collecting the keys of the rows of tableName created by an import
+func createdRowsTable(tableName string) string {
+	return "rollback_" + tableName
+}
+
+// createdRowsCondition is the SQL condition matching the rows of table created after lastIds were read, or empty if they
+// cannot be told apart
+func createdRowsCondition(table schemareader.Table, schemaMetadata map[string]schemareader.Table, lastIds map[string]string) string {
+	if column, ok := singleKeyColumn(table); ok {
+		if lastId, ok := lastIds[table.Name]; ok {
+			return fmt.Sprintf("%s.%s > %s", table.Name, column, lastId)
+		}
+		return ""
+	}
+	conditions := make([]string, 0)
+	for _, reference := range table.References {
+		lastId, ok := lastIds[reference.TableName]
+		if !ok || len(reference.ColumnMapping) != 1 {
+			continue
+		}
+		referencedKey, _ := singleKeyColumn(schemaMetadata[reference.TableName])
+		for column, referencedColumn := range reference.ColumnMapping {
+			if referencedColumn == referencedKey {
+				conditions = append(conditions, fmt.Sprintf("%s.%s > %s", table.Name, column, lastId))
+			}
+		}
+	}
+	sort.Strings(conditions)
+	return strings.Join(conditions, " OR ")
+}
+
+// singleKeyColumn returns the primary key column of table, if it is the only one
+func singleKeyColumn(table schemareader.Table) (string, bool) {
+	if len(table.PKColumns) != 1 {
+		return "", false
+	}
+	for column := range table.PKColumns {
+		return column, true
+	}
+	return "", false
+}
+
+// rowKeyColumns returns the primary key columns of table or, without one, the columns of its main unique index
+func rowKeyColumns(table schemareader.Table) []string {
+	columns := make([]string, 0, len(table.PKColumns))
+	for column := range table.PKColumns {
+		columns = append(columns, column)
+	}
+	if len(columns) == 0 {
+		return table.UniqueIndexes[table.MainUniqueIndexName].Columns
+	}
+	sort.Strings(columns)
+	return columns
+}
+
+// orderReferencingFirst sorts tableNames so that each table comes before the tables it references
+func orderReferencingFirst(schemaMetadata map[string]schemareader.Table, tableNames []string) []string {
+	sortedNames := append(make([]string, 0, len(tableNames)), tableNames...)
+	sort.Strings(sortedNames)
+	result := make([]string, 0, len(tableNames))
+	visited := make(map[string]bool, len(tableNames))
+	var visit func(tableName string)
+	visit = func(tableName string) {
+		if visited[tableName] {
+			return
+		}
+		visited[tableName] = true
+		// the tables referencing this one are deleted before it
+		for _, reference := range schemaMetadata[tableName].ReferencedBy {
+			if reference.TableName != tableName && utils.Contains(sortedNames, reference.TableName) {
+				visit(reference.TableName)
+			}
+		}
+		result = append(result, tableName)
+	}
+	for _, tableName := range sortedNames {
+		visit(tableName)
+	}
+	return result
+}
@@ -0,0 +1,47 @@
+// SPDX-FileCopyrightText: 2023 SUSE LLC
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package dumper
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/uyuni-project/inter-server-sync/tests"
+)
+
+func TestPrintRollbackStatements(t *testing.T) {
+	// Arrange
+	schemaMetadata, _ := initializeMetaDataGraph(TablesGraph{"root": {"v11"}, "v11": {}}, "root")
+	paths := ExistingRecordsPaths(schemaMetadata, schemaMetadata["root"])
+	repo := tests.CreateDataRepository()
+	repo.ExpectWithRecords("SELECT root.id, root.v11_fk_id FROM root  WHERE root.id = 1;",
+		sqlmock.NewRows([]string{"id", "v11_fk_id"}).AddRow("1", "2"))
+	// the joins return the linked row twice
+	repo.ExpectWithRecords("SELECT v11.id FROM v11  INNER JOIN root on root.v11_fk_id = v11.id WHERE root.id = 1;",
+		sqlmock.NewRows([]string{"id"}).AddRow("2").AddRow("2"))
+
+	// Act
+	err := PrintRollbackStatements(context.Background(), repo.DB, repo.Writer, schemaMetadata, paths, []string{"v11"}, "WHERE root.id = 1")
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+	expected := []string{
+		"UPDATE root SET v11_fk_id = '2' WHERE id = '1';",
+		"DELETE FROM v11 WHERE (id) IN (SELECT v11.id FROM v11  INNER JOIN root on root.v11_fk_id = v11.id WHERE root.id = 1);",
+		"INSERT INTO v11 (id) VALUES ('2') ON CONFLICT DO NOTHING;",
+	}
+	statements := strings.Split(strings.TrimSpace(strings.Join(repo.GetWriterBuffer(), "")), "\n")
+	if !reflect.DeepEqual(statements, expected) {
+		t.Errorf("expected %q, got %q", expected, statements)
+	}
+}
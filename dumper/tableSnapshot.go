@@ -0,0 +1,326 @@
+// SPDX-FileCopyrightText: 2023 SUSE LLC
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package dumper
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/uyuni-project/inter-server-sync/schemareader"
+	"github.com/uyuni-project/inter-server-sync/sqlUtil"
+)
+
+// maximum number of foreign keys followed when describing a row by its natural key
+const maxResolveDepth = 5
+
+// TableSnapshot holds the rows of a table, indexed by natural key, with all values formatted as SQL literals
+type TableSnapshot struct {
+	TableName string
+	Rows      map[string]map[string]string
+}
+
+// ColumnChange records the value of a column before and after a change
+type ColumnChange struct {
+	Column string
+	Before string
+	After  string
+}
+
+// RowChange lists the changed columns of a row identified by its natural key
+type RowChange struct {
+	Key     string
+	Changes []ColumnChange
+}
+
+// TableDiff holds the natural keys of the inserted, updated and deleted rows of a table
+type TableDiff struct {
+	TableName string
+	Inserted  []string
+	Updated   []RowChange
+	Deleted   []string
+}
+
+func (diff TableDiff) IsEmpty() bool {
+	return len(diff.Inserted) == 0 && len(diff.Updated) == 0 && len(diff.Deleted) == 0
+}
+
+// ExistingRecordsPaths walks the schema from the startingTable in the same order used to print the clean statements
+// and returns, for every table found, the path used to join it to the startingTable
+func ExistingRecordsPaths(schemaMetadata map[string]schemareader.Table, startingTable schemareader.Table) map[string][]string {
+	paths := make(map[string][]string)
+	collectExistingRecordsPaths(schemaMetadata, startingTable, paths, make([]string, 0))
+	return paths
+}
+
+func collectExistingRecordsPaths(schemaMetadata map[string]schemareader.Table, table schemareader.Table,
+	paths map[string][]string, path []string) {
+
+	_, tableProcessed := paths[table.Name]
+	if tableProcessed || !table.Export {
+		return
+	}
+	path = append(path, table.Name)
+	paths[table.Name] = append(make([]string, 0, len(path)), path...)
+
+	for _, reference := range table.ReferencedBy {
+		tableReference, ok := schemaMetadata[reference.TableName]
+		if !ok || !tableReference.Export {
+			continue
+		}
+		if !shouldFollowReferenceToLink(path, table, tableReference) {
+			continue
+		}
+		collectExistingRecordsPaths(schemaMetadata, tableReference, paths, path)
+	}
+
+	for _, reference := range table.References {
+		tableReference, ok := schemaMetadata[reference.TableName]
+		if !ok || !tableReference.Export {
+			continue
+		}
+		collectExistingRecordsPaths(schemaMetadata, tableReference, paths, path)
+	}
+}
+
+// ReadTableSnapshot reads all rows of table linked by path to the records selected by whereClause,
+// using the same joins as the generated clean statements
+func ReadTableSnapshot(ctx context.Context, db sqlUtil.Querier, schemaMetadata map[string]schemareader.Table, table schemareader.Table,
+	path []string, whereClause string, resolver *NaturalKeyResolver) (TableSnapshot, error) {
+
+	qualifiedColumns := make([]string, 0, len(table.Columns))
+	for _, column := range table.Columns {
+		qualifiedColumns = append(qualifiedColumns, table.Name+"."+column)
+	}
+	sql := fmt.Sprintf(`SELECT %s FROM %s %s %s;`, strings.Join(qualifiedColumns, ", "), table.Name,
+		getJoinsClause(path, schemaMetadata), whereClause)
+	snapshot := TableSnapshot{TableName: table.Name, Rows: make(map[string]map[string]string)}
+	rows, err := sqlUtil.ExecuteQueryWithResults(ctx, db, sql)
+	if err != nil {
+		return snapshot, err
+	}
+	return snapshot, snapshot.addRows(ctx, table, rows, resolver)
+}
+
+// ReadCrawledSnapshot reads all rows of table found by the DataCrawler
+func ReadCrawledSnapshot(ctx context.Context, db *sql.DB, table schemareader.Table, data DataDumper, resolver *NaturalKeyResolver) (TableSnapshot, error) {
+	snapshot := TableSnapshot{TableName: table.Name, Rows: make(map[string]map[string]string)}
+	tableData, dataOK := data.TableData[table.Name]
+	if !dataOK {
+		return snapshot, nil
+	}
+	exportPoint := 0
+	batch := 100
+	for len(tableData.Keys) > exportPoint {
+		upperLimit := exportPoint + batch
+		if upperLimit > len(tableData.Keys) {
+			upperLimit = len(tableData.Keys)
+		}
+		rows, err := GetRowsFromKeys(ctx, db, table, tableData.Keys[exportPoint:upperLimit])
+		if err != nil {
+			return snapshot, err
+		}
+		if err := snapshot.addRows(ctx, table, rows, resolver); err != nil {
+			return snapshot, err
+		}
+		exportPoint = upperLimit
+	}
+	return snapshot, nil
+}
+
+func (snapshot TableSnapshot) addRows(ctx context.Context, table schemareader.Table, rows [][]sqlUtil.RowDataStructure, resolver *NaturalKeyResolver) error {
+	for _, row := range rows {
+		described, err := resolver.describeRow(ctx, table, row, 0)
+		if err != nil {
+			return err
+		}
+		key := resolver.rowKey(table, described)
+		// ids generated by sequences differ between servers and are not relevant for the comparison
+		for column := range table.PKColumns {
+			if len(table.PKSequence) > 0 {
+				delete(described, column)
+			}
+		}
+		for column := range table.UnexportColumns {
+			delete(described, column)
+		}
+		snapshot.Rows[key] = described
+	}
+	return nil
+}
+
+// WithoutColumns returns a copy of the snapshot without the given columns
+func (snapshot TableSnapshot) WithoutColumns(columns ...string) TableSnapshot {
+	result := TableSnapshot{TableName: snapshot.TableName, Rows: make(map[string]map[string]string, len(snapshot.Rows))}
+	for key, row := range snapshot.Rows {
+		resultRow := make(map[string]string, len(row))
+		for column, value := range row {
+			resultRow[column] = value
+		}
+		for _, column := range columns {
+			delete(resultRow, column)
+		}
+		result.Rows[key] = resultRow
+	}
+	return result
+}
+
+// SnapshotsDigest computes a checksum of the content of the snapshots, independent of the order rows were read
+func SnapshotsDigest(snapshots []TableSnapshot) string {
+	digest := sha256.New()
+	for _, snapshot := range snapshots {
+		fmt.Fprintf(digest, "table %s\n", snapshot.TableName)
+		keys := make([]string, 0, len(snapshot.Rows))
+		for key := range snapshot.Rows {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			row := snapshot.Rows[key]
+			columns := make([]string, 0, len(row))
+			for column := range row {
+				columns = append(columns, column)
+			}
+			sort.Strings(columns)
+			fmt.Fprintf(digest, "row %s\n", key)
+			for _, column := range columns {
+				fmt.Fprintf(digest, "%s=%s\n", column, row[column])
+			}
+		}
+	}
+	return hex.EncodeToString(digest.Sum(nil))
+}
+
+// DiffTableSnapshots compares two snapshots of the same table, sorting the results by natural key
+func DiffTableSnapshots(before TableSnapshot, after TableSnapshot) TableDiff {
+	diff := TableDiff{TableName: after.TableName, Inserted: make([]string, 0),
+		Updated: make([]RowChange, 0), Deleted: make([]string, 0)}
+
+	for key, afterRow := range after.Rows {
+		beforeRow, ok := before.Rows[key]
+		if !ok {
+			diff.Inserted = append(diff.Inserted, key)
+			continue
+		}
+		changes := make([]ColumnChange, 0)
+		for column, afterValue := range afterRow {
+			if beforeValue := beforeRow[column]; beforeValue != afterValue {
+				changes = append(changes, ColumnChange{Column: column, Before: beforeValue, After: afterValue})
+			}
+		}
+		if len(changes) > 0 {
+			sort.Slice(changes, func(i, j int) bool { return changes[i].Column < changes[j].Column })
+			diff.Updated = append(diff.Updated, RowChange{Key: key, Changes: changes})
+		}
+	}
+	for key := range before.Rows {
+		if _, ok := after.Rows[key]; !ok {
+			diff.Deleted = append(diff.Deleted, key)
+		}
+	}
+
+	sort.Strings(diff.Inserted)
+	sort.Strings(diff.Deleted)
+	sort.Slice(diff.Updated, func(i, j int) bool { return diff.Updated[i].Key < diff.Updated[j].Key })
+	return diff
+}
+
+// NaturalKeyResolver describes rows by their natural key, replacing foreign key ids
+// by the natural key of the referenced row, since ids are not meaningful across servers
+type NaturalKeyResolver struct {
+	db             sqlUtil.Querier
+	schemaMetadata map[string]schemareader.Table
+	cache          map[string]string
+}
+
+func NewNaturalKeyResolver(db sqlUtil.Querier, schemaMetadata map[string]schemareader.Table) *NaturalKeyResolver {
+	return &NaturalKeyResolver{db: db, schemaMetadata: schemaMetadata, cache: make(map[string]string)}
+}
+
+func (resolver *NaturalKeyResolver) describeRow(ctx context.Context, table schemareader.Table, row []sqlUtil.RowDataStructure,
+	depth int) (map[string]string, error) {
+
+	described := make(map[string]string)
+	for _, column := range row {
+		described[column.ColumnName] = formatField(column)
+	}
+	if depth >= maxResolveDepth {
+		return described, nil
+	}
+	for _, reference := range table.References {
+		// composed foreign keys are kept as they are
+		if len(reference.ColumnMapping) != 1 {
+			continue
+		}
+		for localColumn, foreignColumn := range reference.ColumnMapping {
+			index, ok := table.ColumnIndexes[localColumn]
+			if !ok || index >= len(row) || row[index].Value == nil {
+				continue
+			}
+			description, err := resolver.resolveReference(ctx, reference.TableName, foreignColumn, row[index], depth+1)
+			if err != nil {
+				return nil, err
+			}
+			described[localColumn] = description
+		}
+	}
+	return described, nil
+}
+
+func (resolver *NaturalKeyResolver) resolveReference(ctx context.Context, tableName string, column string,
+	value sqlUtil.RowDataStructure, depth int) (string, error) {
+
+	rawValue := formatField(value)
+	cacheKey := fmt.Sprintf("%s.%s=%s", tableName, column, rawValue)
+	if cached, ok := resolver.cache[cacheKey]; ok {
+		return cached, nil
+	}
+	description := rawValue
+	if foreignTable, ok := resolver.schemaMetadata[tableName]; ok {
+		sql := fmt.Sprintf(`SELECT %s FROM %s WHERE %s = $1;`, strings.Join(foreignTable.Columns, ", "), tableName, column)
+		rows, err := sqlUtil.ExecuteQueryWithResults(ctx, resolver.db, sql, value.Value)
+		if err != nil {
+			return "", err
+		}
+		if len(rows) > 0 {
+			described, err := resolver.describeRow(ctx, foreignTable, rows[0], depth)
+			if err != nil {
+				return "", err
+			}
+			description = fmt.Sprintf("%s(%s)", tableName, resolver.rowKey(foreignTable, described))
+		}
+	}
+	resolver.cache[cacheKey] = description
+	return description, nil
+}
+
+func (resolver *NaturalKeyResolver) rowKey(table schemareader.Table, described map[string]string) string {
+	keyParts := make([]string, 0)
+	for _, column := range naturalKeyColumns(table) {
+		keyParts = append(keyParts, fmt.Sprintf("%s=%s", column, described[column]))
+	}
+	return strings.Join(keyParts, ", ")
+}
+
+// naturalKeyColumns returns the columns of the main unique index, the same used by formatOnConflict,
+// falling back to all the columns not generated by a sequence
+func naturalKeyColumns(table schemareader.Table) []string {
+	if index, ok := table.UniqueIndexes[table.MainUniqueIndexName]; ok && len(index.Columns) > 0 {
+		columns := append(make([]string, 0, len(index.Columns)), index.Columns...)
+		sort.Strings(columns)
+		return columns
+	}
+	columns := make([]string, 0)
+	for _, column := range table.Columns {
+		if !table.PKColumns[column] || len(table.PKSequence) == 0 {
+			columns = append(columns, column)
+		}
+	}
+	return columns
+}
@@ -0,0 +1,65 @@
+// SPDX-FileCopyrightText: 2023 SUSE LLC
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package dumper
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffTableSnapshots(t *testing.T) {
+
+	// Arrange
+	before := TableSnapshot{TableName: "rhnchannelpackage", Rows: map[string]map[string]string{
+		"package_id=a": {"package_id": "a", "modified": "'2024-01-01'"},
+		"package_id=b": {"package_id": "b", "modified": "'2024-01-01'"},
+		"package_id=c": {"package_id": "c", "modified": "'2024-01-01'"},
+	}}
+	after := TableSnapshot{TableName: "rhnchannelpackage", Rows: map[string]map[string]string{
+		"package_id=a": {"package_id": "a", "modified": "'2024-01-01'"},
+		"package_id=b": {"package_id": "b", "modified": "'2024-02-01'"},
+		"package_id=d": {"package_id": "d", "modified": "'2024-02-01'"},
+	}}
+
+	// Act
+	diff := DiffTableSnapshots(before, after)
+
+	// Assert
+	expected := TableDiff{
+		TableName: "rhnchannelpackage",
+		Inserted:  []string{"package_id=d"},
+		Updated: []RowChange{{Key: "package_id=b", Changes: []ColumnChange{
+			{Column: "modified", Before: "'2024-01-01'", After: "'2024-02-01'"}}}},
+		Deleted: []string{"package_id=c"},
+	}
+	if !reflect.DeepEqual(diff, expected) {
+		t.Errorf("TableDiff does not match: expected %+v, got %+v", expected, diff)
+	}
+	if DiffTableSnapshots(before, before).IsEmpty() == false {
+		t.Errorf("TableDiff of equal snapshots should be empty")
+	}
+}
+
+func TestSnapshotsDigest(t *testing.T) {
+	snapshot := TableSnapshot{TableName: "rhnerrata", Rows: map[string]map[string]string{
+		"advisory='SUSE-1'": {"advisory": "'SUSE-1'", "synopsis": "'one'", "modified": "'2024-01-01'"},
+		"advisory='SUSE-2'": {"advisory": "'SUSE-2'", "synopsis": "'two'", "modified": "'2024-01-02'"},
+	}}
+	changed := TableSnapshot{TableName: "rhnerrata", Rows: map[string]map[string]string{
+		"advisory='SUSE-1'": {"advisory": "'SUSE-1'", "synopsis": "'one'", "modified": "'2025-01-01'"},
+		"advisory='SUSE-2'": {"advisory": "'SUSE-2'", "synopsis": "'changed'", "modified": "'2025-01-02'"},
+	}}
+
+	if SnapshotsDigest([]TableSnapshot{snapshot}) != SnapshotsDigest([]TableSnapshot{snapshot.WithoutColumns()}) {
+		t.Errorf("digest of equal snapshots should be equal")
+	}
+	if SnapshotsDigest([]TableSnapshot{snapshot}) == SnapshotsDigest([]TableSnapshot{changed}) {
+		t.Errorf("digest of different snapshots should differ")
+	}
+	if SnapshotsDigest([]TableSnapshot{snapshot.WithoutColumns("modified", "synopsis")}) !=
+		SnapshotsDigest([]TableSnapshot{changed.WithoutColumns("modified", "synopsis")}) {
+		t.Errorf("digest should not consider removed columns")
+	}
+}
@@ -6,6 +6,7 @@ package dumper
 
 import (
 	"bufio"
+	"context"
 	"database/sql"
 	"github.com/uyuni-project/inter-server-sync/schemareader"
 	"github.com/uyuni-project/inter-server-sync/sqlUtil"
@@ -44,4 +45,4 @@ type PrintSqlOptions struct {
 	PostOrderCallback        Callback
 }
 
-type Callback func(db *sql.DB, writer *bufio.Writer, schemaMetadata map[string]schemareader.Table, table schemareader.Table, data DataDumper)
+type Callback func(ctx context.Context, db *sql.DB, writer *bufio.Writer, schemaMetadata map[string]schemareader.Table, table schemareader.Table, data DataDumper) error
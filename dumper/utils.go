@@ -5,6 +5,7 @@
 package dumper
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
@@ -12,7 +13,20 @@ import (
 	"strings"
 )
 
-func Copy(src, dst string) (int64, error) {
+// contextReader stops reading as soon as the context is cancelled
+type contextReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+func (r contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.reader.Read(p)
+}
+
+func Copy(ctx context.Context, src, dst string) (int64, error) {
 	sourceFileStat, err := os.Stat(src)
 	if err != nil {
 		return 0, err
@@ -33,7 +47,7 @@ func Copy(src, dst string) (int64, error) {
 		return 0, err
 	}
 	defer destination.Close()
-	nBytes, err := io.Copy(destination, source)
+	nBytes, err := io.Copy(destination, contextReader{ctx, source})
 	return nBytes, err
 }
 
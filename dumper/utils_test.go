@@ -6,6 +6,7 @@ package dumper
 
 import (
 	"bufio"
+	"context"
 	"database/sql"
 	"fmt"
 	"reflect"
@@ -45,7 +46,7 @@ func createMetaDataGraph(graph TablesGraph) (MetaDataGraph, DataDumper) {
 				PKColumns:           map[string]bool{"id": true},
 				ColumnIndexes:       map[string]int{"id": 0},
 				MainUniqueIndexName: indexName,
-				UniqueIndexes:       map[string]schemareader.UniqueIndex{indexName: {indexName, []string{"id"}}},
+				UniqueIndexes:       map[string]schemareader.UniqueIndex{indexName: {Name: indexName, Columns: []string{"id"}}},
 				References:          []schemareader.Reference{},
 				ReferencedBy:        []schemareader.Reference{},
 			}
@@ -146,6 +147,7 @@ func reverse(s interface{}) {
 }
 
 func createCallback() Callback {
-	return func(db *sql.DB, writer *bufio.Writer, schemaMetadata map[string]schemareader.Table, table schemareader.Table, data DataDumper) {
+	return func(ctx context.Context, db *sql.DB, writer *bufio.Writer, schemaMetadata map[string]schemareader.Table, table schemareader.Table, data DataDumper) error {
+		return nil
 	}
 }
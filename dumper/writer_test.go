@@ -5,11 +5,18 @@
 package dumper
 
 import (
+	"bufio"
+	"compress/gzip"
+	"context"
 	"fmt"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
 
+	"github.com/DATA-DOG/go-sqlmock"
+
 	"github.com/uyuni-project/inter-server-sync/schemareader"
 	"github.com/uyuni-project/inter-server-sync/sqlUtil"
 	"github.com/uyuni-project/inter-server-sync/tests"
@@ -59,7 +66,8 @@ func TestPrintAllTableData(t *testing.T) {
 	testCase.repo.Expect("SELECT id, v03_fk_id FROM v02 WHERE id = $1;", testCase.schemaMetadata["v02"].Columns, 1)
 
 	// 02 Act
-	result := processTableDataWithLinks(
+	result, err := processTableDataWithLinks(
+		WithReferenceCache(context.Background()),
 		testCase.repo.DB,
 		testCase.repo.Writer,
 		testCase.schemaMetadata,
@@ -71,6 +79,9 @@ func TestPrintAllTableData(t *testing.T) {
 	)
 
 	// 03 Assert
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
 	if result == nil {
 		t.Errorf("processedTables is nil")
 	}
@@ -214,7 +225,8 @@ func TestPrintCleanTables(t *testing.T) {
 	}
 
 	// 02 Act
-	printCleanTables(
+	err := printCleanTables(
+		WithReferenceCache(context.Background()),
 		testCase.repo.DB,
 		testCase.repo.Writer,
 		testCase.schemaMetadata,
@@ -226,6 +238,9 @@ func TestPrintCleanTables(t *testing.T) {
 	writtenBuffer := testCase.repo.GetWriterBuffer()
 
 	// 03 Assert
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
 	if testCase.processedTables == nil {
 		t.Errorf("processedTables is nil")
 	}
@@ -281,7 +296,8 @@ func TestPrintTableData(t *testing.T) {
 
 	// 02 Act
 	orderedTables := getTablesExportOrder(testCase.schemaMetadata, testCase.startingTable, testCase.processedTables, testCase.path)
-	exportTablesData(
+	err := exportTablesData(
+		WithReferenceCache(context.Background()),
 		testCase.repo.DB,
 		testCase.repo.Writer,
 		testCase.schemaMetadata,
@@ -291,6 +307,9 @@ func TestPrintTableData(t *testing.T) {
 	)
 
 	// 03 Assert
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
 	if testCase.processedTables == nil {
 		t.Errorf("processedTables is nil")
 	}
@@ -425,3 +444,86 @@ func createTestCase(graph TablesGraph, root string, options PrintSqlOptions) wri
 		options,
 	}
 }
+
+func TestExportedStatementsExecution(t *testing.T) {
+	// Arrange: export rows with values looking like statement ends, comments and dollar quotes
+	indexName := "rhn_pkg_cld_nt_idx"
+	table := schemareader.Table{
+		Name:                "rhnpackagechangelogdata",
+		Export:              true,
+		Columns:             []string{"id", "name", "text"},
+		PKColumns:           map[string]bool{"id": true},
+		PKSequence:          "rhn_pkg_cld_id_seq",
+		ColumnIndexes:       map[string]int{"id": 0, "name": 1, "text": 2},
+		MainUniqueIndexName: indexName,
+		UniqueIndexes:       map[string]schemareader.UniqueIndex{indexName: {Name: indexName, Columns: []string{"name", "text"}}},
+	}
+	schemaMetadata := map[string]schemareader.Table{table.Name: table}
+	repo := tests.CreateDataRepository()
+	repo.ExpectWithRecords("SELECT id, name, text FROM rhnpackagechangelogdata ;",
+		sqlmock.NewRows(table.Columns).
+			AddRow("1", "O'Brien; -- maintainer", "- fixed 'quotes';\n-- it's not a comment\n/* nor; this */").
+			AddRow("2", "build $$ user", "C:\\path\\ ; $body$ it's $body$"))
+
+	sqlFile := filepath.Join(t.TempDir(), "sql_statements.sql.gz")
+	file, err := os.Create(sqlFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gzipWriter := gzip.NewWriter(file)
+	writer := bufio.NewWriter(gzipWriter)
+	writer.WriteString("BEGIN;\n")
+	if err := DumpAllTablesData(context.Background(), repo.DB, writer, schemaMetadata, []schemareader.Table{table},
+		func(table schemareader.Table) string { return "" }, []string{}); err != nil {
+		t.Fatal(err)
+	}
+	writer.WriteString("COMMIT;\n")
+	if err := writer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	gzipWriter.Close()
+	file.Close()
+
+	expected := []string{
+		"INSERT INTO rhnpackagechangelogdata (id, name, text)\tVALUES ((SELECT nextval('rhn_pkg_cld_id_seq')),'O''Brien; -- maintainer'," +
+			"'- fixed ''quotes'';\n-- it''s not a comment\n/* nor; this */') " +
+			"ON CONFLICT (name, text) DO UPDATE SET name = excluded.name,text = excluded.text;",
+		"INSERT INTO rhnpackagechangelogdata (id, name, text)\tVALUES ((SELECT nextval('rhn_pkg_cld_id_seq')),'build $$ user'," +
+			" E'C:\\\\path\\\\ ; $body$ it''s $body$') " +
+			"ON CONFLICT (name, text) DO UPDATE SET name = excluded.name,text = excluded.text;",
+	}
+	repo.ExpectBegin()
+	for _, statement := range expected {
+		repo.ExpectExec(statement, 1)
+	}
+
+	// Act
+	sqlStatements, err := os.Open(sqlFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqlStatements.Close()
+	gzipReader, err := gzip.NewReader(sqlStatements)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, err := repo.DB.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	executed := make([]string, 0)
+	_, err = sqlUtil.ExecuteStatements(context.Background(), tx, gzipReader, func(statement string, rowsAffected int64) {
+		executed = append(executed, statement)
+	})
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+	if !reflect.DeepEqual(executed, expected) {
+		t.Errorf("expected %q, got %q", expected, executed)
+	}
+}
@@ -0,0 +1,104 @@
+// SPDX-FileCopyrightText: 2023 SUSE LLC
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package entityDumper
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+	"github.com/rs/zerolog/log"
+	"github.com/uyuni-project/inter-server-sync/dumper"
+	"github.com/uyuni-project/inter-server-sync/schemareader"
+)
+
+// compareTableNames are the tables crawled to compare channels between servers.
+// Only packages, errata and CVE links are compared.
+var compareTableNames = []string{"rhnchannel", "rhnchannelpackage", "rhnpackage",
+	"rhnchannelerrata", "rhnerrata", "rhnerratapackage", "rhnerratacve", "rhncve"}
+
+var comparedTableNames = []string{"rhnpackage", "rhnerrata", "rhnerratacve"}
+
+// timestamps are set on insert by each server and differ even if the content is in sync
+var compareIgnoredColumns = []string{"created", "modified", "last_modified"}
+
+type ChannelComparison struct {
+	ChannelLabel string
+	SourceDigest string
+	TargetDigest string
+	Tables       []dumper.TableDiff
+}
+
+func (comparison ChannelComparison) InSync() bool {
+	return comparison.SourceDigest == comparison.TargetDigest
+}
+
+// CompareChannels crawls each channel in both databases and compares the content by natural key.
+// Rows only found in the source are reported as inserted, rows only found in the target as deleted.
+func CompareChannels(ctx context.Context, sourceDB *sql.DB, targetDB *sql.DB, channelLabels []string) ([]ChannelComparison, error) {
+	sourceSchema, err := schemareader.ReadTablesSchema(sourceDB, compareTableNames)
+	if err != nil {
+		return nil, fmt.Errorf("error reading source schema: %w", err)
+	}
+	targetSchema, err := schemareader.ReadTablesSchema(targetDB, compareTableNames)
+	if err != nil {
+		return nil, fmt.Errorf("error reading target schema: %w", err)
+	}
+	sourceResolver := dumper.NewNaturalKeyResolver(sourceDB, sourceSchema)
+	targetResolver := dumper.NewNaturalKeyResolver(targetDB, targetSchema)
+
+	result := make([]ChannelComparison, 0, len(channelLabels))
+	count := 0
+	for _, channelLabel := range channelLabels {
+		count++
+		log.Info().Msg(fmt.Sprintf("Comparing channel [%d/%d] %s", count, len(channelLabels), channelLabel))
+		sourceSnapshots, err := crawlChannelSnapshots(ctx, sourceDB, sourceSchema, channelLabel, sourceResolver)
+		if err != nil {
+			return nil, fmt.Errorf("error reading channel %s from source: %w", channelLabel, err)
+		}
+		targetSnapshots, err := crawlChannelSnapshots(ctx, targetDB, targetSchema, channelLabel, targetResolver)
+		if err != nil {
+			return nil, fmt.Errorf("error reading channel %s from target: %w", channelLabel, err)
+		}
+
+		comparison := ChannelComparison{
+			ChannelLabel: channelLabel,
+			SourceDigest: dumper.SnapshotsDigest(sourceSnapshots),
+			TargetDigest: dumper.SnapshotsDigest(targetSnapshots),
+			Tables:       make([]dumper.TableDiff, 0),
+		}
+		if !comparison.InSync() {
+			for i := range sourceSnapshots {
+				tableDiff := dumper.DiffTableSnapshots(targetSnapshots[i], sourceSnapshots[i])
+				if !tableDiff.IsEmpty() {
+					comparison.Tables = append(comparison.Tables, tableDiff)
+				}
+			}
+		}
+		result = append(result, comparison)
+	}
+	return result, nil
+}
+
+func crawlChannelSnapshots(ctx context.Context, db *sql.DB, schemaMetadata map[string]schemareader.Table, channelLabel string,
+	resolver *dumper.NaturalKeyResolver) ([]dumper.TableSnapshot, error) {
+
+	whereFilter := fmt.Sprintf("label = %s", pq.QuoteLiteral(channelLabel))
+	tableData, err := dumper.DataCrawler(ctx, db, schemaMetadata, schemaMetadata["rhnchannel"], whereFilter, "")
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := make([]dumper.TableSnapshot, 0, len(comparedTableNames))
+	for _, tableName := range comparedTableNames {
+		snapshot, err := dumper.ReadCrawledSnapshot(ctx, db, schemaMetadata[tableName], tableData, resolver)
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, snapshot.WithoutColumns(compareIgnoredColumns...))
+	}
+	return snapshots, nil
+}
@@ -6,15 +6,17 @@ package entityDumper
 
 import (
 	"bufio"
+	"context"
 	"database/sql"
 	"fmt"
-	"io"
 	"os"
 	"strings"
 
+	"github.com/lib/pq"
 	"github.com/rs/zerolog/log"
 	"github.com/uyuni-project/inter-server-sync/dumper"
 	"github.com/uyuni-project/inter-server-sync/dumper/packageDumper"
+	"github.com/uyuni-project/inter-server-sync/progress"
 	"github.com/uyuni-project/inter-server-sync/schemareader"
 	"github.com/uyuni-project/inter-server-sync/sqlUtil"
 	"github.com/uyuni-project/inter-server-sync/utils"
@@ -30,6 +32,16 @@ var tablesToClean = []string{"rhnreleasechannelmap", "rhndistchannelmap", "rhnch
 	"susemddata", "suseproductchannel", "rhnchannelcloned",
 	"rhnpackageextratag"}
 
+// errataTablesToClean are the tables cleaned by an errata only export, which leaves the channel packages untouched
+var errataTablesToClean = []string{"rhnchannelerrata", "rhnerratapackage", "rhnerratabuglist", "rhnerratacve",
+	"rhnerratakeyword"}
+
+// errataPackageTables are only read by an errata only export, to resolve the packages of rhnerratapackage
+var errataPackageTables = []string{"rhnpackage", "rhnpackagename", "rhnpackageevr", "rhnchecksum"}
+
+// asOfTables are the channel links left out of an export when created after its point in time
+var asOfTables = []string{"rhnchannelpackage", "rhnchannelerrata"}
+
 // onlyIfParentExistsTables represents Tables for which only records needs to be insterted only if parent record exists
 var onlyIfParentExistsTables = []string{"rhnchannelcloned", "rhnerratacloned", "suseproductchannel"}
 
@@ -90,6 +102,60 @@ func SoftwareChannelTableNames() []string {
 	}
 }
 
+// ErrataTableNames is the list of names of tables relevant for exporting only the errata of software channels
+func ErrataTableNames() []string {
+	return append([]string{
+		"rhnchannel",
+		"rhnchannelerrata", // clean
+		"rhnerrata",
+		"rhnerratacloned", // add only if there are corresponding rows in rhnerrata
+		"rhnerratacve",    // clean
+		"rhncve",
+		"rhnerratabuglist", // clean
+		"rhnerratakeyword", // clean
+		"rhnerratapackage", // clean, add only if the package exists
+	}, errataPackageTables...)
+}
+
+// excludableTables are the software channel tables which can be left out of an export, mapped to the tables referencing
+// them, to be left out as well
+var excludableTables = map[string][]string{
+	"rhnpackagechangelogdata":  {"rhnpackagechangelogrec"},
+	"rhnpackagechangelogrec":   nil,
+	"rhnpackagefile":           nil,
+	"rhnpackageextratag":       nil,
+	"rhnpackageextratagkey":    {"rhnpackageextratag"},
+	"rhnpackagekeyassociation": nil,
+	"rhnpackagekey":            {"rhnpackagekeyassociation"},
+	"rhnpackagecapability": {"rhnpackagefile", "rhnpackagebreaks", "rhnpackageconflicts", "rhnpackageenhances",
+		"rhnpackageobsoletes", "rhnpackagepredepends", "rhnpackageprovides", "rhnpackagerecommends", "rhnpackagerequires",
+		"rhnpackagesuggests", "rhnpackagesupplements"},
+	"rhnpackagebreaks":      nil,
+	"rhnpackageconflicts":   nil,
+	"rhnpackageenhances":    nil,
+	"rhnpackageobsoletes":   nil,
+	"rhnpackagepredepends":  nil,
+	"rhnpackageprovides":    nil,
+	"rhnpackagerecommends":  nil,
+	"rhnpackagerequires":    nil,
+	"rhnpackagesuggests":    nil,
+	"rhnpackagesupplements": nil,
+}
+
+// slimTableNames are left out of slim exports: package changelogs and file lists
+var slimTableNames = []string{"rhnpackagechangelogdata", "rhnpackagechangelogrec", "rhnpackagefile"}
+
+// withoutTables returns tableNames except the excluded ones
+func withoutTables(tableNames []string, excluded []string) []string {
+	result := make([]string, 0, len(tableNames))
+	for _, tableName := range tableNames {
+		if !utils.Contains(excluded, tableName) {
+			result = append(result, tableName)
+		}
+	}
+	return result
+}
+
 func ProductsTableNames() []string {
 	return []string{
 		// product data tables
@@ -104,69 +170,25 @@ func ProductsTableNames() []string {
 	}
 }
 
-func validateExportFolder(outputFolderAbs string) {
-	err := utils.FolderExists(outputFolderAbs)
-	if err != nil {
-		if os.IsNotExist(err) {
-			err := os.MkdirAll(outputFolderAbs, 0755)
-			if err != nil {
-				log.Fatal().Err(err).Msg("Error creating directory")
-			}
-		} else {
-			log.Fatal().Err(err).Msg("Error getting output folder")
+// addAsOfFilter exports the channel links as they were at asOf. The links created later are still cleaned, so the
+// target server gets the channel content of that time.
+func addAsOfFilter(schemaMetadata map[string]schemareader.Table, asOf string) {
+	for _, tableName := range asOfTables {
+		table, ok := schemaMetadata[tableName]
+		if !ok {
+			continue
 		}
-	}
-	outputFolder, _ := os.Open(outputFolderAbs)
-	defer outputFolder.Close()
-	_, errEmpty := outputFolder.Readdirnames(1) // Or f.Readdir(1)
-	if errEmpty != io.EOF {
-		log.Fatal().Msg(fmt.Sprintf("export location is not empty: %s", outputFolderAbs))
+		table.AddCrawlFilter(fmt.Sprintf("%s.created <= %s::timestamp", tableName, pq.QuoteLiteral(asOf)))
+		schemaMetadata[tableName] = table
 	}
 }
 
-var childChannelSql = "select label from rhnchannel " +
-	"where parent_channel = (select id from rhnchannel where label = $1)"
-
-var singleChannelSql = "select label from rhnchannel " +
-	"where label = $1"
-
-func loadChannelsToProcess(db *sql.DB, options DumperOptions) []string {
-	log.Trace().Msg("Loading channel list")
-	channels := channelsProcess{make(map[string]bool), make([]string, 0)}
-	for _, singleChannel := range options.ChannelLabels {
-		if _, ok := channels.channelsMap[singleChannel]; !ok {
-			dbChannel := sqlUtil.ExecuteQueryWithResults(db, singleChannelSql, singleChannel)
-			if len(dbChannel) == 0 {
-				log.Fatal().Msgf("Channel not found: %s", singleChannel)
-			}
-			channels.addChannelLabel(singleChannel)
-		}
-	}
-
-	for _, channelChildren := range options.ChannelWithChildrenLabels {
-		if _, ok := channels.channelsMap[channelChildren]; !ok {
-			dbChannel := sqlUtil.ExecuteQueryWithResults(db, singleChannelSql, channelChildren)
-			if len(dbChannel) == 0 {
-				log.Fatal().Msgf("Channel not found: %s", channelChildren)
-			}
-			channels.addChannelLabel(channelChildren)
-			childrenChannels := sqlUtil.ExecuteQueryWithResults(db, childChannelSql, channelChildren)
-			for _, cChannel := range childrenChannels {
-				cLabel := fmt.Sprintf("%v", cChannel[0].Value)
-				if _, okC := channels.channelsMap[cLabel]; !okC {
-					channels.addChannelLabel(cLabel)
-				}
-			}
-
-		}
-	}
-	log.Debug().Msgf("Channels to export: %s", strings.Join(channels.channels, ","))
-	return channels.channels
-}
-
-func processAndInsertProducts(db *sql.DB, writer *bufio.Writer) {
+func processAndInsertProducts(ctx context.Context, db *sql.DB, writer *bufio.Writer) error {
 	log.Trace().Msg("Processing product tables")
-	schemaMetadata := schemareader.ReadTablesSchema(db, ProductsTableNames())
+	schemaMetadata, err := schemareader.ReadTablesSchema(db, ProductsTableNames())
+	if err != nil {
+		return err
+	}
 	startingTables := []schemareader.Table{schemaMetadata["suseproducts"]}
 
 	var whereFilterClause = func(table schemareader.Table) string {
@@ -177,43 +199,91 @@ func processAndInsertProducts(db *sql.DB, writer *bufio.Writer) {
 		return filterOrg
 	}
 
-	dumper.DumpAllTablesData(db, writer, schemaMetadata, startingTables, whereFilterClause, onlyIfParentExistsTables)
+	err = dumper.DumpAllTablesData(ctx, db, writer, schemaMetadata, startingTables, whereFilterClause, onlyIfParentExistsTables)
+	if err != nil {
+		return err
+	}
 	writer.WriteString("-- end of product tables")
 	writer.WriteString("\n")
 	log.Debug().Msg("products export done")
+	return nil
 }
 
-func processAndInsertChannels(db *sql.DB, writer *bufio.Writer, options DumperOptions) {
+func processAndInsertChannels(ctx context.Context, db *sql.DB, writer *bufio.Writer, options DumperOptions) ([]string, []string, error) {
 
-	channels := loadChannelsToProcess(db, options)
+	channels, droppedRelations, err := loadChannelsToProcess(ctx, db, options)
+	if err != nil {
+		return nil, nil, err
+	}
 	log.Info().Msg(fmt.Sprintf("%d channels to process", len(channels)))
 
-	schemaMetadata := schemareader.ReadTablesSchema(db, SoftwareChannelTableNames())
+	tableNames := SoftwareChannelTableNames()
+	if options.ErrataOnly {
+		tableNames = ErrataTableNames()
+	}
+	// the excluded tables are neither exported nor cleaned, the target keeps its data
+	tableNames = withoutTables(tableNames, options.excludedTables())
+	schemaMetadata, err := schemareader.ReadTablesSchema(db, tableNames)
+	if err != nil {
+		return nil, droppedRelations, err
+	}
+	if options.ErrataOnly {
+		// packages are expected on the target server already
+		markAsExported(schemaMetadata, errataPackageTables)
+	}
+	if len(options.PackageArchs) > 0 {
+		addPackageFilter(schemaMetadata, packageArchsQuery(options.PackageArchs))
+	}
+	if options.hasErrataFilter() {
+		addErrataFilter(schemaMetadata, options)
+	}
+	if options.AsOf != "" {
+		addAsOfFilter(schemaMetadata, options.AsOf)
+	}
 	log.Debug().Msg("channel schema metadata loaded")
 
-	fileChannels, err := os.Create(options.GetOutputFolderAbsPath() + "/exportedChannels.txt")
+	outputFolderAbs, err := options.GetOutputFolderAbsPath()
+	if err != nil {
+		return nil, droppedRelations, err
+	}
+	fileChannels, err := os.Create(outputFolderAbs + "/exportedChannels.txt")
 	if err != nil {
-		log.Panic().Err(err).Msg("error creating sql file")
+		return nil, droppedRelations, fmt.Errorf("error creating exported channels file: %w", err)
 	}
 
 	defer fileChannels.Close()
 	bufferWriterChannels := bufio.NewWriter(fileChannels)
 	defer bufferWriterChannels.Flush()
 
+	// package files shared by several channels are exported once
+	copiedFiles := make(map[string]bool)
 	count := 0
 	for _, channelLabel := range channels {
 		count++
 		log.Info().Msg(fmt.Sprintf("Processing channel [%d/%d] %s", count, len(channels), channelLabel))
-		processChannel(db, writer, channelLabel, schemaMetadata, options)
+		progress.Report(ctx, progress.Event{Event: progress.ChannelStarted, Phase: "channels", Channel: channelLabel,
+			Current: count, Total: len(channels)})
+		if err := processChannel(ctx, db, writer, channelLabel, schemaMetadata, options, copiedFiles); err != nil {
+			return nil, droppedRelations, fmt.Errorf("error exporting channel %s: %w", channelLabel, err)
+		}
 		writer.Flush()
 		bufferWriterChannels.WriteString(fmt.Sprintf("%s\n", channelLabel))
 	}
+	return channels, droppedRelations, nil
 }
 
-func processChannel(db *sql.DB, writer *bufio.Writer, channelLabel string,
-	schemaMetadata map[string]schemareader.Table, options DumperOptions) {
+func processChannel(ctx context.Context, db *sql.DB, writer *bufio.Writer, channelLabel string,
+	schemaMetadata map[string]schemareader.Table, options DumperOptions, copiedFiles map[string]bool) error {
+	if options.LatestPackageVersions > 0 {
+		// the latest versions are computed for each channel
+		schemaMetadata = copySchema(schemaMetadata)
+		addPackageFilter(schemaMetadata, latestPackagesQuery(channelLabel, options.LatestPackageVersions))
+	}
 	whereFilter := fmt.Sprintf("label = '%s'", channelLabel)
-	tableData := dumper.DataCrawler(db, schemaMetadata, schemaMetadata["rhnchannel"], whereFilter, options.StartingDate)
+	tableData, err := dumper.DataCrawler(ctx, db, schemaMetadata, schemaMetadata["rhnchannel"], whereFilter, options.StartingDate)
+	if err != nil {
+		return err
+	}
 
 	if log.Debug().Enabled() {
 		totalRows := 0
@@ -223,30 +293,38 @@ func processChannel(db *sql.DB, writer *bufio.Writer, channelLabel string,
 		log.Debug().Msgf("finished table data crawler. Total database rows to export: %d", totalRows)
 	}
 
-	cleanWhereClause := fmt.Sprintf(`WHERE rhnchannel.id = (SELECT id FROM rhnchannel WHERE label = '%s')`, channelLabel)
-	printOptions := dumper.PrintSqlOptions{
-		TablesToClean:            tablesToClean,
-		CleanWhereClause:         cleanWhereClause,
-		OnlyIfParentExistsTables: onlyIfParentExistsTables}
-
-	dumper.PrintTableDataOrdered(db, writer, schemaMetadata, schemaMetadata["rhnchannel"],
-		tableData, printOptions)
+	err = dumper.PrintTableDataOrdered(ctx, db, writer, schemaMetadata, schemaMetadata["rhnchannel"],
+		tableData, channelPrintOptions(channelLabel, options))
+	if err != nil {
+		return err
+	}
 	log.Debug().Msg("finished print table order")
 
-	generateChannelChildLink(db, channelLabel, writer)
+	if err := generateChannelChildLink(ctx, db, channelLabel, writer); err != nil {
+		return err
+	}
 
 	generateCacheCalculation(channelLabel, writer)
 
-	if !options.MetadataOnly {
+	if !options.MetadataOnly && !options.ErrataOnly {
 		log.Debug().Msg("dumping all package files")
-		packageDumper.DumpPackageFiles(db, schemaMetadata, tableData, options.GetOutputFolderAbsPath())
+		outputFolderAbs, err := options.GetOutputFolderAbsPath()
+		if err != nil {
+			return err
+		}
+		if err := packageDumper.DumpPackageFiles(ctx, db, schemaMetadata, tableData, outputFolderAbs, copiedFiles, options.LinkMode); err != nil {
+			return err
+		}
 	}
 	log.Debug().Msg("channel export finished")
-
+	return nil
 }
 
-func generateChannelChildLink(db *sql.DB, channelLabel string, writer *bufio.Writer) {
-	childrenChannels := sqlUtil.ExecuteQueryWithResults(db, childChannelSql, channelLabel)
+func generateChannelChildLink(ctx context.Context, db *sql.DB, channelLabel string, writer *bufio.Writer) error {
+	childrenChannels, err := sqlUtil.ExecuteQueryWithResults(ctx, db, childChannelSql, channelLabel)
+	if err != nil {
+		return err
+	}
 	childChannelChildLabels := make([]string, 0)
 	for _, cChannel := range childrenChannels {
 		cLabel := fmt.Sprintf("'%v'", cChannel[0].Value)
@@ -259,6 +337,26 @@ func generateChannelChildLink(db *sql.DB, channelLabel string, writer *bufio.Wri
 		updateChildChannels := fmt.Sprintf("update rhnchannel set parent_channel = (select id from rhnchannel where label = '%s') where label in (%s);", channelLabel, strings.Join(childChannelChildLabels, ","))
 		writer.WriteString(updateChildChannels + "\n")
 	}
+	return nil
+}
+
+// channelPrintOptions returns the options printing the statements of the channel, cleaning its tables on the target
+func channelPrintOptions(channelLabel string, options DumperOptions) dumper.PrintSqlOptions {
+	cleanWhereClause := fmt.Sprintf(`WHERE rhnchannel.id = (SELECT id FROM rhnchannel WHERE label = '%s')`, channelLabel)
+	printOptions := dumper.PrintSqlOptions{
+		TablesToClean:            tablesToClean,
+		CleanWhereClause:         cleanWhereClause,
+		OnlyIfParentExistsTables: onlyIfParentExistsTables}
+	if options.ErrataOnly {
+		printOptions.TablesToClean = errataTablesToClean
+		printOptions.OnlyIfParentExistsTables = append([]string{"rhnerratapackage"}, onlyIfParentExistsTables...)
+	}
+	if options.LatestPackageVersions > 0 {
+		// the package links are filtered by the latest versions, which the clean statements would compute on the
+		// target server: when it has other versions, its older packages would lose their channel and errata links
+		printOptions.TablesToClean = withoutPackageLinksClean(printOptions.TablesToClean)
+	}
+	return printOptions
 }
 
 func generateCacheCalculation(channelLabel string, writer *bufio.Writer) {
@@ -0,0 +1,151 @@
+// SPDX-FileCopyrightText: 2023 SUSE LLC
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package entityDumper
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/uyuni-project/inter-server-sync/schemareader"
+	"github.com/uyuni-project/inter-server-sync/utils"
+)
+
+func TestErrataOnlyTables(t *testing.T) {
+	tableNames := ErrataTableNames()
+	for _, table := range []string{"rhnchannelerrata", "rhnerrata", "rhnerratacve", "rhncve", "rhnerratabuglist",
+		"rhnerratakeyword", "rhnerratapackage"} {
+		if !utils.Contains(tableNames, table) {
+			t.Errorf("%s expected in the errata tables", table)
+		}
+	}
+	for _, table := range []string{"rhnchannelpackage", "rhnpackagefile", "rhnpackagechangelogrec", "rhnpackagechangelogdata"} {
+		if utils.Contains(tableNames, table) {
+			t.Errorf("%s not expected in the errata tables", table)
+		}
+		if utils.Contains(errataTablesToClean, table) {
+			t.Errorf("%s not expected in the errata tables to clean", table)
+		}
+	}
+}
+
+func TestValidateErrataOnlyWithoutChannels(t *testing.T) {
+	err := ValidateOptions(context.Background(), DumperOptions{ErrataOnly: true, ConfigLabels: []string{"salt-states"}})
+	if !errors.Is(err, ErrInvalidOptions) {
+		t.Errorf("expected an invalid options error, got %v", err)
+	}
+}
+
+func TestAddPackageFilter(t *testing.T) {
+	schemaMetadata := map[string]schemareader.Table{
+		"rhnchannelpackage": {Name: "rhnchannelpackage", RowFilter: "rhnchannelpackage.modified > now()"},
+		"rhnerratapackage":  {Name: "rhnerratapackage"},
+	}
+	addPackageFilter(schemaMetadata, packageArchsQuery([]string{"x86_64", "noarch"}))
+
+	archs := "SELECT p.id FROM rhnpackage p JOIN rhnpackagearch a ON a.id = p.package_arch_id WHERE a.label IN ('x86_64', 'noarch')"
+	expected := map[string]string{
+		"rhnchannelpackage": "rhnchannelpackage.modified > now() AND rhnchannelpackage.package_id IN (" + archs + ")",
+		"rhnerratapackage":  "rhnerratapackage.package_id IN (" + archs + ")",
+	}
+	for tableName, filter := range expected {
+		if schemaMetadata[tableName].RowFilter != filter {
+			t.Errorf("unexpected filter of %s: %s", tableName, schemaMetadata[tableName].RowFilter)
+		}
+	}
+	if _, ok := schemaMetadata["rhnpackage"]; ok {
+		t.Errorf("filter added to a table missing from the schema")
+	}
+}
+
+// TestLatestPackageVersionsClean covers a peripheral having more versions of the packages than the hub exports:
+// none of the package links filtered by the latest versions may be cleaned, the filter would run on the peripheral
+// and remove the links of its older packages
+func TestLatestPackageVersionsClean(t *testing.T) {
+	schemaMetadata := make(map[string]schemareader.Table)
+	for _, tableName := range SoftwareChannelTableNames() {
+		schemaMetadata[tableName] = schemareader.Table{Name: tableName}
+	}
+	addPackageFilter(schemaMetadata, latestPackagesQuery("base", 1))
+
+	printOptions := channelPrintOptions("base", DumperOptions{LatestPackageVersions: 1})
+
+	for tableName, table := range schemaMetadata {
+		if table.RowFilter != "" && utils.Contains(printOptions.TablesToClean, tableName) {
+			t.Errorf("%s is filtered by the latest versions and should not be cleaned", tableName)
+		}
+	}
+	for _, tableName := range []string{"rhnchannelpackage", "rhnerratapackage", "rhnerratafilepackage"} {
+		if utils.Contains(printOptions.TablesToClean, tableName) {
+			t.Errorf("%s not expected in the tables to clean", tableName)
+		}
+	}
+	if !utils.Contains(printOptions.TablesToClean, "rhnchannelerrata") {
+		t.Errorf("rhnchannelerrata expected in the tables to clean")
+	}
+	if !utils.Contains(channelPrintOptions("base", DumperOptions{}).TablesToClean, "rhnerratapackage") {
+		t.Errorf("rhnerratapackage expected in the tables to clean of a full export")
+	}
+}
+
+func TestErrataQuery(t *testing.T) {
+	options := DumperOptions{ErrataTypes: []string{"Security Advisory"}, ErrataSeverities: []string{"critical", "important"},
+		ErrataIssuedAfter: "2023-01-01"}
+	expected := "SELECT e.id FROM rhnerrata e WHERE e.advisory_type IN ('Security Advisory') AND " +
+		"e.severity_id IN (SELECT id FROM rhnerrataseverity WHERE label IN ('errata.sev.label.critical', 'errata.sev.label.important')) AND " +
+		"e.issue_date >= '2023-01-01'::timestamp"
+	if query := errataQuery(options); query != expected {
+		t.Errorf("unexpected errata query %s", query)
+	}
+}
+
+func TestValidateErrataFilters(t *testing.T) {
+	for _, options := range []DumperOptions{
+		{ErrataTypes: []string{"Security"}},
+		{ErrataSeverities: []string{"urgent"}},
+		{ErrataIssuedAfter: "01/01/2023"},
+	} {
+		if err := ValidateOptions(context.Background(), options); !errors.Is(err, ErrInvalidOptions) {
+			t.Errorf("expected an invalid options error for %+v, got %v", options, err)
+		}
+	}
+}
+
+func TestAddAsOfFilter(t *testing.T) {
+	schemaMetadata := map[string]schemareader.Table{
+		"rhnchannelpackage": {Name: "rhnchannelpackage"},
+		"rhnchannelerrata":  {Name: "rhnchannelerrata"},
+	}
+	addAsOfFilter(schemaMetadata, "2023-09-30 23:59:59")
+	for tableName, table := range schemaMetadata {
+		if table.RowFilter != "" {
+			t.Errorf("the links of %s created later must still be cleaned", tableName)
+		}
+		if expected := tableName + ".created <= '2023-09-30 23:59:59'::timestamp"; table.CrawlFilter != expected {
+			t.Errorf("unexpected crawl filter of %s: %s", tableName, table.CrawlFilter)
+		}
+	}
+}
+
+func TestValidateExcludedTables(t *testing.T) {
+	cases := map[string]DumperOptions{
+		"core table":           {ExcludedTables: []string{"rhnpackage"}},
+		"referenced table":     {ExcludedTables: []string{"rhnpackagechangelogdata"}},
+		"capabilities in slim": {Slim: true, ExcludedTables: []string{"rhnpackagecapability"}},
+	}
+	for name, options := range cases {
+		err := ValidateOptions(context.Background(), options)
+		if !errors.Is(err, ErrInvalidOptions) {
+			t.Errorf("%s: expected an invalid options error, got %v", name, err)
+		}
+	}
+	options := DumperOptions{Slim: true, ExcludedTables: []string{"rhnpackageextratag"}}
+	tableNames := withoutTables(SoftwareChannelTableNames(), options.excludedTables())
+	for _, table := range []string{"rhnpackagechangelogdata", "rhnpackagechangelogrec", "rhnpackagefile", "rhnpackageextratag"} {
+		if utils.Contains(tableNames, table) {
+			t.Errorf("%s expected to be excluded", table)
+		}
+	}
+}
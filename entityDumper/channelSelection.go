@@ -0,0 +1,355 @@
+// SPDX-FileCopyrightText: 2023 SUSE LLC
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package entityDumper
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"github.com/uyuni-project/inter-server-sync/progress"
+	"github.com/uyuni-project/inter-server-sync/schemareader"
+	"github.com/uyuni-project/inter-server-sync/sqlUtil"
+)
+
+var childChannelSql = "select label from rhnchannel " +
+	"where parent_channel = (select id from rhnchannel where label = $1)"
+
+var singleChannelSql = "select label from rhnchannel " +
+	"where label = $1"
+
+var allChannelsSql = "select label from rhnchannel order by label"
+
+// base channels are listed before their children
+var productChannelsSql = `select c.label from suseproducts p
+	join suseproductchannel pc on pc.product_id = p.id
+	join rhnchannel c on c.id = pc.channel_id
+	left join rhnpackagearch a on a.id = p.arch_type_id
+	where lower(p.name) = lower($1) and p.version = $2 and ($3 = '' or a.label = $3)
+	order by c.parent_channel is not null, c.label`
+
+var channelFamilyChannelsSql = `select c.label from rhnchannelfamily f
+	join rhnchannelfamilymembers m on m.channel_family_id = f.id
+	join rhnchannel c on c.id = m.channel_id
+	where f.label = $1
+	order by c.parent_channel is not null, c.label`
+
+var clmEnvironmentChannelsSql = `select c.label from susecontentproject p
+	join susecontentenvironment e on e.project_id = p.id
+	join susecontentenvironmenttarget t on t.env_id = e.id
+	join susesoftwareenvironmenttarget st on st.id = t.id
+	join rhnchannel c on c.id = st.channel_id
+	where p.label = $1 and e.label = $2
+	order by c.parent_channel is not null, c.label`
+
+var customChannelsSql = `select label from rhnchannel where org_id = $1
+	order by parent_channel is not null, label`
+
+// vendorChannelsSql lists each vendor base channel followed by its children
+var vendorChannelsSql = `select c.label from rhnchannel c
+	left join rhnchannel parent on parent.id = c.parent_channel
+	where c.org_id is null %s
+	order by coalesce(parent.label, c.label), c.parent_channel is not null, c.label`
+
+// channelContentCondition keeps the channels with packages or errata, and the base channels of such channels
+var channelContentCondition = `and exists (select 1 from rhnchannel cc
+	where (cc.id = c.id or cc.parent_channel = c.id) and (
+		exists (select 1 from rhnchannelpackage cp where cp.channel_id = cc.id) or
+		exists (select 1 from rhnchannelerrata ce where ce.channel_id = cc.id)))`
+
+// otherOrgsChannelsSql lists the custom channels of organizations not in the list, vendor channels belong to none
+var otherOrgsChannelsSql = "select label from rhnchannel where org_id not in (%s)"
+
+// channelDependenciesSql returns the base channel and the clone original of a channel, with their organizations
+var channelDependenciesSql = `select parent.label, parent.org_id, original.label, original.org_id from rhnchannel c
+	left join rhnchannel parent on parent.id = c.parent_channel
+	left join rhnchannelcloned cl on cl.id = c.id
+	left join rhnchannel original on original.id = cl.original_id
+	where c.label = $1`
+
+// ChannelExpansion lists the channels a channel selector of the options expands to
+type ChannelExpansion struct {
+	Selector string
+	Channels []string
+}
+
+// ExpandChannelSelectors resolves the channel labels, glob patterns, products, channel families,
+// content lifecycle management environments, vendor channels and custom channels of options to the channels they select
+func ExpandChannelSelectors(ctx context.Context, options DumperOptions) ([]ChannelExpansion, error) {
+	db, err := schemareader.GetDBconnection(options.ServerConfig)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	return expandChannelSelectors(ctx, db, options)
+}
+
+// expandChannelSelectors returns the expansion of every selector of options.
+// Selectors matching no channel are reported together, wrapping ErrInvalidOptions.
+func expandChannelSelectors(ctx context.Context, db *sql.DB, options DumperOptions) ([]ChannelExpansion, error) {
+	expansions := make([]ChannelExpansion, 0)
+	problems := make([]error, 0)
+	var allLabels []string
+	// with an organization limit, only vendor channels and the custom channels of the organizations are selected
+	otherOrgsChannels := make(map[string]bool)
+	if len(options.Orgs) > 0 {
+		labels, err := queryLabels(ctx, db, fmt.Sprintf(otherOrgsChannelsSql, orgList(options.Orgs)))
+		if err != nil {
+			return nil, err
+		}
+		for _, label := range labels {
+			otherOrgsChannels[label] = true
+		}
+		for _, label := range append(append([]string{}, options.ChannelLabels...), options.ChannelWithChildrenLabels...) {
+			if otherOrgsChannels[label] {
+				problems = append(problems, fmt.Errorf("%w: channel %s belongs to an organization other than %s",
+					ErrInvalidOptions, label, orgList(options.Orgs)))
+			}
+		}
+	}
+	add := func(selector string, labels []string) {
+		allowed := make([]string, 0, len(labels))
+		for _, label := range labels {
+			if !otherOrgsChannels[label] {
+				allowed = append(allowed, label)
+			}
+		}
+		labels = allowed
+		if len(labels) == 0 {
+			problems = append(problems, fmt.Errorf("%w: no channel found for %s", ErrInvalidOptions, selector))
+			return
+		}
+		expansions = append(expansions, ChannelExpansion{Selector: selector, Channels: labels})
+	}
+	matchLabels := func(pattern string) ([]string, error) {
+		if !isGlobPattern(pattern) {
+			return queryLabels(ctx, db, singleChannelSql, pattern)
+		}
+		if allLabels == nil {
+			var err error
+			if allLabels, err = queryLabels(ctx, db, allChannelsSql); err != nil {
+				return nil, err
+			}
+		}
+		matching := make([]string, 0)
+		for _, label := range allLabels {
+			if ok, _ := path.Match(pattern, label); ok {
+				matching = append(matching, label)
+			}
+		}
+		return matching, nil
+	}
+
+	for _, pattern := range options.ChannelLabels {
+		labels, err := matchLabels(pattern)
+		if err != nil {
+			return nil, err
+		}
+		add(pattern, labels)
+	}
+	for _, pattern := range options.ChannelWithChildrenLabels {
+		parents, err := matchLabels(pattern)
+		if err != nil {
+			return nil, err
+		}
+		labels := make([]string, 0)
+		for _, parent := range parents {
+			children, err := queryLabels(ctx, db, childChannelSql, parent)
+			if err != nil {
+				return nil, err
+			}
+			labels = append(append(labels, parent), children...)
+		}
+		add(pattern+" with children", labels)
+	}
+	for _, product := range options.Products {
+		parts := strings.Split(product, "/")
+		if len(parts) < 2 || len(parts) > 3 {
+			problems = append(problems, fmt.Errorf("%w: invalid product %s, expected name/version[/arch]", ErrInvalidOptions, product))
+			continue
+		}
+		arch := ""
+		if len(parts) == 3 {
+			arch = parts[2]
+		}
+		labels, err := queryLabels(ctx, db, productChannelsSql, parts[0], parts[1], arch)
+		if err != nil {
+			return nil, err
+		}
+		add("product "+product, labels)
+	}
+	for _, family := range options.ChannelFamilies {
+		labels, err := queryLabels(ctx, db, channelFamilyChannelsSql, family)
+		if err != nil {
+			return nil, err
+		}
+		add("channel family "+family, labels)
+	}
+	for _, environment := range options.ClmEnvironments {
+		project, environmentLabel, ok := strings.Cut(environment, ":")
+		if !ok || project == "" || environmentLabel == "" {
+			problems = append(problems, fmt.Errorf("%w: invalid CLM environment %s, expected project:environment",
+				ErrInvalidOptions, environment))
+			continue
+		}
+		labels, err := queryLabels(ctx, db, clmEnvironmentChannelsSql, project, environmentLabel)
+		if err != nil {
+			return nil, err
+		}
+		add("CLM environment "+environment, labels)
+	}
+	if options.AllVendorChannels {
+		condition := ""
+		if options.VendorChannelsWithContent {
+			condition = channelContentCondition
+		}
+		labels, err := queryLabels(ctx, db, fmt.Sprintf(vendorChannelsSql, condition))
+		if err != nil {
+			return nil, err
+		}
+		add("vendor channels", labels)
+	}
+	if options.AllCustomChannels {
+		if len(options.Orgs) == 0 {
+			problems = append(problems, fmt.Errorf("%w: all custom channels requires an organization limit", ErrInvalidOptions))
+		}
+		for _, org := range options.Orgs {
+			labels, err := queryLabels(ctx, db, customChannelsSql, org)
+			if err != nil {
+				return nil, err
+			}
+			add(fmt.Sprintf("custom channels of organization %d", org), labels)
+		}
+	}
+	return expansions, errors.Join(problems...)
+}
+
+// loadChannelsToProcess returns the channels selected by options, each once, in the order of the selectors,
+// and the channel relations dropped by the export
+func loadChannelsToProcess(ctx context.Context, db *sql.DB, options DumperOptions) ([]string, []string, error) {
+	log.Trace().Msg("Loading channel list")
+	expansions, err := expandChannelSelectors(ctx, db, options)
+	if err != nil {
+		return nil, nil, err
+	}
+	channels := channelsProcess{make(map[string]bool), make([]string, 0)}
+	for _, expansion := range expansions {
+		log.Info().Msgf("Channels selected by %s: %s", expansion.Selector, strings.Join(expansion.Channels, ","))
+		for _, label := range expansion.Channels {
+			if _, ok := channels.channelsMap[label]; !ok {
+				channels.addChannelLabel(label)
+			}
+		}
+	}
+	resolved, dropped, err := resolveChannelDependencies(ctx, db, channels.channels, options)
+	if err != nil {
+		return nil, nil, err
+	}
+	log.Debug().Msgf("Channels to export: %s", strings.Join(resolved, ","))
+	return resolved, dropped, nil
+}
+
+// resolveChannelDependencies orders the channels after the base channels and clone originals they rely on.
+// With options.ResolveDependencies, the missing ones are added to the export, otherwise the relations to them,
+// dropped by the import unless the target server has them, are reported and returned.
+func resolveChannelDependencies(ctx context.Context, db *sql.DB, channels []string, options DumperOptions) ([]string, []string, error) {
+	selected := make(map[string]bool)
+	for _, label := range channels {
+		selected[label] = true
+	}
+	visited := make(map[string]bool)
+	result := make([]string, 0, len(channels))
+	droppedRelations := make([]string, 0)
+	var visit func(label string) error
+	visit = func(label string) error {
+		if visited[label] {
+			return nil
+		}
+		visited[label] = true
+		rows, err := sqlUtil.ExecuteQueryWithResults(ctx, db, channelDependenciesSql, label)
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			dependencies := []struct {
+				relation string
+				label    interface{}
+				org      interface{}
+			}{
+				{"base channel", row[0].Value, row[1].Value},
+				{"clone original", row[2].Value, row[3].Value},
+			}
+			for _, dependency := range dependencies {
+				if dependency.label == nil {
+					continue
+				}
+				dependencyLabel := fmt.Sprintf("%v", dependency.label)
+				dropped := ""
+				switch {
+				case selected[dependencyLabel]:
+				case !isOrgAllowed(dependency.org, options.Orgs):
+					dropped = "belongs to an organization out of the organization limit"
+				case options.ResolveDependencies:
+					log.Info().Msgf("Adding %s %s of channel %s", dependency.relation, dependencyLabel, label)
+				default:
+					dropped = "is not exported"
+				}
+				if dropped != "" {
+					message := fmt.Sprintf("channel %s: %s %s %s, the relation is dropped unless the target server has it",
+						label, dependency.relation, dependencyLabel, dropped)
+					log.Warn().Msg(message)
+					progress.Warn(ctx, "%s", message)
+					droppedRelations = append(droppedRelations, message)
+					continue
+				}
+				if err := visit(dependencyLabel); err != nil {
+					return err
+				}
+			}
+		}
+		result = append(result, label)
+		return nil
+	}
+	for _, label := range channels {
+		if err := visit(label); err != nil {
+			return nil, nil, err
+		}
+	}
+	return result, droppedRelations, nil
+}
+
+// isOrgAllowed returns true if the content of org can be exported with the organization limit orgs
+func isOrgAllowed(org interface{}, orgs []uint) bool {
+	if org == nil || len(orgs) == 0 {
+		return true
+	}
+	for _, allowed := range orgs {
+		if fmt.Sprintf("%v", org) == strconv.FormatUint(uint64(allowed), 10) {
+			return true
+		}
+	}
+	return false
+}
+
+func queryLabels(ctx context.Context, db *sql.DB, query string, params ...interface{}) ([]string, error) {
+	rows, err := sqlUtil.ExecuteQueryWithResults(ctx, db, query, params...)
+	if err != nil {
+		return nil, err
+	}
+	labels := make([]string, 0, len(rows))
+	for _, row := range rows {
+		labels = append(labels, fmt.Sprintf("%v", row[0].Value))
+	}
+	return labels, nil
+}
+
+func isGlobPattern(selector string) bool {
+	return strings.ContainsAny(selector, "*?[")
+}
@@ -0,0 +1,170 @@
+// SPDX-FileCopyrightText: 2023 SUSE LLC
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package entityDumper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/uyuni-project/inter-server-sync/progress"
+	"github.com/uyuni-project/inter-server-sync/tests"
+)
+
+func labelRows(labels ...string) *sqlmock.Rows {
+	rows := sqlmock.NewRows([]string{"label"})
+	for _, label := range labels {
+		rows.AddRow(label)
+	}
+	return rows
+}
+
+func TestExpandChannelSelectors(t *testing.T) {
+	repo := tests.CreateDataRepository()
+	repo.ExpectWithRecords(singleChannelSql, labelRows("base"), "base")
+	repo.ExpectWithRecords(allChannelsSql, labelRows("base", "sle-product-sles15-sp5-pool", "sle-product-sles15-sp5-updates"))
+	repo.ExpectWithRecords(productChannelsSql, labelRows("sles15-sp5-pool", "sles15-sp5-updates"), "SLES", "15.5", "x86_64")
+	repo.ExpectWithRecords(channelFamilyChannelsSql, labelRows("tools"), "SLE-M-T")
+	repo.ExpectWithRecords(clmEnvironmentChannelsSql, labelRows("prj-prod-base", "prj-prod-child"), "prj", "prod")
+
+	options := DumperOptions{
+		ChannelLabels:   []string{"base", "sle-product-sles15-sp5-*"},
+		Products:        []string{"SLES/15.5/x86_64"},
+		ChannelFamilies: []string{"SLE-M-T"},
+		ClmEnvironments: []string{"prj:prod"},
+	}
+	expansions, err := expandChannelSelectors(context.Background(), repo.DB, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []ChannelExpansion{
+		{Selector: "base", Channels: []string{"base"}},
+		{Selector: "sle-product-sles15-sp5-*", Channels: []string{"sle-product-sles15-sp5-pool", "sle-product-sles15-sp5-updates"}},
+		{Selector: "product SLES/15.5/x86_64", Channels: []string{"sles15-sp5-pool", "sles15-sp5-updates"}},
+		{Selector: "channel family SLE-M-T", Channels: []string{"tools"}},
+		{Selector: "CLM environment prj:prod", Channels: []string{"prj-prod-base", "prj-prod-child"}},
+	}
+	if !reflect.DeepEqual(expansions, expected) {
+		t.Errorf("expected %+v, got %+v", expected, expansions)
+	}
+}
+
+func TestExpandChannelSelectorsNotFound(t *testing.T) {
+	repo := tests.CreateDataRepository()
+	repo.ExpectWithRecords(allChannelsSql, labelRows("base"))
+
+	options := DumperOptions{ChannelLabels: []string{"missing-*"}, Products: []string{"SLES"},
+		ClmEnvironments: []string{"prj"}}
+	_, err := expandChannelSelectors(context.Background(), repo.DB, options)
+	if !errors.Is(err, ErrInvalidOptions) {
+		t.Fatalf("expected invalid options, got %v", err)
+	}
+}
+
+func TestExpandChannelSelectorsWithOrgLimit(t *testing.T) {
+	repo := tests.CreateDataRepository()
+	repo.ExpectWithRecords("select label from rhnchannel where org_id not in (2,3)", labelRows("other-org-base", "other-org-child"))
+	repo.ExpectWithRecords(singleChannelSql, labelRows("other-org-base"), "other-org-base")
+	repo.ExpectWithRecords(singleChannelSql, labelRows("vendor-base"), "vendor-base")
+	repo.ExpectWithRecords(childChannelSql, labelRows("vendor-child", "other-org-child"), "vendor-base")
+	repo.ExpectWithRecords(customChannelsSql, labelRows("org2-base"), int64(2))
+	repo.ExpectWithRecords(customChannelsSql, labelRows(), int64(3))
+
+	options := DumperOptions{ChannelLabels: []string{"other-org-base"}, ChannelWithChildrenLabels: []string{"vendor-base"},
+		Orgs: []uint{2, 3}, AllCustomChannels: true}
+	expansions, err := expandChannelSelectors(context.Background(), repo.DB, options)
+	if !errors.Is(err, ErrInvalidOptions) {
+		t.Fatalf("expected invalid options for the channel of another organization, got %v", err)
+	}
+	expected := []ChannelExpansion{
+		{Selector: "vendor-base with children", Channels: []string{"vendor-base", "vendor-child"}},
+		{Selector: "custom channels of organization 2", Channels: []string{"org2-base"}},
+	}
+	if !reflect.DeepEqual(expansions, expected) {
+		t.Errorf("expected %+v, got %+v", expected, expansions)
+	}
+}
+
+func TestExpandVendorChannels(t *testing.T) {
+	repo := tests.CreateDataRepository()
+	repo.ExpectWithRecords(fmt.Sprintf(vendorChannelsSql, channelContentCondition),
+		labelRows("sles15-sp5-pool", "sles15-sp5-updates", "sles15-sp5-tools"))
+
+	options := DumperOptions{AllVendorChannels: true, VendorChannelsWithContent: true}
+	expansions, err := expandChannelSelectors(context.Background(), repo.DB, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []ChannelExpansion{
+		{Selector: "vendor channels", Channels: []string{"sles15-sp5-pool", "sles15-sp5-updates", "sles15-sp5-tools"}},
+	}
+	if !reflect.DeepEqual(expansions, expected) {
+		t.Errorf("expected %+v, got %+v", expected, expansions)
+	}
+}
+
+type warningRecorder struct {
+	messages []string
+}
+
+func (recorder *warningRecorder) Report(event progress.Event) {
+	if event.Event == progress.Warning {
+		recorder.messages = append(recorder.messages, event.Message)
+	}
+}
+
+func dependencyRows(parent interface{}, original interface{}) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"label", "org_id", "label", "org_id"}).AddRow(parent, nil, original, nil)
+}
+
+func TestResolveChannelDependencies(t *testing.T) {
+	repo := tests.CreateDataRepository()
+	repo.ExpectWithRecords(channelDependenciesSql, dependencyRows("base-clone", "child"), "child-clone")
+	repo.ExpectWithRecords(channelDependenciesSql, dependencyRows(nil, "base"), "base-clone")
+	repo.ExpectWithRecords(channelDependenciesSql, dependencyRows(nil, nil), "base")
+	repo.ExpectWithRecords(channelDependenciesSql, dependencyRows("base", nil), "child")
+
+	channels, droppedRelations, err := resolveChannelDependencies(context.Background(), repo.DB, []string{"child-clone"},
+		DumperOptions{ResolveDependencies: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"base", "base-clone", "child", "child-clone"}
+	if !reflect.DeepEqual(channels, expected) {
+		t.Errorf("expected %v, got %v", expected, channels)
+	}
+	if len(droppedRelations) != 0 {
+		t.Errorf("expected no dropped relation, got %v", droppedRelations)
+	}
+}
+
+func TestReportChannelDependencies(t *testing.T) {
+	repo := tests.CreateDataRepository()
+	repo.ExpectWithRecords(channelDependenciesSql, dependencyRows("base", nil), "child")
+	repo.ExpectWithRecords(channelDependenciesSql, dependencyRows(nil, "original"), "clone")
+
+	warnings := &warningRecorder{}
+	ctx := progress.WithReporter(context.Background(), warnings)
+	channels, droppedRelations, err := resolveChannelDependencies(ctx, repo.DB, []string{"child", "clone"}, DumperOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(channels, []string{"child", "clone"}) {
+		t.Errorf("unexpected channels %v", channels)
+	}
+	if len(warnings.messages) != 2 {
+		t.Errorf("expected the base channel and the clone original to be reported, got %v", warnings.messages)
+	}
+	expected := []string{
+		"channel child: base channel base is not exported, the relation is dropped unless the target server has it",
+		"channel clone: clone original original is not exported, the relation is dropped unless the target server has it",
+	}
+	if !reflect.DeepEqual(droppedRelations, expected) {
+		t.Errorf("expected %q, got %q", expected, droppedRelations)
+	}
+}
@@ -6,6 +6,7 @@ package entityDumper
 
 import (
 	"bufio"
+	"context"
 	"database/sql"
 	"fmt"
 	"os"
@@ -13,6 +14,7 @@ import (
 
 	"github.com/rs/zerolog/log"
 	"github.com/uyuni-project/inter-server-sync/dumper"
+	"github.com/uyuni-project/inter-server-sync/progress"
 	"github.com/uyuni-project/inter-server-sync/schemareader"
 	"github.com/uyuni-project/inter-server-sync/sqlUtil"
 )
@@ -45,15 +47,22 @@ func loadConfigsToProcess(db *sql.DB, options DumperOptions) []string {
 	return labels.channels
 }
 
-func processConfigs(db *sql.DB, writer *bufio.Writer, options DumperOptions) {
+func processConfigs(ctx context.Context, db *sql.DB, writer *bufio.Writer, options DumperOptions) ([]string, error) {
 
 	configs := loadConfigsToProcess(db, options)
 	log.Info().Msg(fmt.Sprintf("%d configuration channels to process", len(configs)))
-	schemaMetadata := schemareader.ReadTablesSchema(db, ConfigTableNames())
+	schemaMetadata, err := schemareader.ReadTablesSchema(db, ConfigTableNames())
+	if err != nil {
+		return nil, err
+	}
 	log.Debug().Msg("channel schema metadata loaded")
-	configLabels, err := os.Create(options.GetOutputFolderAbsPath() + "/exportedConfigs.txt")
+	outputFolderAbs, err := options.GetOutputFolderAbsPath()
+	if err != nil {
+		return nil, err
+	}
+	configLabels, err := os.Create(outputFolderAbs + "/exportedConfigs.txt")
 	if err != nil {
-		log.Panic().Err(err).Msg("error creating exportedConfigChannel file")
+		return nil, fmt.Errorf("error creating exportedConfigChannel file: %w", err)
 	}
 	defer configLabels.Close()
 	bufferWriterChannels := bufio.NewWriter(configLabels)
@@ -63,17 +72,27 @@ func processConfigs(db *sql.DB, writer *bufio.Writer, options DumperOptions) {
 	for _, l := range configs {
 		count++
 		log.Debug().Msg(fmt.Sprintf("Processing channel [%d/%d] %s", count, len(configs), l))
-		processConfigChannel(db, writer, l, schemaMetadata, options)
+		progress.Report(ctx, progress.Event{Event: progress.ChannelStarted, Phase: "configs", Channel: l,
+			Current: count, Total: len(configs)})
+		if err := processConfigChannel(ctx, db, writer, l, schemaMetadata, options); err != nil {
+			return nil, fmt.Errorf("error exporting configuration channel %s: %w", l, err)
+		}
 		writer.Flush()
 		bufferWriterChannels.WriteString(fmt.Sprintf("%s\n", l))
 	}
-
+	return configs, nil
 }
 
-func processConfigChannel(db *sql.DB, writer *bufio.Writer, channelLabel string,
-	schemaMetadata map[string]schemareader.Table, options DumperOptions) {
+func processConfigChannel(ctx context.Context, db *sql.DB, writer *bufio.Writer, channelLabel string,
+	schemaMetadata map[string]schemareader.Table, options DumperOptions) error {
 	whereFilter := fmt.Sprintf("label = '%s'", channelLabel)
-	tableData := dumper.DataCrawler(db, schemaMetadata, schemaMetadata["rhnconfigchannel"], whereFilter, options.StartingDate)
+	if len(options.Orgs) > 0 {
+		whereFilter = fmt.Sprintf("%s AND org_id IN (%s)", whereFilter, orgList(options.Orgs))
+	}
+	tableData, err := dumper.DataCrawler(ctx, db, schemaMetadata, schemaMetadata["rhnconfigchannel"], whereFilter, options.StartingDate)
+	if err != nil {
+		return err
+	}
 	log.Debug().Msg("finished table data crawler")
 
 	cleanWhereClause := fmt.Sprintf(`WHERE rhnconfigchannel.id = (SELECT id FROM rhnconfigchannel WHERE label = '%s')`, channelLabel)
@@ -84,15 +103,19 @@ func processConfigChannel(db *sql.DB, writer *bufio.Writer, channelLabel string,
 		PostOrderCallback:        createPostOrderCallback(),
 	}
 
-	dumper.PrintTableDataOrdered(db, writer, schemaMetadata, schemaMetadata["rhnconfigchannel"],
+	err = dumper.PrintTableDataOrdered(ctx, db, writer, schemaMetadata, schemaMetadata["rhnconfigchannel"],
 		tableData, printOptions)
+	if err != nil {
+		return err
+	}
 	log.Debug().Msg("finished print table order")
 	log.Info().Msg("config channel export finished")
+	return nil
 }
 
 func createPostOrderCallback() dumper.Callback {
-	return func(db *sql.DB, writer *bufio.Writer, schemaMetadata map[string]schemareader.Table,
-		table schemareader.Table, data dumper.DataDumper) {
+	return func(ctx context.Context, db *sql.DB, writer *bufio.Writer, schemaMetadata map[string]schemareader.Table,
+		table schemareader.Table, data dumper.DataDumper) error {
 
 		tableData, dataOK := data.TableData[table.Name]
 		if strings.Compare(table.Name, "rhnconfigfile") == 0 {
@@ -104,9 +127,15 @@ func createPostOrderCallback() dumper.Callback {
 					if upperLimit > len(tableData.Keys) {
 						upperLimit = len(tableData.Keys)
 					}
-					rows := dumper.GetRowsFromKeys(db, table, tableData.Keys[exportPoint:upperLimit])
+					rows, err := dumper.GetRowsFromKeys(ctx, db, table, tableData.Keys[exportPoint:upperLimit])
+					if err != nil {
+						return err
+					}
 					for _, rowValue := range rows {
-						rowValue = dumper.SubstituteForeignKey(db, table, schemaMetadata, rowValue)
+						rowValue, err = dumper.SubstituteForeignKey(ctx, db, table, schemaMetadata, rowValue)
+						if err != nil {
+							return err
+						}
 						updateString := genUpdateForReference(rowValue)
 						writer.WriteString(updateString + "\n")
 					}
@@ -114,6 +143,7 @@ func createPostOrderCallback() dumper.Callback {
 				}
 			}
 		}
+		return nil
 	}
 }
 
@@ -7,42 +7,92 @@ package entityDumper
 import (
 	"bufio"
 	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
 	"os"
 
-	"github.com/rs/zerolog/log"
+	"github.com/uyuni-project/inter-server-sync/dumper"
+	"github.com/uyuni-project/inter-server-sync/progress"
 	"github.com/uyuni-project/inter-server-sync/schemareader"
 )
 
-func DumpAllEntities(options DumperOptions) {
-	var outputFolderAbs = options.GetOutputFolderAbsPath()
-	validateExportFolder(outputFolderAbs)
+func DumpAllEntities(ctx context.Context, options DumperOptions) (ExportSummary, error) {
+	summary := ExportSummary{Channels: make([]string, 0), ConfigChannels: make([]string, 0)}
+	ctx = dumper.WithReferenceCache(ctx)
+	outputFolderAbs, err := options.GetOutputFolderAbsPath()
+	if err != nil {
+		return summary, err
+	}
+	if err := ValidateExportFolder(outputFolderAbs); err != nil {
+		return summary, err
+	}
 
-	file, err := os.OpenFile(outputFolderAbs+"/sql_statements.sql.gz", os.O_WRONLY|os.O_CREATE, 0600)
+	sqlFileName := "/sql_statements.sql.gz"
+	if options.Compression == CompressionNone {
+		sqlFileName = "/sql_statements.sql"
+	}
+	file, err := os.OpenFile(outputFolderAbs+sqlFileName, os.O_WRONLY|os.O_CREATE, 0600)
 	if err != nil {
-		log.Panic().Err(err).Msg("error creating sql file")
+		return summary, fmt.Errorf("error creating sql file: %w", err)
 	}
 	defer file.Close()
 
-	gzipFile := gzip.NewWriter(file)
-	defer gzipFile.Close()
+	var sqlWriter io.WriteCloser = file
+	if options.Compression != CompressionNone {
+		sqlWriter = gzip.NewWriter(file)
+		defer sqlWriter.Close()
+	}
 
-	bufferWriter := bufio.NewWriterSize(gzipFile, 32768)
-	defer bufferWriter.Flush()
+	bufferWriter := bufio.NewWriterSize(sqlWriter, 32768)
 
-	db := schemareader.GetDBconnection(options.ServerConfig)
+	db, err := schemareader.GetDBconnection(options.ServerConfig)
+	if err != nil {
+		return summary, err
+	}
 	defer db.Close()
 	bufferWriter.WriteString("BEGIN;\n")
-	if len(options.ChannelLabels) > 0 || len(options.ChannelWithChildrenLabels) > 0 {
-		processAndInsertProducts(db, bufferWriter)
-		processAndInsertChannels(db, bufferWriter, options)
+	if options.hasChannelSelection() {
+		finishPhase := progress.StartPhase(ctx, "products")
+		err := processAndInsertProducts(ctx, db, bufferWriter)
+		finishPhase(err)
+		if err != nil {
+			return summary, err
+		}
+		finishPhase = progress.StartPhase(ctx, "channels")
+		channels, droppedRelations, err := processAndInsertChannels(ctx, db, bufferWriter, options)
+		finishPhase(err)
+		summary.DroppedRelations = droppedRelations
+		if err != nil {
+			return summary, err
+		}
+		summary.Channels = channels
 	}
 	if len(options.ConfigLabels) > 0 {
-		processConfigs(db, bufferWriter, options)
+		finishPhase := progress.StartPhase(ctx, "configs")
+		configs, err := processConfigs(ctx, db, bufferWriter, options)
+		finishPhase(err)
+		if err != nil {
+			return summary, err
+		}
+		summary.ConfigChannels = configs
 	}
 
 	if options.OSImages || options.Containers {
-		dumpImageData(db, bufferWriter, options)
+		finishPhase := progress.StartPhase(ctx, "images")
+		err := dumpImageData(ctx, db, bufferWriter, options)
+		finishPhase(err)
+		if err != nil {
+			return summary, err
+		}
 	}
 
 	bufferWriter.WriteString("COMMIT;\n")
+	if err := bufferWriter.Flush(); err != nil {
+		return summary, fmt.Errorf("error writing sql file: %w", err)
+	}
+	if err := sqlWriter.Close(); err != nil {
+		return summary, fmt.Errorf("error writing sql file: %w", err)
+	}
+	return summary, nil
 }
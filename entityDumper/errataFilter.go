@@ -0,0 +1,63 @@
+// SPDX-FileCopyrightText: 2023 SUSE LLC
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package entityDumper
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/uyuni-project/inter-server-sync/schemareader"
+)
+
+// ErrataTypes are the advisory types of rhnerrata
+var ErrataTypes = []string{"Security Advisory", "Bug Fix Advisory", "Product Enhancement Advisory"}
+
+// ErrataSeverities are the severities of rhnerrataseverity, without their errata.sev.label. prefix
+var ErrataSeverities = []string{"critical", "important", "moderate", "low", "unspecified"}
+
+const errataSeverityPrefix = "errata.sev.label."
+
+// hasErrataFilter returns true if options export only some of the errata of the channels
+func (opt *DumperOptions) hasErrataFilter() bool {
+	return len(opt.ErrataTypes) > 0 || len(opt.ErrataSeverities) > 0 || opt.ErrataIssuedAfter != ""
+}
+
+// addErrataFilter restricts the errata of the channels to the ones matching the errata filters of options.
+// The packages linked to excluded errata only are left out as well.
+func addErrataFilter(schemaMetadata map[string]schemareader.Table, options DumperOptions) {
+	errata := errataQuery(options)
+	if table, ok := schemaMetadata["rhnchannelerrata"]; ok {
+		table.AddRowFilter(fmt.Sprintf("rhnchannelerrata.errata_id IN (%s)", errata))
+		schemaMetadata["rhnchannelerrata"] = table
+	}
+	addPackageFilter(schemaMetadata, fmt.Sprintf(
+		`SELECT p.id FROM rhnpackage p WHERE p.id NOT IN (SELECT ep.package_id FROM rhnerratapackage ep WHERE ep.errata_id NOT IN (%s))
+		OR p.id IN (SELECT ep.package_id FROM rhnerratapackage ep WHERE ep.errata_id IN (%s))`, errata, errata))
+}
+
+// errataQuery selects the errata matching the errata filters of options
+func errataQuery(options DumperOptions) string {
+	conditions := make([]string, 0)
+	if len(options.ErrataTypes) > 0 {
+		conditions = append(conditions, fmt.Sprintf("e.advisory_type IN (%s)", quoteLiterals(options.ErrataTypes, "")))
+	}
+	if len(options.ErrataSeverities) > 0 {
+		conditions = append(conditions, fmt.Sprintf("e.severity_id IN (SELECT id FROM rhnerrataseverity WHERE label IN (%s))",
+			quoteLiterals(options.ErrataSeverities, errataSeverityPrefix)))
+	}
+	if options.ErrataIssuedAfter != "" {
+		conditions = append(conditions, fmt.Sprintf("e.issue_date >= %s::timestamp", pq.QuoteLiteral(options.ErrataIssuedAfter)))
+	}
+	return "SELECT e.id FROM rhnerrata e WHERE " + strings.Join(conditions, " AND ")
+}
+
+func quoteLiterals(values []string, prefix string) string {
+	literals := make([]string, 0, len(values))
+	for _, value := range values {
+		literals = append(literals, pq.QuoteLiteral(prefix+value))
+	}
+	return strings.Join(literals, ", ")
+}
@@ -6,6 +6,7 @@ package entityDumper
 
 import (
 	"bufio"
+	"context"
 	"database/sql"
 	"fmt"
 	"path/filepath"
@@ -15,6 +16,7 @@ import (
 	"github.com/uyuni-project/inter-server-sync/dumper"
 	"github.com/uyuni-project/inter-server-sync/dumper/osImageDumper"
 	"github.com/uyuni-project/inter-server-sync/dumper/pillarDumper"
+	"github.com/uyuni-project/inter-server-sync/progress"
 	"github.com/uyuni-project/inter-server-sync/schemareader"
 	"github.com/uyuni-project/inter-server-sync/sqlUtil"
 )
@@ -80,32 +82,48 @@ func isColumnInTable(schema map[string]schemareader.Table, table string, column
 	return false
 }
 
-func dumpImageStores(db *sql.DB, writer *bufio.Writer, schemaMetadata map[string]schemareader.Table, options DumperOptions, store_label string) {
+func dumpImageStores(ctx context.Context, db *sql.DB, writer *bufio.Writer, schemaMetadata map[string]schemareader.Table, options DumperOptions, store_label string) error {
 
 	sqlForExistingStores := fmt.Sprintf(
 		"SELECT sis.id from suseimagestore AS sis JOIN suseimagestoretype AS sist ON sis.store_type_id = sist.id WHERE sist.label = '%s'", store_label)
-	for _, org := range options.Orgs {
-		sqlForExistingStores = fmt.Sprintf("%s AND sis.org_id = %d", sqlForExistingStores, org)
+	if len(options.Orgs) > 0 {
+		sqlForExistingStores = fmt.Sprintf("%s AND sis.org_id IN (%s)", sqlForExistingStores, orgList(options.Orgs))
 	}
 	if options.StartingDate != "" {
 		sqlForExistingStores = fmt.Sprintf("%s AND sis.modified > '%s'::timestamp", sqlForExistingStores, options.StartingDate)
 	}
-	stores := sqlUtil.ExecuteQueryWithResults(db, sqlForExistingStores)
+	stores, err := sqlUtil.ExecuteQueryWithResults(ctx, db, sqlForExistingStores)
+	if err != nil {
+		return err
+	}
 	if len(stores) > 0 {
 		log.Debug().Msgf("Dumping ImageStores tables for label %s", store_label)
 		writer.WriteString(fmt.Sprintf("-- %s Image Stores\n", store_label))
 		for _, store := range stores {
 			log.Trace().Msgf("Exporting store id %s", store[0].Value)
 			whereClause := fmt.Sprintf("id = '%s'", store[0].Value)
-			tableProfilesData := dumper.DataCrawler(db, schemaMetadata, schemaMetadata["suseimagestore"], whereClause, options.StartingDate)
-
-			dumper.PrintTableDataOrdered(db, writer, schemaMetadata, schemaMetadata["suseimagestore"], tableProfilesData, dumper.PrintSqlOptions{})
+			err := dumpCrawledTable(ctx, db, writer, schemaMetadata, "suseimagestore", whereClause, options, dumper.PrintSqlOptions{})
+			if err != nil {
+				return err
+			}
 		}
 		// Mark tables as exported so they are not transitively exported by profiles
 		markAsExported(schemaMetadata, []string{"suseimagestore"})
 	} else {
 		log.Info().Msg("No image stores found to export")
 	}
+	return nil
+}
+
+// dumpCrawledTable crawls the data linked to the rows of startingTable matching whereClause and prints it
+func dumpCrawledTable(ctx context.Context, db *sql.DB, writer *bufio.Writer, schemaMetadata map[string]schemareader.Table, startingTable string,
+	whereClause string, options DumperOptions, printOptions dumper.PrintSqlOptions) error {
+
+	tableData, err := dumper.DataCrawler(ctx, db, schemaMetadata, schemaMetadata[startingTable], whereClause, options.StartingDate)
+	if err != nil {
+		return err
+	}
+	return dumper.PrintTableDataOrdered(ctx, db, writer, schemaMetadata, schemaMetadata[startingTable], tableData, printOptions)
 }
 
 /*
@@ -113,27 +131,31 @@ func dumpImageStores(db *sql.DB, writer *bufio.Writer, schemaMetadata map[string
 
 	Dump OS image tables, return true if additional data (pillars, images) need to be also dumped
 */
-func dumpOSImageTables(db *sql.DB, writer *bufio.Writer, schemaMetadata map[string]schemareader.Table,
-	options DumperOptions, outputFolderImagesAbs string) bool {
+func dumpOSImageTables(ctx context.Context, db *sql.DB, writer *bufio.Writer, schemaMetadata map[string]schemareader.Table,
+	options DumperOptions, outputFolderImagesAbs string) (bool, error) {
 
 	// Image profiles
 	sqlForExistingProfiles := "SELECT profile_id FROM suseimageprofile WHERE image_type = 'kiwi'"
-	for _, org := range options.Orgs {
-		sqlForExistingProfiles = fmt.Sprintf("%s AND org_id = %d", sqlForExistingProfiles, org)
+	if len(options.Orgs) > 0 {
+		sqlForExistingProfiles = fmt.Sprintf("%s AND org_id IN (%s)", sqlForExistingProfiles, orgList(options.Orgs))
 	}
 	if options.StartingDate != "" {
 		sqlForExistingProfiles = fmt.Sprintf("%s AND modified > '%s'::timestamp", sqlForExistingProfiles, options.StartingDate)
 	}
-	profiles := sqlUtil.ExecuteQueryWithResults(db, sqlForExistingProfiles)
+	profiles, err := sqlUtil.ExecuteQueryWithResults(ctx, db, sqlForExistingProfiles)
+	if err != nil {
+		return false, err
+	}
 	if len(profiles) > 0 {
 		log.Debug().Msg("Dumping ImageProfile tables")
 		writer.WriteString("-- OS Image Profiles\n")
 		for _, profile := range profiles {
 			log.Trace().Msgf("Exporting profile id %s", profile[0].Value)
 			whereClause := fmt.Sprintf("profile_id = '%s'", profile[0].Value)
-			tableProfilesData := dumper.DataCrawler(db, schemaMetadata, schemaMetadata["susekiwiprofile"], whereClause, options.StartingDate)
-
-			dumper.PrintTableDataOrdered(db, writer, schemaMetadata, schemaMetadata["susekiwiprofile"], tableProfilesData, dumper.PrintSqlOptions{})
+			err := dumpCrawledTable(ctx, db, writer, schemaMetadata, "susekiwiprofile", whereClause, options, dumper.PrintSqlOptions{})
+			if err != nil {
+				return false, err
+			}
 		}
 		// Mark tables as exported so they are not transitively exported by images
 		markAsExported(schemaMetadata, []string{"suseimageprofile"})
@@ -143,18 +165,21 @@ func dumpOSImageTables(db *sql.DB, writer *bufio.Writer, schemaMetadata map[stri
 
 	// Images
 	needExtraExport := false
-	sqlForExistingImages := "SELECT id FROM suseimageinfo WHERE image_type = 'kiwi'"
+	sqlForExistingImages := "SELECT id, name, version FROM suseimageinfo WHERE image_type = 'kiwi'"
 	if isColumnInTable(schemaMetadata, "suseimageinfo", "built") {
 		// For 4.3 and newer export only succesfuly built images
 		sqlForExistingImages = fmt.Sprintf("%s AND built = 'Y'", sqlForExistingImages)
 	}
-	for _, org := range options.Orgs {
-		sqlForExistingImages = fmt.Sprintf("%s AND org_id = %d", sqlForExistingImages, org)
+	if len(options.Orgs) > 0 {
+		sqlForExistingImages = fmt.Sprintf("%s AND org_id IN (%s)", sqlForExistingImages, orgList(options.Orgs))
 	}
 	if options.StartingDate != "" {
 		sqlForExistingImages = fmt.Sprintf("%s AND modified > '%s'::timestamp", sqlForExistingImages, options.StartingDate)
 	}
-	images := sqlUtil.ExecuteQueryWithResults(db, sqlForExistingImages)
+	images, err := sqlUtil.ExecuteQueryWithResults(ctx, db, sqlForExistingImages)
+	if err != nil {
+		return false, err
+	}
 	if len(images) > 0 {
 		dumperOptions := dumper.PrintSqlOptions{
 			OnlyIfParentExistsTables: []string{"suseimageinfochannel"},
@@ -164,22 +189,33 @@ func dumpOSImageTables(db *sql.DB, writer *bufio.Writer, schemaMetadata map[stri
 		for _, image := range images {
 			log.Trace().Msgf("Exporting image id %s", image[0].Value)
 			whereClause := fmt.Sprintf("id = '%s'", image[0].Value)
-			tableImageData := dumper.DataCrawler(db, schemaMetadata, schemaMetadata["suseimageinfo"], whereClause, options.StartingDate)
-			dumper.PrintTableDataOrdered(db, writer, schemaMetadata, schemaMetadata["suseimageinfo"], tableImageData, dumperOptions)
+			tableImageData, err := dumper.DataCrawler(ctx, db, schemaMetadata, schemaMetadata["suseimageinfo"], whereClause, options.StartingDate)
+			if err != nil {
+				return false, err
+			}
+			err = dumper.PrintTableDataOrdered(ctx, db, writer, schemaMetadata, schemaMetadata["suseimageinfo"], tableImageData, dumperOptions)
+			if err != nil {
+				return false, err
+			}
+			reportImageExported(ctx, image)
 			// Check if pillars are already in database
 			if _, ok := tableImageData.TableData["susesaltpillar"]; ok && !options.MetadataOnly {
 				// pillars in database, files must be as well
 				// export all metadata about images, but skip linked suseimageinfo
 				markAsExported(schemaMetadata, []string{"suseimageinfo"})
 				whereClauseImageFiles := fmt.Sprintf("image_info_id = '%s'", image[0].Value)
-				tableImageFilesData := dumper.DataCrawler(db, schemaMetadata, schemaMetadata["suseimagefile"],
-					whereClauseImageFiles, options.StartingDate)
-				dumper.PrintTableDataOrdered(db, writer, schemaMetadata, schemaMetadata["suseimagefile"],
-					tableImageFilesData, dumper.PrintSqlOptions{})
+				err := dumpCrawledTable(ctx, db, writer, schemaMetadata, "suseimagefile", whereClauseImageFiles, options,
+					dumper.PrintSqlOptions{})
+				if err != nil {
+					return false, err
+				}
 				// find all local (not-external) image files for the image and export their files
 				sqlForExistingLocalImageFiles := fmt.Sprintf("SELECT file, org_id FROM suseimagefile AS sif JOIN suseimageinfo AS sii "+
 					"ON sif.image_info_id = sii.id WHERE sii.id = '%s' AND external = 'N'", image[0].Value)
-				imageFiles := sqlUtil.ExecuteQueryWithResults(db, sqlForExistingLocalImageFiles)
+				imageFiles, err := sqlUtil.ExecuteQueryWithResults(ctx, db, sqlForExistingLocalImageFiles)
+				if err != nil {
+					return false, err
+				}
 				for _, imageFile := range imageFiles {
 					// source is taken from basedir + org + filename from db
 					// output should be base abs dir + org + filename from db
@@ -187,7 +223,9 @@ func dumpOSImageTables(db *sql.DB, writer *bufio.Writer, schemaMetadata map[stri
 					org := fmt.Sprintf("%s", imageFile[1].Value)
 					source := osImageDumper.GetImagePathForImage(file, org)
 					target := osImageDumper.GetImagePathForImage(file, org, outputFolderImagesAbs)
-					osImageDumper.DumpOsImage(target, source)
+					if err := osImageDumper.DumpOsImage(ctx, target, source, options.LinkMode); err != nil {
+						return false, err
+					}
 				}
 				// we marked this as exported for image files, now we need to unexport for the rest of the images
 				markAsUnexported(schemaMetadata, []string{"suseimageinfo"})
@@ -198,30 +236,38 @@ func dumpOSImageTables(db *sql.DB, writer *bufio.Writer, schemaMetadata map[stri
 		}
 	}
 
+	if err := warnOrgFilteredImages(ctx, db, options, "kiwi"); err != nil {
+		return false, err
+	}
+
 	log.Info().Msg("Kiwi image export done")
-	return needExtraExport
+	return needExtraExport, nil
 }
 
-func dumpContainerImageTables(db *sql.DB, writer *bufio.Writer, schemaMetadata map[string]schemareader.Table, options DumperOptions) {
+func dumpContainerImageTables(ctx context.Context, db *sql.DB, writer *bufio.Writer, schemaMetadata map[string]schemareader.Table, options DumperOptions) error {
 
 	// Image profiles
 	sqlForExistingProfiles := "SELECT profile_id FROM suseimageprofile WHERE image_type = 'dockerfile'"
-	for _, org := range options.Orgs {
-		sqlForExistingProfiles = fmt.Sprintf("%s AND org_id = %d", sqlForExistingProfiles, org)
+	if len(options.Orgs) > 0 {
+		sqlForExistingProfiles = fmt.Sprintf("%s AND org_id IN (%s)", sqlForExistingProfiles, orgList(options.Orgs))
 	}
 	if options.StartingDate != "" {
 		sqlForExistingProfiles = fmt.Sprintf("%s AND modified > '%s'::timestamp", sqlForExistingProfiles, options.StartingDate)
 	}
-	profiles := sqlUtil.ExecuteQueryWithResults(db, sqlForExistingProfiles)
+	profiles, err := sqlUtil.ExecuteQueryWithResults(ctx, db, sqlForExistingProfiles)
+	if err != nil {
+		return err
+	}
 	if len(profiles) > 0 {
 		log.Debug().Msg("Dumping ImageProfile tables")
 		writer.WriteString("-- Dockerfile Profiles\n")
 		for _, profile := range profiles {
 			log.Trace().Msgf("Exporting profile id %s", profile[0].Value)
 			whereClause := fmt.Sprintf("profile_id = '%s'", profile[0].Value)
-			tableProfilesData := dumper.DataCrawler(db, schemaMetadata, schemaMetadata["susedockerfileprofile"], whereClause, options.StartingDate)
-
-			dumper.PrintTableDataOrdered(db, writer, schemaMetadata, schemaMetadata["susedockerfileprofile"], tableProfilesData, dumper.PrintSqlOptions{})
+			err := dumpCrawledTable(ctx, db, writer, schemaMetadata, "susedockerfileprofile", whereClause, options, dumper.PrintSqlOptions{})
+			if err != nil {
+				return err
+			}
 		}
 		markAsExported(schemaMetadata, []string{"suseimageprofile"})
 	} else {
@@ -229,58 +275,119 @@ func dumpContainerImageTables(db *sql.DB, writer *bufio.Writer, schemaMetadata m
 	}
 
 	// Images
-	sqlForExistingImages := "SELECT id FROM suseimageinfo WHERE image_type = 'dockerfile'"
+	sqlForExistingImages := "SELECT id, name, version FROM suseimageinfo WHERE image_type = 'dockerfile'"
 	if isColumnInTable(schemaMetadata, "suseimageinfo", "built") {
 		// For 4.3 and newer export only succesfuly built images
 		sqlForExistingImages = fmt.Sprintf("%s AND built = 'Y'", sqlForExistingImages)
 	}
-	for _, org := range options.Orgs {
-		sqlForExistingImages = fmt.Sprintf("%s AND org_id = %d", sqlForExistingImages, org)
+	if len(options.Orgs) > 0 {
+		sqlForExistingImages = fmt.Sprintf("%s AND org_id IN (%s)", sqlForExistingImages, orgList(options.Orgs))
 	}
 	if options.StartingDate != "" {
 		sqlForExistingImages = fmt.Sprintf("%s AND modified > '%s'::timestamp", sqlForExistingImages, options.StartingDate)
 	}
-	images := sqlUtil.ExecuteQueryWithResults(db, sqlForExistingImages)
+	images, err := sqlUtil.ExecuteQueryWithResults(ctx, db, sqlForExistingImages)
+	if err != nil {
+		return err
+	}
 	if len(images) > 0 {
 		log.Debug().Msg("Dumping Image tables")
 		writer.WriteString("-- Dockerfile Images\n")
 		for _, image := range images {
 			log.Trace().Msgf("Exporting image id %s", image[0].Value)
 			whereClause := fmt.Sprintf("id = '%s'", image[0].Value)
-			tableImageData := dumper.DataCrawler(db, schemaMetadata, schemaMetadata["suseimageinfo"], whereClause, options.StartingDate)
-			dumper.PrintTableDataOrdered(db, writer, schemaMetadata, schemaMetadata["suseimageinfo"], tableImageData, dumper.PrintSqlOptions{})
+			err := dumpCrawledTable(ctx, db, writer, schemaMetadata, "suseimageinfo", whereClause, options, dumper.PrintSqlOptions{})
+			if err != nil {
+				return err
+			}
+			reportImageExported(ctx, image)
 		}
 	}
+	if err := warnOrgFilteredImages(ctx, db, options, "dockerfile"); err != nil {
+		return err
+	}
 
 	log.Info().Msg("Dockerfile image export done")
+	return nil
+}
+
+// reportImageExported reports the export of the image described by the id, name and version columns of image
+func reportImageExported(ctx context.Context, image []sqlUtil.RowDataStructure) {
+	progress.Report(ctx, progress.Event{Event: progress.ImageExported, Phase: "images",
+		Image: fmt.Sprintf("%v:%v", image[1].Value, image[2].Value)})
+}
+
+// warnOrgFilteredImages reports the images of imageType not exported because they belong to other organizations
+func warnOrgFilteredImages(ctx context.Context, db *sql.DB, options DumperOptions, imageType string) error {
+	if len(options.Orgs) == 0 {
+		return nil
+	}
+	orgs := orgList(options.Orgs)
+	sqlForFilteredImages := fmt.Sprintf("SELECT count(*) FROM suseimageinfo WHERE image_type = '%s' AND org_id NOT IN (%s)",
+		imageType, orgs)
+	rows, err := sqlUtil.ExecuteQueryWithResults(ctx, db, sqlForFilteredImages)
+	if err != nil {
+		return err
+	}
+	if len(rows) > 0 {
+		if count, ok := rows[0][0].Value.(int64); ok && count > 0 {
+			progress.Warn(ctx, "%d %s images of organizations other than %s not exported", count, imageType, orgs)
+		}
+	}
+	return nil
 }
 
 // Main entry point
-func dumpImageData(db *sql.DB, writer *bufio.Writer, options DumperOptions) {
+func dumpImageData(ctx context.Context, db *sql.DB, writer *bufio.Writer, options DumperOptions) error {
 	log.Debug().Msg("Starting image metadata dump")
-	var outputFolderAbs = options.GetOutputFolderAbsPath()
+	outputFolderAbs, err := options.GetOutputFolderAbsPath()
+	if err != nil {
+		return err
+	}
 
 	// export DB data about images
 	log.Trace().Msg("Loading table schema")
-	schemaMetadata := schemareader.ReadTablesSchema(db, imagesTableNames)
+	schemaMetadata, err := schemareader.ReadTablesSchema(db, imagesTableNames)
+	if err != nil {
+		return err
+	}
 
 	if options.OSImages {
 		var outputFolderImagesAbs = filepath.Join(outputFolderAbs, "images")
-		ValidateExportFolder(outputFolderImagesAbs)
-		dumpImageStores(db, writer, schemaMetadata, options, "os_image")
-		if dumpOSImageTables(db, writer, schemaMetadata, options, outputFolderImagesAbs) {
+		if err := ValidateExportFolder(outputFolderImagesAbs); err != nil {
+			return err
+		}
+		if err := dumpImageStores(ctx, db, writer, schemaMetadata, options, "os_image"); err != nil {
+			return err
+		}
+		needExtraExport, err := dumpOSImageTables(ctx, db, writer, schemaMetadata, options, outputFolderImagesAbs)
+		if err != nil {
+			return err
+		}
+		if needExtraExport {
 			var outputFolderPillarAbs = filepath.Join(outputFolderAbs, "images", "pillars")
-			ValidateExportFolder(outputFolderPillarAbs)
-			pillarDumper.DumpImagePillars(outputFolderPillarAbs, options.Orgs, options.ServerConfig)
+			if err := ValidateExportFolder(outputFolderPillarAbs); err != nil {
+				return err
+			}
+			if err := pillarDumper.DumpImagePillars(outputFolderPillarAbs, options.Orgs, options.ServerConfig); err != nil {
+				return err
+			}
 			if !options.MetadataOnly {
-				osImageDumper.DumpOsImages(outputFolderImagesAbs, options.Orgs)
+				if err := osImageDumper.DumpOsImages(ctx, outputFolderImagesAbs, options.Orgs, options.LinkMode); err != nil {
+					return err
+				}
 			}
 		}
 		// This is needed for containers to be able to export their respective tables
 		markAsUnexported(schemaMetadata, []string{"suseimagestore", "suseimageprofile"})
 	}
 	if options.Containers {
-		dumpImageStores(db, writer, schemaMetadata, options, "registry")
-		dumpContainerImageTables(db, writer, schemaMetadata, options)
+		if err := dumpImageStores(ctx, db, writer, schemaMetadata, options, "registry"); err != nil {
+			return err
+		}
+		if err := dumpContainerImageTables(ctx, db, writer, schemaMetadata, options); err != nil {
+			return err
+		}
 	}
+	return nil
 }
@@ -0,0 +1,113 @@
+// SPDX-FileCopyrightText: 2023 SUSE LLC
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package entityDumper
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+
+	"github.com/lib/pq"
+	"github.com/rs/zerolog/log"
+	"github.com/uyuni-project/inter-server-sync/dumper"
+	"github.com/uyuni-project/inter-server-sync/schemareader"
+	"github.com/uyuni-project/inter-server-sync/sqlUtil"
+)
+
+// diffContentPaths joins the channel content tables through the channel links,
+// so the diff shows the packages and errata of the channel and not the ones reached by other relations
+var diffContentPaths = map[string][]string{
+	"rhnerrata":  {"rhnchannel", "rhnchannelerrata", "rhnerrata"},
+	"rhnpackage": {"rhnchannel", "rhnchannelpackage", "rhnpackage"},
+}
+
+// diffTableNames are the tables compared by the import diff: the channel, its content and the tables cleaned by the import
+func diffTableNames() []string {
+	return append([]string{"rhnchannel", "rhnerrata", "rhnpackage"}, tablesToClean...)
+}
+
+type ChannelDiff struct {
+	ChannelLabel string
+	Tables       []dumper.TableDiff
+}
+
+// DiffImport computes the changes an export would apply to the software channels of the target database.
+// The SQL statements are executed in a transaction which is always rolled back.
+// The nextval calls of the inserts are not transactional: the sequences of the target database still advance.
+func DiffImport(ctx context.Context, db *sql.DB, channelLabels []string, sqlStatements io.Reader) ([]ChannelDiff, error) {
+	schemaMetadata, err := schemareader.ReadTablesSchema(db, SoftwareChannelTableNames())
+	if err != nil {
+		return nil, err
+	}
+	paths := dumper.ExistingRecordsPaths(schemaMetadata, schemaMetadata["rhnchannel"])
+	for tableName, path := range diffContentPaths {
+		paths[tableName] = path
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// the resolved natural keys are cached: each snapshot has its own resolver, so the changes of the import
+	// to the referenced rows are seen in the imported data
+	resolver := dumper.NewNaturalKeyResolver(tx, schemaMetadata)
+	before := make(map[string][]dumper.TableSnapshot)
+	for _, channelLabel := range channelLabels {
+		log.Debug().Msgf("Reading current data for channel %s", channelLabel)
+		before[channelLabel], err = readChannelSnapshots(ctx, tx, schemaMetadata, paths, channelLabel, resolver)
+		if err != nil {
+			return nil, fmt.Errorf("error reading current data for channel %s: %w", channelLabel, err)
+		}
+	}
+
+	log.Info().Msg("Applying export in a transaction")
+	count, err := sqlUtil.ExecuteStatements(ctx, tx, sqlStatements, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error applying the export to the target database: %w", err)
+	}
+	log.Debug().Msgf("%d statements applied", count)
+
+	resolver = dumper.NewNaturalKeyResolver(tx, schemaMetadata)
+	result := make([]ChannelDiff, 0, len(channelLabels))
+	for _, channelLabel := range channelLabels {
+		log.Debug().Msgf("Reading imported data for channel %s", channelLabel)
+		after, err := readChannelSnapshots(ctx, tx, schemaMetadata, paths, channelLabel, resolver)
+		if err != nil {
+			return nil, fmt.Errorf("error reading imported data for channel %s: %w", channelLabel, err)
+		}
+		channelDiff := ChannelDiff{ChannelLabel: channelLabel, Tables: make([]dumper.TableDiff, 0)}
+		for i, snapshot := range after {
+			tableDiff := dumper.DiffTableSnapshots(before[channelLabel][i], snapshot)
+			if !tableDiff.IsEmpty() {
+				channelDiff.Tables = append(channelDiff.Tables, tableDiff)
+			}
+		}
+		result = append(result, channelDiff)
+	}
+	return result, nil
+}
+
+func readChannelSnapshots(ctx context.Context, tx *sql.Tx, schemaMetadata map[string]schemareader.Table, paths map[string][]string,
+	channelLabel string, resolver *dumper.NaturalKeyResolver) ([]dumper.TableSnapshot, error) {
+
+	whereClause := fmt.Sprintf(`WHERE rhnchannel.id = (SELECT id FROM rhnchannel WHERE label = %s)`, pq.QuoteLiteral(channelLabel))
+	snapshots := make([]dumper.TableSnapshot, 0)
+	for _, tableName := range diffTableNames() {
+		table, okTable := schemaMetadata[tableName]
+		path, okPath := paths[tableName]
+		if !okTable || !okPath {
+			continue
+		}
+		snapshot, err := dumper.ReadTableSnapshot(ctx, tx, schemaMetadata, table, path, whereClause, resolver)
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	return snapshots, nil
+}
@@ -0,0 +1,66 @@
+// SPDX-FileCopyrightText: 2023 SUSE LLC
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package entityDumper
+
+import (
+	"fmt"
+
+	"github.com/lib/pq"
+	"github.com/uyuni-project/inter-server-sync/schemareader"
+)
+
+var packageArchSql = "select label from rhnpackagearch where label = $1"
+
+// packageLinkColumns maps the tables linking packages to the column holding the package id
+var packageLinkColumns = map[string]string{
+	"rhnpackage":           "id",
+	"rhnchannelpackage":    "package_id",
+	"rhnerratapackage":     "package_id",
+	"rhnerratafilepackage": "package_id",
+}
+
+// addPackageFilter restricts the package links of schemaMetadata to the packages returned by packagesQuery.
+// The rows of other packages are neither crawled nor cleaned, so the target server keeps the ones it already has.
+func addPackageFilter(schemaMetadata map[string]schemareader.Table, packagesQuery string) {
+	for tableName, column := range packageLinkColumns {
+		table, ok := schemaMetadata[tableName]
+		if !ok {
+			continue
+		}
+		table.AddRowFilter(fmt.Sprintf("%s.%s IN (%s)", tableName, column, packagesQuery))
+		schemaMetadata[tableName] = table
+	}
+}
+
+// packageArchsQuery selects the packages with one of the architectures
+func packageArchsQuery(archs []string) string {
+	return fmt.Sprintf("SELECT p.id FROM rhnpackage p JOIN rhnpackagearch a ON a.id = p.package_arch_id WHERE a.label IN (%s)",
+		quoteLiterals(archs, ""))
+}
+
+// latestPackagesQuery selects the packages of the channel among the newest versions of each package name and architecture,
+// as ordered by rhnpackageevr
+func latestPackagesQuery(channelLabel string, versions int) string {
+	return fmt.Sprintf(`SELECT ranked.package_id FROM (SELECT cp.package_id,
+		dense_rank() OVER (PARTITION BY p.name_id, p.package_arch_id ORDER BY e.evr DESC) AS version_rank
+		FROM rhnchannelpackage cp
+		JOIN rhnpackage p ON p.id = cp.package_id
+		JOIN rhnpackageevr e ON e.id = p.evr_id
+		WHERE cp.channel_id = (SELECT id FROM rhnchannel WHERE label = %s)) ranked
+		WHERE ranked.version_rank <= %d`, pq.QuoteLiteral(channelLabel), versions)
+}
+
+// withoutPackageLinksClean returns the tables to clean except the ones linking packages to channels and errata
+func withoutPackageLinksClean(tables []string) []string {
+	return withoutTables(tables, []string{"rhnchannelpackage", "rhnerratapackage", "rhnerratafilepackage"})
+}
+
+func copySchema(schemaMetadata map[string]schemareader.Table) map[string]schemareader.Table {
+	result := make(map[string]schemareader.Table, len(schemaMetadata))
+	for name, table := range schemaMetadata {
+		result[name] = table
+	}
+	return result
+}
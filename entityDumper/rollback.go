@@ -0,0 +1,223 @@
+// SPDX-FileCopyrightText: 2023 SUSE LLC
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package entityDumper
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/rs/zerolog/log"
+	"github.com/uyuni-project/inter-server-sync/dumper"
+	"github.com/uyuni-project/inter-server-sync/schemareader"
+	"github.com/uyuni-project/inter-server-sync/sqlUtil"
+	"github.com/uyuni-project/inter-server-sync/utils"
+)
+
+// RollbackContent lists the entities of an import saved in a rollback bundle
+type RollbackContent struct {
+	Channels       []string
+	ConfigChannels []string
+	// Images are identified by name and version, as name:version
+	Images []string
+}
+
+// rollbackGroup describes how to save the entities of one kind, all linked to a row of rootTable
+type rollbackGroup struct {
+	kind           string
+	schemaMetadata map[string]schemareader.Table
+	rootTable      string
+	tablesToClean  []string
+	labels         []string
+	// whereClause selects the row of rootTable of an entity
+	whereClause func(label string) string
+	// deleteStatement deletes the row of rootTable of an entity created by the import
+	deleteStatement func(label string) string
+	// restored writes the statements run once an existing entity is restored
+	restored func(label string, writer *bufio.Writer)
+}
+
+// PrintRollbackStatements writes the statements restoring the entities of content as they are now in db,
+// reading every table an import of them touches with the joins of the clean statements.
+// Rows created later in these tables and entities missing from db are deleted by the rollback.
+func PrintRollbackStatements(ctx context.Context, db *sql.DB, content RollbackContent, writer *bufio.Writer) error {
+	groups := make([]rollbackGroup, 0, 3)
+	tableNames := make([]string, 0)
+	if len(content.Channels) > 0 {
+		schemaMetadata, err := schemareader.ReadTablesSchema(db, SoftwareChannelTableNames())
+		if err != nil {
+			return err
+		}
+		groups = append(groups, channelsRollbackGroup(schemaMetadata, content.Channels))
+		tableNames = append(tableNames, SoftwareChannelTableNames()...)
+	}
+	if len(content.ConfigChannels) > 0 {
+		schemaMetadata, err := schemareader.ReadTablesSchema(db, ConfigTableNames())
+		if err != nil {
+			return err
+		}
+		groups = append(groups, configChannelsRollbackGroup(schemaMetadata, content.ConfigChannels))
+		tableNames = append(tableNames, ConfigTableNames()...)
+	}
+	if len(content.Images) > 0 {
+		schemaMetadata, err := schemareader.ReadTablesSchema(db, imagesTableNames)
+		if err != nil {
+			return err
+		}
+		groups = append(groups, imagesRollbackGroup(schemaMetadata, content.Images))
+		tableNames = append(tableNames, imagesTableNames...)
+	}
+	// the rows created by the import are only deleted when no row of any of these tables references them anymore
+	references, err := schemareader.ReadTablesSchema(db, tableNames)
+	if err != nil {
+		return err
+	}
+
+	// the rows are read in a single transaction, to be consistent between tables
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true, Isolation: sql.LevelRepeatableRead})
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+	return printRollbackStatements(ctx, tx, groups, references, writer)
+}
+
+func channelsRollbackGroup(schemaMetadata map[string]schemareader.Table, labels []string) rollbackGroup {
+	return rollbackGroup{
+		kind:           "channel",
+		schemaMetadata: schemaMetadata,
+		rootTable:      "rhnchannel",
+		tablesToClean:  tablesToClean,
+		labels:         labels,
+		whereClause: func(label string) string {
+			return fmt.Sprintf(`WHERE rhnchannel.id = (SELECT id FROM rhnchannel WHERE label = %s)`, pq.QuoteLiteral(label))
+		},
+		deleteStatement: func(label string) string {
+			return fmt.Sprintf("DELETE FROM rhnchannel WHERE label = %s;", pq.QuoteLiteral(label))
+		},
+		// the repository metadata and the caches are computed again from the restored content
+		restored: generateCacheCalculation,
+	}
+}
+
+func configChannelsRollbackGroup(schemaMetadata map[string]schemareader.Table, labels []string) rollbackGroup {
+	return rollbackGroup{
+		kind:           "configuration channel",
+		schemaMetadata: schemaMetadata,
+		rootTable:      "rhnconfigchannel",
+		tablesToClean:  tablesToClean,
+		labels:         labels,
+		whereClause: func(label string) string {
+			return fmt.Sprintf(`WHERE rhnconfigchannel.id IN (SELECT id FROM rhnconfigchannel WHERE label = %s)`, pq.QuoteLiteral(label))
+		},
+		deleteStatement: func(label string) string {
+			return fmt.Sprintf("DELETE FROM rhnconfigchannel WHERE label = %s;", pq.QuoteLiteral(label))
+		},
+		restored: func(label string, writer *bufio.Writer) {},
+	}
+}
+
+func imagesRollbackGroup(schemaMetadata map[string]schemareader.Table, labels []string) rollbackGroup {
+	imageCondition := func(label string) string {
+		name, version, _ := strings.Cut(label, ":")
+		return fmt.Sprintf("name = %s AND version = %s", pq.QuoteLiteral(name), pq.QuoteLiteral(version))
+	}
+	return rollbackGroup{
+		kind:           "image",
+		schemaMetadata: schemaMetadata,
+		rootTable:      "suseimageinfo",
+		tablesToClean:  tablesToClean_images,
+		labels:         labels,
+		whereClause: func(label string) string {
+			return fmt.Sprintf(`WHERE suseimageinfo.id IN (SELECT id FROM suseimageinfo WHERE %s)`, imageCondition(label))
+		},
+		deleteStatement: func(label string) string {
+			return fmt.Sprintf("DELETE FROM suseimageinfo WHERE %s;", imageCondition(label))
+		},
+		restored: func(label string, writer *bufio.Writer) {},
+	}
+}
+
+func printRollbackStatements(ctx context.Context, db sqlUtil.Querier, groups []rollbackGroup,
+	references map[string]schemareader.Table, writer *bufio.Writer) error {
+
+	paths := make([]map[string][]string, len(groups))
+	tableNames := make([]string, 0)
+	for i, group := range groups {
+		paths[i] = dumper.ExistingRecordsPaths(group.schemaMetadata, group.schemaMetadata[group.rootTable])
+		for tableName := range paths[i] {
+			if !utils.Contains(tableNames, tableName) {
+				tableNames = append(tableNames, tableName)
+			}
+		}
+	}
+	sort.Strings(tableNames)
+	lastIds, err := dumper.ReadLastIds(ctx, db, references, tableNames)
+	if err != nil {
+		return err
+	}
+	// the rows of the entities created by the import are deleted with them
+	createdRowsTables := make([]string, 0, len(tableNames))
+	for _, tableName := range tableNames {
+		isRoot := false
+		for _, group := range groups {
+			isRoot = isRoot || group.rootTable == tableName
+		}
+		if !isRoot {
+			createdRowsTables = append(createdRowsTables, tableName)
+		}
+	}
+
+	var restores bytes.Buffer
+	restoresWriter := bufio.NewWriter(&restores)
+	newEntities := make([][]string, len(groups))
+	writer.WriteString("BEGIN;\n")
+	dumper.PrintCreatedRowsTables(writer, references, createdRowsTables, lastIds)
+	for i, group := range groups {
+		newEntities[i] = make([]string, 0)
+		for _, label := range group.labels {
+			log.Debug().Msgf("Reading current data for %s %s", group.kind, label)
+			whereClause := group.whereClause(label)
+			root := group.schemaMetadata[group.rootTable]
+			existing, err := sqlUtil.ExecuteQueryWithResults(ctx, db, fmt.Sprintf("SELECT 1 FROM %s %s;", root.Name, whereClause))
+			if err != nil {
+				return err
+			}
+			dumper.PrintCreatedRowsCollection(writer, group.schemaMetadata, paths[i], createdRowsTables, whereClause, lastIds)
+			if len(existing) == 0 {
+				newEntities[i] = append(newEntities[i], label)
+				continue
+			}
+			restoresWriter.WriteString(fmt.Sprintf("-- %s %s\n", group.kind, label))
+			if err := dumper.PrintRollbackStatements(ctx, db, restoresWriter, group.schemaMetadata, paths[i],
+				group.tablesToClean, whereClause); err != nil {
+				return fmt.Errorf("error reading current data for %s %s: %w", group.kind, label, err)
+			}
+			group.restored(label, restoresWriter)
+		}
+	}
+	if err := restoresWriter.Flush(); err != nil {
+		return err
+	}
+	writer.Write(restores.Bytes())
+
+	writer.WriteString("-- rows created by the import\n")
+	dumper.PrintCreatedRowsDeletion(writer, references, createdRowsTables, lastIds)
+	// the entities are imported parents first: their children are deleted before them,
+	// parent_channel does not cascade
+	for i, group := range groups {
+		for j := len(newEntities[i]) - 1; j >= 0; j-- {
+			writer.WriteString(fmt.Sprintf("-- new %s %s\n", group.kind, newEntities[i][j]))
+			writer.WriteString(group.deleteStatement(newEntities[i][j]) + "\n")
+		}
+	}
+	writer.WriteString("COMMIT;\n")
+	return writer.Flush()
+}
@@ -0,0 +1,197 @@
+// SPDX-FileCopyrightText: 2023 SUSE LLC
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package entityDumper
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/uyuni-project/inter-server-sync/schemareader"
+	"github.com/uyuni-project/inter-server-sync/sqlUtil"
+	"github.com/uyuni-project/inter-server-sync/tests"
+)
+
+// rollbackSchema is a channel with a cleaned link table to packages
+func rollbackSchema() map[string]schemareader.Table {
+	channelReference := schemareader.Reference{TableName: "rhnchannel", ColumnMapping: map[string]string{"channel_id": "id"}}
+	packageReference := schemareader.Reference{TableName: "rhnpackage", ColumnMapping: map[string]string{"package_id": "id"}}
+	channelPackageReference := schemareader.Reference{TableName: "rhnchannelpackage", ColumnMapping: map[string]string{"package_id": "id"}}
+	return map[string]schemareader.Table{
+		"rhnchannel": {
+			Name:                "rhnchannel",
+			Export:              true,
+			Columns:             []string{"id", "label"},
+			PKColumns:           map[string]bool{"id": true},
+			MainUniqueIndexName: "rhn_channel_label_uq",
+			UniqueIndexes:       map[string]schemareader.UniqueIndex{"rhn_channel_label_uq": {Name: "rhn_channel_label_uq", Columns: []string{"label"}}},
+			ReferencedBy:        []schemareader.Reference{{TableName: "rhnchannelpackage", ColumnMapping: map[string]string{"channel_id": "id"}}},
+		},
+		"rhnchannelpackage": {
+			Name:                "rhnchannelpackage",
+			Export:              true,
+			Columns:             []string{"channel_id", "package_id"},
+			PKColumns:           map[string]bool{},
+			MainUniqueIndexName: "rhn_cp_cp_uq",
+			UniqueIndexes:       map[string]schemareader.UniqueIndex{"rhn_cp_cp_uq": {Name: "rhn_cp_cp_uq", Columns: []string{"channel_id", "package_id"}}},
+			References:          []schemareader.Reference{channelReference, packageReference},
+		},
+		"rhnpackage": {
+			Name:                "rhnpackage",
+			Export:              true,
+			Columns:             []string{"id", "name"},
+			PKColumns:           map[string]bool{"id": true},
+			MainUniqueIndexName: "rhn_package_name_uq",
+			UniqueIndexes:       map[string]schemareader.UniqueIndex{"rhn_package_name_uq": {Name: "rhn_package_name_uq", Columns: []string{"name"}}},
+			ReferencedBy:        []schemareader.Reference{channelPackageReference},
+		},
+	}
+}
+
+const baseWhereClause = "WHERE rhnchannel.id = (SELECT id FROM rhnchannel WHERE label = 'base')"
+
+// printTestRollbackStatements writes the rollback statements of the existing channel base, linked to package 5, and of
+// a new base channel and its child, in the import order
+func printTestRollbackStatements(t *testing.T) string {
+	repo := tests.CreateDataRepository()
+	repo.ExpectWithRecords("SELECT COALESCE(MAX(id), 0) FROM rhnchannel;", sqlmock.NewRows([]string{"coalesce"}).AddRow("3"))
+	repo.ExpectWithRecords("SELECT COALESCE(MAX(id), 0) FROM rhnpackage;", sqlmock.NewRows([]string{"coalesce"}).AddRow("7"))
+	repo.ExpectWithRecords("SELECT 1 FROM rhnchannel "+baseWhereClause+";", sqlmock.NewRows([]string{"?column?"}).AddRow("1"))
+	repo.ExpectWithRecords("SELECT rhnchannel.id, rhnchannel.label FROM rhnchannel  "+baseWhereClause+";",
+		sqlmock.NewRows([]string{"id", "label"}).AddRow("1", "base"))
+	repo.ExpectWithRecords("SELECT rhnpackage.id, rhnpackage.name FROM rhnpackage  "+
+		"INNER JOIN rhnchannelpackage on rhnchannelpackage.package_id = rhnpackage.id "+
+		"INNER JOIN rhnchannel on rhnchannel.id = rhnchannelpackage.channel_id "+baseWhereClause+";",
+		sqlmock.NewRows([]string{"id", "name"}).AddRow("5", "vim"))
+	repo.ExpectWithRecords("SELECT rhnchannelpackage.channel_id, rhnchannelpackage.package_id FROM rhnchannelpackage  "+
+		"INNER JOIN rhnchannel on rhnchannel.id = rhnchannelpackage.channel_id "+baseWhereClause+";",
+		sqlmock.NewRows([]string{"channel_id", "package_id"}).AddRow("1", "5"))
+	repo.ExpectWithRecords("SELECT 1 FROM rhnchannel WHERE rhnchannel.id = (SELECT id FROM rhnchannel WHERE label = 'new-base');",
+		sqlmock.NewRows([]string{"?column?"}))
+	repo.ExpectWithRecords("SELECT 1 FROM rhnchannel WHERE rhnchannel.id = (SELECT id FROM rhnchannel WHERE label = 'new-child');",
+		sqlmock.NewRows([]string{"?column?"}))
+
+	schemaMetadata := rollbackSchema()
+	groups := []rollbackGroup{channelsRollbackGroup(schemaMetadata, []string{"base", "new-base", "new-child"})}
+	if err := printRollbackStatements(context.Background(), repo.DB, groups, schemaMetadata, repo.Writer); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+	return strings.Join(repo.GetWriterBuffer(), "")
+}
+
+// collectCreatedRows are the statements collecting the rows created by the import for channel label
+func collectCreatedRows(label string) []string {
+	whereClause := "WHERE rhnchannel.id = (SELECT id FROM rhnchannel WHERE label = '" + label + "')"
+	return []string{
+		"INSERT INTO rollback_rhnchannelpackage SELECT rhnchannelpackage.channel_id, rhnchannelpackage.package_id " +
+			"FROM rhnchannelpackage  INNER JOIN rhnchannel on rhnchannel.id = rhnchannelpackage.channel_id " + whereClause +
+			" AND (rhnchannelpackage.channel_id > '3' OR rhnchannelpackage.package_id > '7');",
+		"INSERT INTO rollback_rhnpackage SELECT rhnpackage.id FROM rhnpackage  " +
+			"INNER JOIN rhnchannelpackage on rhnchannelpackage.package_id = rhnpackage.id " +
+			"INNER JOIN rhnchannel on rhnchannel.id = rhnchannelpackage.channel_id " + whereClause + " AND (rhnpackage.id > '7');",
+	}
+}
+
+func expectedRollbackStatements() []string {
+	statements := []string{
+		"BEGIN;",
+		"CREATE TEMPORARY TABLE rollback_rhnchannelpackage ON COMMIT DROP AS SELECT channel_id, package_id FROM rhnchannelpackage WITH NO DATA;",
+		"CREATE TEMPORARY TABLE rollback_rhnpackage ON COMMIT DROP AS SELECT id FROM rhnpackage WITH NO DATA;",
+	}
+	// the rows created by the import are collected before the links are restored
+	statements = append(statements, collectCreatedRows("base")...)
+	statements = append(statements, collectCreatedRows("new-base")...)
+	statements = append(statements, collectCreatedRows("new-child")...)
+	return append(statements,
+		// the rows of the tables not cleaned are updated
+		"UPDATE rhnchannel SET label = 'base' WHERE id = '1';",
+		"UPDATE rhnpackage SET name = 'vim' WHERE id = '5';",
+		// then the cleaned tables are restored
+		"DELETE FROM rhnchannelpackage WHERE (channel_id,package_id) IN (SELECT rhnchannelpackage.channel_id, rhnchannelpackage.package_id "+
+			"FROM rhnchannelpackage  INNER JOIN rhnchannel on rhnchannel.id = rhnchannelpackage.channel_id "+baseWhereClause+");",
+		"INSERT INTO rhnchannelpackage (channel_id, package_id) VALUES ('1', '5') ON CONFLICT DO NOTHING;",
+		// then the caches are computed again
+		"update rhnchannel set modified = current_timestamp where label = 'base';",
+		"select rhn_channel.update_needed_cache((select id from rhnchannel where label ='base'));",
+		"select rhn_channel.refresh_newest_package((select id from rhnchannel where label ='base'), 'inter-server-sync');",
+		"INSERT INTO rhnRepoRegenQueue\n\t\t(id, channel_label, client, reason, force, bypass_filters, next_action, created, modified)\n"+
+			"\t\tVALUES (null, 'base', 'inter server sync v2', 'channel sync', 'N', 'N', current_timestamp, current_timestamp, current_timestamp);",
+		// the created rows are deleted, the links before the packages, which are kept if other channels use them
+		"DELETE FROM rhnchannelpackage WHERE (channel_id, package_id) IN (SELECT channel_id, package_id FROM rollback_rhnchannelpackage);",
+		"DELETE FROM rhnpackage WHERE (id) IN (SELECT id FROM rollback_rhnpackage) "+
+			"AND NOT EXISTS (SELECT 1 FROM rhnchannelpackage referencing WHERE referencing.package_id = rhnpackage.id);",
+		// the new channels are deleted last, the child before its parent
+		"DELETE FROM rhnchannel WHERE label = 'new-child';",
+		"DELETE FROM rhnchannel WHERE label = 'new-base';",
+		"COMMIT;",
+	)
+}
+
+func TestPrintRollbackStatements(t *testing.T) {
+	// Arrange
+	expected := expectedRollbackStatements()
+
+	// Act
+	rollbackStatements := printTestRollbackStatements(t)
+
+	// Assert
+	scanner := sqlUtil.NewStatementScanner(strings.NewReader(rollbackStatements))
+	statements := make([]string, 0)
+	for scanner.Scan() {
+		statements = append(statements, scanner.Statement())
+	}
+	if !reflect.DeepEqual(statements, expected) {
+		t.Errorf("expected %q, got %q", expected, statements)
+	}
+}
+
+func TestExecuteRollbackStatements(t *testing.T) {
+	// Arrange
+	rollbackStatements := printTestRollbackStatements(t)
+	expected := expectedRollbackStatements()
+	// BEGIN and COMMIT are left to the transaction of the rollback
+	expected = expected[1 : len(expected)-1]
+	executor := tests.CreateDataRepository()
+	executor.ExpectBegin()
+	for _, statement := range expected {
+		executor.ExpectExec(statement, 1)
+	}
+	tx, err := executor.DB.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Act
+	count, err := sqlUtil.ExecuteStatements(context.Background(), tx, strings.NewReader(rollbackStatements), nil)
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != len(expected) {
+		t.Errorf("expected %d statements executed, got %d", len(expected), count)
+	}
+	if err := executor.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestImagesRollbackGroup(t *testing.T) {
+	group := imagesRollbackGroup(map[string]schemareader.Table{}, []string{"sles15:1.0.0"})
+
+	if whereClause := group.whereClause("sles15:1.0.0"); whereClause !=
+		"WHERE suseimageinfo.id IN (SELECT id FROM suseimageinfo WHERE name = 'sles15' AND version = '1.0.0')" {
+		t.Errorf("unexpected image where clause %s", whereClause)
+	}
+	if statement := group.deleteStatement("sles15:1.0.0"); statement !=
+		"DELETE FROM suseimageinfo WHERE name = 'sles15' AND version = '1.0.0';" {
+		t.Errorf("unexpected new image delete statement %s", statement)
+	}
+}
@@ -19,14 +19,79 @@ type DumperOptions struct {
 	StartingDate              string
 	Containers                bool
 	OSImages                  bool
-	Orgs                      []uint
+	// Orgs limits the exported channels, configuration channels and images to these organizations and vendor content
+	Orgs        []uint
+	Compression string
+	// LinkMode tells how package and image files are put in the export, see the dumper link modes. They are copied when not set.
+	LinkMode string
+	// Products select the channels of products, identified as name/version[/arch]
+	Products        []string
+	ChannelFamilies []string
+	// ClmEnvironments select the channels built for content lifecycle management environments, as project:environment
+	ClmEnvironments []string
+	// AllVendorChannels selects the channels of no organization, only the ones with content with VendorChannelsWithContent
+	AllVendorChannels         bool
+	VendorChannelsWithContent bool
+	// AllCustomChannels selects the custom channels of Orgs
+	AllCustomChannels bool
+	// ResolveDependencies adds the base channels and clone originals of the selected channels to the export
+	ResolveDependencies bool
+	// ErrataOnly exports the errata of the channels, without their packages
+	ErrataOnly bool
+	// PackageArchs limits the exported packages to the ones with these architecture labels
+	PackageArchs []string
+	// LatestPackageVersions keeps only the newest versions of each package of a channel, when greater than 0
+	LatestPackageVersions int
+	// ErrataTypes, ErrataSeverities and ErrataIssuedAfter limit the exported errata, and the packages linked only to others
+	ErrataTypes       []string
+	ErrataSeverities  []string
+	ErrataIssuedAfter string
+	// AsOf exports the channels with the packages and errata they had at that time
+	AsOf string
+	// Slim leaves the package changelogs and file lists out of the export
+	Slim bool
+	// ExcludedTables are software channel tables left out of the export
+	ExcludedTables []string
 }
 
-func (opt *DumperOptions) GetOutputFolderAbsPath() string {
+// hasChannelSelection returns true if options select software channels
+func (opt *DumperOptions) hasChannelSelection() bool {
+	return len(opt.ChannelLabels) > 0 || len(opt.ChannelWithChildrenLabels) > 0 ||
+		len(opt.Products) > 0 || len(opt.ChannelFamilies) > 0 || len(opt.ClmEnvironments) > 0 ||
+		opt.AllVendorChannels || opt.AllCustomChannels
+}
+
+// excludedTables returns the software channel tables left out of the export
+func (opt *DumperOptions) excludedTables() []string {
+	if opt.Slim {
+		return append(append([]string{}, slimTableNames...), opt.ExcludedTables...)
+	}
+	return opt.ExcludedTables
+}
+
+// Compression of the exported SQL statements, gzip when not set
+const (
+	CompressionGzip = "gzip"
+	CompressionNone = "none"
+)
+
+func (opt *DumperOptions) GetOutputFolderAbsPath() (string, error) {
 	if "" == opt.outputFolderAbsPath {
-		opt.outputFolderAbsPath = utils.GetAbsPath(opt.OutputFolder)
+		path, err := utils.GetAbsPath(opt.OutputFolder)
+		if err != nil {
+			return "", err
+		}
+		opt.outputFolderAbsPath = path
 	}
-	return opt.outputFolderAbsPath
+	return opt.outputFolderAbsPath, nil
+}
+
+// ExportSummary lists the software and configuration channels written by DumpAllEntities
+type ExportSummary struct {
+	Channels       []string
+	ConfigChannels []string
+	// DroppedRelations describes the relations to base channels and clone originals left out of the export
+	DroppedRelations []string
 }
 
 type channelsProcess struct {
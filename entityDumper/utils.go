@@ -8,31 +8,45 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strconv"
+	"strings"
 
-	"github.com/rs/zerolog/log"
 	"github.com/uyuni-project/inter-server-sync/utils"
 )
 
-func ValidateExportFolder(outputFolderAbs string) {
-	ValidateExistingFolder(outputFolderAbs)
+func ValidateExportFolder(outputFolderAbs string) error {
+	if err := ValidateExistingFolder(outputFolderAbs); err != nil {
+		return err
+	}
 	outputFolder, _ := os.Open(outputFolderAbs)
 	defer outputFolder.Close()
 	_, errEmpty := outputFolder.Readdirnames(1) // Or f.Readdir(1)
 	if errEmpty != io.EOF {
-		log.Fatal().Msg(fmt.Sprintf("Export location is not empty: %s", outputFolderAbs))
+		return fmt.Errorf("export location is not empty: %s", outputFolderAbs)
 	}
+	return nil
 }
 
-func ValidateExistingFolder(outputFolderAbs string) {
+func ValidateExistingFolder(outputFolderAbs string) error {
 	err := utils.FolderExists(outputFolderAbs)
 	if err != nil {
 		if os.IsNotExist(err) {
 			err := os.MkdirAll(outputFolderAbs, 0755)
 			if err != nil {
-				log.Fatal().Err(err).Msg("Error creating directory")
+				return fmt.Errorf("error creating directory %s: %w", outputFolderAbs, err)
 			}
 		} else {
-			log.Fatal().Err(err).Msg("Error getting output folder")
+			return fmt.Errorf("error getting output folder %s: %w", outputFolderAbs, err)
 		}
 	}
+	return nil
+}
+
+// orgList formats the organization ids for an SQL IN list
+func orgList(orgs []uint) string {
+	ids := make([]string, 0, len(orgs))
+	for _, org := range orgs {
+		ids = append(ids, strconv.FormatUint(uint64(org), 10))
+	}
+	return strings.Join(ids, ",")
 }
@@ -0,0 +1,119 @@
+// SPDX-FileCopyrightText: 2023 SUSE LLC
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package entityDumper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/uyuni-project/inter-server-sync/dumper"
+	"github.com/uyuni-project/inter-server-sync/schemareader"
+	"github.com/uyuni-project/inter-server-sync/sqlUtil"
+	"github.com/uyuni-project/inter-server-sync/utils"
+)
+
+// ErrInvalidOptions is wrapped by the errors about options selecting entities which cannot be exported
+var ErrInvalidOptions = errors.New("invalid options")
+
+var configChannelSql = "select label from rhnconfigchannel where label = $1"
+
+var orgSql = "select id from web_customer where id = $1"
+
+// ValidateOptions checks the entities selected by options exist in the database, before anything is exported.
+// All the problems found are returned together.
+func ValidateOptions(ctx context.Context, options DumperOptions) error {
+	if options.Compression != "" && options.Compression != CompressionGzip && options.Compression != CompressionNone {
+		return fmt.Errorf("%w: unsupported compression %q, supported values are %s and %s",
+			ErrInvalidOptions, options.Compression, CompressionGzip, CompressionNone)
+	}
+	if options.LinkMode != "" && !utils.Contains(dumper.LinkModes, options.LinkMode) {
+		return fmt.Errorf("%w: unsupported link mode %q, supported values are %s", ErrInvalidOptions, options.LinkMode,
+			strings.Join(dumper.LinkModes, ", "))
+	}
+	if options.LatestPackageVersions < 0 {
+		return fmt.Errorf("%w: invalid number of package versions %d", ErrInvalidOptions, options.LatestPackageVersions)
+	}
+	for _, errataType := range options.ErrataTypes {
+		if !utils.Contains(ErrataTypes, errataType) {
+			return fmt.Errorf("%w: unknown errata type %q, supported types are %s", ErrInvalidOptions, errataType,
+				strings.Join(ErrataTypes, ", "))
+		}
+	}
+	for _, severity := range options.ErrataSeverities {
+		if !utils.Contains(ErrataSeverities, severity) {
+			return fmt.Errorf("%w: unknown errata severity %q, supported severities are %s", ErrInvalidOptions, severity,
+				strings.Join(ErrataSeverities, ", "))
+		}
+	}
+	if _, ok := utils.ValidateDate(options.ErrataIssuedAfter); !ok {
+		return fmt.Errorf("%w: unable to validate the errata issue date %q. Allowed formats are 'YYYY-MM-DD' or 'YYYY-MM-DD hh:mm:ss'",
+			ErrInvalidOptions, options.ErrataIssuedAfter)
+	}
+	if _, ok := utils.ValidateDate(options.AsOf); !ok {
+		return fmt.Errorf("%w: unable to validate the date %q. Allowed formats are 'YYYY-MM-DD' or 'YYYY-MM-DD hh:mm:ss'",
+			ErrInvalidOptions, options.AsOf)
+	}
+	excludedTables := options.excludedTables()
+	for _, table := range excludedTables {
+		referencingTables, ok := excludableTables[table]
+		if !ok {
+			return fmt.Errorf("%w: table %s cannot be excluded", ErrInvalidOptions, table)
+		}
+		for _, referencingTable := range referencingTables {
+			if !utils.Contains(excludedTables, referencingTable) {
+				return fmt.Errorf("%w: table %s cannot be excluded without %s", ErrInvalidOptions, table, referencingTable)
+			}
+		}
+	}
+	if options.ErrataOnly && !options.hasChannelSelection() {
+		return fmt.Errorf("%w: errata only export without any software channel", ErrInvalidOptions)
+	}
+	db, err := schemareader.GetDBconnection(options.ServerConfig)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	problems := make([]error, 0)
+	check := func(query string, value interface{}, description string) error {
+		found, err := sqlUtil.ExecuteQueryWithResults(ctx, db, query, value)
+		if err != nil {
+			return err
+		}
+		if len(found) == 0 {
+			problems = append(problems, fmt.Errorf("%w: %s not found: %v", ErrInvalidOptions, description, value))
+		}
+		return nil
+	}
+	if _, err := expandChannelSelectors(ctx, db, options); err != nil {
+		if !errors.Is(err, ErrInvalidOptions) {
+			return err
+		}
+		problems = append(problems, err)
+	}
+	configQuery, configDescription := configChannelSql, "configuration channel"
+	if len(options.Orgs) > 0 {
+		configQuery = fmt.Sprintf("%s and org_id in (%s)", configChannelSql, orgList(options.Orgs))
+		configDescription = "configuration channel of organizations " + orgList(options.Orgs)
+	}
+	for _, label := range options.ConfigLabels {
+		if err := check(configQuery, label, configDescription); err != nil {
+			return err
+		}
+	}
+	for _, arch := range options.PackageArchs {
+		if err := check(packageArchSql, arch, "package architecture"); err != nil {
+			return err
+		}
+	}
+	for _, org := range options.Orgs {
+		if err := check(orgSql, org, "organization"); err != nil {
+			return err
+		}
+	}
+	return errors.Join(problems...)
+}
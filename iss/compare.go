@@ -0,0 +1,38 @@
+// SPDX-FileCopyrightText: 2023 SUSE LLC
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package iss
+
+import (
+	"context"
+
+	"github.com/rs/zerolog/log"
+	"github.com/uyuni-project/inter-server-sync/entityDumper"
+	"github.com/uyuni-project/inter-server-sync/schemareader"
+)
+
+// Compare compares the content of the channels between the server and the target server
+func Compare(ctx context.Context, options CompareOptions) ([]entityDumper.ChannelComparison, error) {
+	log.Info().Msg("Compare started")
+	sourceDB, err := schemareader.GetDBconnection(options.ServerConfig)
+	if err != nil {
+		return nil, err
+	}
+	defer sourceDB.Close()
+	targetDB, err := schemareader.GetDBconnection(options.TargetConfig)
+	if err != nil {
+		return nil, err
+	}
+	defer targetDB.Close()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	comparisons, err := entityDumper.CompareChannels(ctx, sourceDB, targetDB, options.ChannelLabels)
+	if err != nil {
+		return nil, interrupted(ctx, err)
+	}
+	log.Info().Msg("Compare done")
+	return comparisons, nil
+}
@@ -0,0 +1,56 @@
+// SPDX-FileCopyrightText: 2023 SUSE LLC
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package iss
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/rs/zerolog/log"
+	"github.com/uyuni-project/inter-server-sync/entityDumper"
+	"github.com/uyuni-project/inter-server-sync/schemareader"
+	"github.com/uyuni-project/inter-server-sync/utils"
+)
+
+// Diff computes the changes importing options.ImportDir would apply to the server channels, without applying them
+func Diff(ctx context.Context, options ImportOptions) ([]entityDumper.ChannelDiff, error) {
+	absImportDir, err := prepareImport(options)
+	if err != nil {
+		return nil, err
+	}
+	log.Info().Msg(fmt.Sprintf("starting diff from dir %s", absImportDir))
+
+	channelsFile := path.Join(absImportDir, "exportedChannels.txt")
+	if _, err := os.Stat(channelsFile); err != nil {
+		return nil, fmt.Errorf("no exported software channels found in import directory: %w", err)
+	}
+	channelLabels, err := utils.ReadFileByLine(channelsFile)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	sqlStatements, err := openSqlStatements(absImportDir)
+	if err != nil {
+		return nil, err
+	}
+	defer sqlStatements.Close()
+
+	db, err := schemareader.GetDBconnection(options.ServerConfig)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	channelDiffs, err := entityDumper.DiffImport(ctx, db, channelLabels, sqlStatements)
+	if err != nil {
+		return nil, interrupted(ctx, err)
+	}
+	log.Info().Msg("diff finished")
+	return channelDiffs, nil
+}
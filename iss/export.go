@@ -0,0 +1,169 @@
+// SPDX-FileCopyrightText: 2023 SUSE LLC
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package iss
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/uyuni-project/inter-server-sync/entityDumper"
+	"github.com/uyuni-project/inter-server-sync/progress"
+	"github.com/uyuni-project/inter-server-sync/utils"
+)
+
+// partialExportPrefix names the staging folder, in the output folder, an export is written to before being published
+const partialExportPrefix = ".partial-"
+
+// ErrOutputNotEmpty is returned when the output folder already has content, an export never overwrites it
+var ErrOutputNotEmpty = errors.New("export location is not empty")
+
+// exportCompleteMarker is written last in the staging folder, once the export is complete
+const exportCompleteMarker = "export-complete"
+
+// Export writes the selected server entities to options.OutputFolder, to be imported in another server
+// Exports can run at the same time: each one resolves its foreign keys with its own reference cache.
+// They must write to different output folders.
+func Export(ctx context.Context, options Options) (Report, error) {
+	report := Report{StartTime: time.Now()}
+	log.Info().Msg("Export started")
+	reportBuilder := newExportReportBuilder(report.StartTime)
+	ctx = progress.WithReporter(ctx, reportBuilder)
+
+	validatedDate, ok := utils.ValidateDate(options.StartingDate)
+	if !ok {
+		return report, fmt.Errorf("%w: unable to validate the date %q. Allowed formats are 'YYYY-MM-DD' or 'YYYY-MM-DD hh:mm:ss'",
+			ErrInvalidOptions, options.StartingDate)
+	}
+	options.StartingDate = validatedDate
+	if err := ctx.Err(); err != nil {
+		return report, err
+	}
+	outputFolderAbs, err := utils.GetAbsPath(options.OutputFolder)
+	if err != nil {
+		return report, err
+	}
+	report.Directory = outputFolderAbs
+	if err := validateOutputFolder(ctx, outputFolderAbs); err != nil {
+		return report, err
+	}
+	if err := entityDumper.ValidateOptions(ctx, options); err != nil {
+		return report, interrupted(ctx, fmt.Errorf("invalid export options: %w", err))
+	}
+
+	// everything is written to a staging folder, published only once the export is complete
+	stagingFolderAbs := path.Join(outputFolderAbs, partialExportPrefix+report.StartTime.Format("20060102150405"))
+	options.OutputFolder = stagingFolderAbs
+	summary, err := entityDumper.DumpAllEntities(ctx, options)
+	report.DroppedRelations = summary.DroppedRelations
+	if err == nil {
+		err = writeVersionFile(stagingFolderAbs, options.ServerConfig)
+	}
+	if err == nil {
+		report.EndTime = time.Now()
+		err = writeExportReport(stagingFolderAbs, reportBuilder.build(report.EndTime))
+	}
+	if err == nil {
+		finishPhase := progress.StartPhase(ctx, "publish")
+		err = publishExport(stagingFolderAbs, outputFolderAbs)
+		finishPhase(err)
+	}
+	if err != nil {
+		if errRemove := os.RemoveAll(stagingFolderAbs); errRemove != nil {
+			log.Warn().Err(errRemove).Msgf("Unable to remove partial export %s", stagingFolderAbs)
+		}
+		return report, interrupted(ctx, fmt.Errorf("export failed: %w", err))
+	}
+	report.Channels = summary.Channels
+	report.ConfigChannels = summary.ConfigChannels
+
+	log.Info().Msgf("Export done. Directory: %s", outputFolderAbs)
+	return report, nil
+}
+
+// ExpandChannels returns the channels selected by each channel selector of options
+func ExpandChannels(ctx context.Context, options Options) ([]entityDumper.ChannelExpansion, error) {
+	expansions, err := entityDumper.ExpandChannelSelectors(ctx, options)
+	return expansions, interrupted(ctx, err)
+}
+
+// validateOutputFolder creates the output folder if needed and checks it is empty,
+// ignoring staging folders left by interrupted exports
+func validateOutputFolder(ctx context.Context, outputFolderAbs string) error {
+	if err := entityDumper.ValidateExistingFolder(outputFolderAbs); err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(outputFolderAbs)
+	if err != nil {
+		return fmt.Errorf("error reading output folder %s: %w", outputFolderAbs, err)
+	}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), partialExportPrefix) {
+			log.Warn().Msgf("Ignoring partial export %s", path.Join(outputFolderAbs, entry.Name()))
+			progress.Warn(ctx, "ignored partial export %s", path.Join(outputFolderAbs, entry.Name()))
+			continue
+		}
+		return fmt.Errorf("%w: %s", ErrOutputNotEmpty, outputFolderAbs)
+	}
+	return nil
+}
+
+// publishExport moves the content of the staging folder to the output folder and writes the completion marker last.
+// The entries are renamed within the output folder, which works whatever the output folder is: a mount point, or a
+// folder whose parent is not writable or on another filesystem.
+func publishExport(stagingFolderAbs string, outputFolderAbs string) error {
+	outputEntries, err := os.ReadDir(outputFolderAbs)
+	if err != nil {
+		return fmt.Errorf("error reading output folder %s: %w", outputFolderAbs, err)
+	}
+	for _, entry := range outputEntries {
+		// the entries would replace the files written there meanwhile
+		if path.Join(outputFolderAbs, entry.Name()) != stagingFolderAbs {
+			return fmt.Errorf("error publishing export: %w: %s", ErrOutputNotEmpty, outputFolderAbs)
+		}
+	}
+	entries, err := os.ReadDir(stagingFolderAbs)
+	if err != nil {
+		return fmt.Errorf("error reading staging folder %s: %w", stagingFolderAbs, err)
+	}
+	for _, entry := range entries {
+		err := os.Rename(path.Join(stagingFolderAbs, entry.Name()), path.Join(outputFolderAbs, entry.Name()))
+		if err != nil {
+			return fmt.Errorf("error publishing export: %w", err)
+		}
+	}
+	if err := os.Remove(stagingFolderAbs); err != nil {
+		return fmt.Errorf("error removing staging folder %s: %w", stagingFolderAbs, err)
+	}
+	marker := path.Join(outputFolderAbs, exportCompleteMarker)
+	err = os.WriteFile(marker, []byte(time.Now().Format(time.RFC3339)+"\n"), 0644)
+	if err != nil {
+		return fmt.Errorf("error writing export completion marker: %w", err)
+	}
+	return nil
+}
+
+func writeVersionFile(outputFolderAbs string, serverConfig string) error {
+	version, product, err := utils.GetCurrentServerVersion(serverConfig)
+	if err != nil {
+		return err
+	}
+	versionfile := path.Join(outputFolderAbs, "version.txt")
+	vf, err := os.Create(versionfile)
+	if err != nil {
+		return fmt.Errorf("unable to create version file: %w", err)
+	}
+	defer vf.Close()
+	_, err = vf.WriteString("product_name = " + product + "\n" + "version = " + version + "\n")
+	if err != nil {
+		return fmt.Errorf("unable to write version file: %w", err)
+	}
+	return nil
+}
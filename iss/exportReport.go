@@ -0,0 +1,147 @@
+// SPDX-FileCopyrightText: 2023 SUSE LLC
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package iss
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/uyuni-project/inter-server-sync/progress"
+)
+
+// exportReportFile is written in the export folder, describing what was exported
+const exportReportFile = "export-report.json"
+
+// ExportReport details what an export shipped
+type ExportReport struct {
+	StartTime      time.Time       `json:"start_time"`
+	EndTime        time.Time       `json:"end_time"`
+	Channels       []ChannelReport `json:"channels"`
+	ConfigChannels []ChannelReport `json:"config_channels"`
+	Images         []string        `json:"images"`
+	Warnings       []string        `json:"warnings"`
+}
+
+// ChannelReport details the export of a software or configuration channel
+type ChannelReport struct {
+	Label           string         `json:"label"`
+	DurationSeconds float64        `json:"duration_seconds"`
+	CrawledRows     map[string]int `json:"crawled_rows"`
+	WrittenRows     map[string]int `json:"written_rows"`
+	Packages        int            `json:"packages"`
+	PackageBytes    int64          `json:"package_bytes"`
+	// PackageLinkModes counts the packages put in the export with each link mode
+	PackageLinkModes map[string]int `json:"package_link_modes"`
+}
+
+// exportReportBuilder fills an ExportReport from the progress events of the export
+type exportReportBuilder struct {
+	mutex        sync.Mutex
+	report       ExportReport
+	channel      *ChannelReport
+	channelPhase string
+	channelStart time.Time
+}
+
+func newExportReportBuilder(startTime time.Time) *exportReportBuilder {
+	return &exportReportBuilder{report: ExportReport{
+		StartTime:      startTime,
+		Channels:       make([]ChannelReport, 0),
+		ConfigChannels: make([]ChannelReport, 0),
+		Images:         make([]string, 0),
+		Warnings:       make([]string, 0),
+	}}
+}
+
+func (b *exportReportBuilder) Report(event progress.Event) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	switch event.Event {
+	case progress.ChannelStarted:
+		b.finishChannel(event.Time)
+		b.channel = &ChannelReport{Label: event.Channel, CrawledRows: make(map[string]int), WrittenRows: make(map[string]int),
+			PackageLinkModes: make(map[string]int)}
+		b.channelPhase = event.Phase
+		b.channelStart = event.Time
+	case progress.PhaseFinished:
+		if event.Phase == b.channelPhase {
+			b.finishChannel(event.Time)
+		}
+	case progress.TableCrawled:
+		if b.channel != nil {
+			b.channel.CrawledRows[event.Table] += event.Rows
+		}
+	case progress.RowsWritten:
+		if b.channel != nil {
+			b.channel.WrittenRows[event.Table] += event.Rows
+		}
+	case progress.FilesCopied:
+		if b.channel != nil {
+			b.channel.Packages++
+			b.channel.PackageBytes += event.Bytes
+			if event.LinkMode != "" {
+				b.channel.PackageLinkModes[event.LinkMode]++
+			}
+		}
+	case progress.ImageExported:
+		b.report.Images = append(b.report.Images, event.Image)
+	case progress.Warning:
+		b.report.Warnings = append(b.report.Warnings, event.Message)
+	}
+}
+
+func (b *exportReportBuilder) finishChannel(now time.Time) {
+	if b.channel == nil {
+		return
+	}
+	b.channel.DurationSeconds = now.Sub(b.channelStart).Seconds()
+	if b.channelPhase == "configs" {
+		b.report.ConfigChannels = append(b.report.ConfigChannels, *b.channel)
+	} else {
+		b.report.Channels = append(b.report.Channels, *b.channel)
+	}
+	b.channel = nil
+	b.channelPhase = ""
+}
+
+// build returns the report of the export finished at endTime
+func (b *exportReportBuilder) build(endTime time.Time) ExportReport {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.finishChannel(endTime)
+	b.report.EndTime = endTime
+	return b.report
+}
+
+func writeExportReport(outputFolderAbs string, report ExportReport) error {
+	content, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding export report: %w", err)
+	}
+	if err := os.WriteFile(path.Join(outputFolderAbs, exportReportFile), append(content, '\n'), 0644); err != nil {
+		return fmt.Errorf("error writing export report: %w", err)
+	}
+	return nil
+}
+
+// readExportedImages returns the images listed in the export report of absImportDir, or none if the export has no report
+func readExportedImages(absImportDir string) ([]string, error) {
+	content, err := os.ReadFile(path.Join(absImportDir, exportReportFile))
+	if os.IsNotExist(err) {
+		return make([]string, 0), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading export report: %w", err)
+	}
+	var report ExportReport
+	if err := json.Unmarshal(content, &report); err != nil {
+		return nil, fmt.Errorf("error parsing export report: %w", err)
+	}
+	return report.Images, nil
+}
@@ -0,0 +1,153 @@
+// SPDX-FileCopyrightText: 2023 SUSE LLC
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package iss
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/uyuni-project/inter-server-sync/progress"
+)
+
+func TestExportInvalidDate(t *testing.T) {
+	options := Options{OutputFolder: t.TempDir(), StartingDate: "yesterday"}
+	_, err := Export(context.Background(), options)
+	if err == nil {
+		t.Fatalf("Export should fail on an invalid date")
+	}
+}
+
+func TestImportMissingVersion(t *testing.T) {
+	importDir := t.TempDir()
+	if err := os.WriteFile(path.Join(importDir, exportCompleteMarker), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	options := ImportOptions{ImportDir: importDir}
+	_, err := Import(context.Background(), options)
+	if err == nil {
+		t.Fatalf("Import should fail without a version file")
+	}
+}
+
+func TestImportIncompleteExport(t *testing.T) {
+	options := ImportOptions{ImportDir: t.TempDir()}
+	_, err := Import(context.Background(), options)
+	if err == nil || !strings.Contains(err.Error(), exportCompleteMarker) {
+		t.Fatalf("Import should fail without the completion marker: %v", err)
+	}
+}
+
+func TestPublishExport(t *testing.T) {
+	outputDir := path.Join(t.TempDir(), "export")
+	stagingDir := path.Join(outputDir, partialExportPrefix+"20230101000000")
+	if err := os.MkdirAll(path.Join(stagingDir, "packages"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path.Join(stagingDir, "version.txt"), []byte("version = 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := validateOutputFolder(context.Background(), outputDir); err != nil {
+		t.Fatalf("partial exports should be ignored: %v", err)
+	}
+	outputInfo, err := os.Stat(outputDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := publishExport(stagingDir, outputDir); err != nil {
+		t.Fatal(err)
+	}
+
+	// the output folder is kept, it may be a mount point
+	if publishedInfo, err := os.Stat(outputDir); err != nil || !os.SameFile(outputInfo, publishedInfo) {
+		t.Errorf("the output folder should not be replaced: %v", err)
+	}
+
+	for _, name := range []string{"packages", "version.txt", exportCompleteMarker} {
+		if _, err := os.Stat(path.Join(outputDir, name)); err != nil {
+			t.Errorf("%s should be published: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(stagingDir); !os.IsNotExist(err) {
+		t.Errorf("staging folder should be removed")
+	}
+	if err := validateOutputFolder(context.Background(), outputDir); err == nil {
+		t.Errorf("a published export should not be overwritten")
+	}
+}
+
+func TestPublishExportNotEmpty(t *testing.T) {
+	outputDir := path.Join(t.TempDir(), "export")
+	stagingDir := path.Join(outputDir, partialExportPrefix+"20230101000000")
+	if err := os.MkdirAll(stagingDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path.Join(outputDir, "other.txt"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := publishExport(stagingDir, outputDir); err == nil {
+		t.Fatalf("an export should not be published over another content")
+	}
+	if _, err := os.Stat(path.Join(outputDir, exportCompleteMarker)); !os.IsNotExist(err) {
+		t.Errorf("the output folder should not be marked complete")
+	}
+}
+
+func TestInterruptedWrapsContextError(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := interrupted(ctx, errors.New("pq: canceling statement due to user request"))
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("error should wrap context.Canceled: %v", err)
+	}
+	if interrupted(context.Background(), nil) != nil {
+		t.Fatalf("nil error should stay nil")
+	}
+}
+
+func TestExportReportBuilder(t *testing.T) {
+	start := time.Now()
+	builder := newExportReportBuilder(start)
+	ctx := progress.WithReporter(context.Background(), builder)
+
+	progress.Report(ctx, progress.Event{Time: start, Event: progress.ChannelStarted, Phase: "channels", Channel: "base"})
+	progress.Report(ctx, progress.Event{Event: progress.TableCrawled, Table: "rhnpackage", Rows: 3})
+	progress.Report(ctx, progress.Event{Event: progress.RowsWritten, Table: "rhnpackage", Rows: 3, Current: 3, Total: 5})
+	progress.Report(ctx, progress.Event{Event: progress.FilesCopied, File: "a.rpm", Bytes: 100})
+	progress.Report(ctx, progress.Event{Event: progress.FilesCopied, File: "b.rpm", Bytes: 50})
+	progress.Report(ctx, progress.Event{Time: start.Add(time.Second), Event: progress.PhaseFinished, Phase: "channels"})
+	progress.Report(ctx, progress.Event{Event: progress.ChannelStarted, Phase: "configs", Channel: "config"})
+	progress.Report(ctx, progress.Event{Event: progress.ImageExported, Image: "image:1.0"})
+	progress.Warn(ctx, "something to check")
+
+	report := builder.build(start.Add(2 * time.Second))
+
+	if len(report.Channels) != 1 || len(report.ConfigChannels) != 1 {
+		t.Fatalf("expected one channel and one config channel, got %+v", report)
+	}
+	channel := report.Channels[0]
+	if channel.Label != "base" || channel.DurationSeconds != 1 || channel.CrawledRows["rhnpackage"] != 3 ||
+		channel.WrittenRows["rhnpackage"] != 3 || channel.Packages != 2 || channel.PackageBytes != 150 {
+		t.Errorf("unexpected channel report %+v", channel)
+	}
+	if report.ConfigChannels[0].Label != "config" {
+		t.Errorf("unexpected config channel report %+v", report.ConfigChannels[0])
+	}
+	if len(report.Images) != 1 || report.Images[0] != "image:1.0" {
+		t.Errorf("unexpected images %v", report.Images)
+	}
+	if len(report.Warnings) != 1 || report.Warnings[0] != "something to check" {
+		t.Errorf("unexpected warnings %v", report.Warnings)
+	}
+	if !report.EndTime.Equal(start.Add(2 * time.Second)) {
+		t.Errorf("unexpected end time %v", report.EndTime)
+	}
+}
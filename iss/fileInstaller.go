@@ -0,0 +1,300 @@
+// SPDX-FileCopyrightText: 2023 SUSE LLC
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package iss
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"github.com/uyuni-project/inter-server-sync/dumper/packageDumper"
+	"github.com/uyuni-project/inter-server-sync/progress"
+)
+
+// Default permissions of the installed files and of the directories created for them
+const (
+	defaultFileMode os.FileMode = 0644
+	defaultDirMode  os.FileMode = 0755
+)
+
+// checksumTypes are the hashes of the rhnchecksumtype labels
+var checksumTypes = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha384": sha512.New384,
+	"sha512": sha512.New,
+}
+
+// fileInstaller puts the files of an import directory in place on the server
+type fileInstaller struct {
+	// uid and gid own the installed files and created directories, -1 to keep them unchanged
+	uid      int
+	gid      int
+	fileMode os.FileMode
+	dirMode  os.FileMode
+	move     bool
+	// checksums verify the files, by path relative to the installed directory
+	checksums map[string]packageDumper.Checksum
+}
+
+// newFileInstaller returns an installer setting owner, as user:group, and the permissions of options on the files
+func newFileInstaller(owner string, options ImportOptions, checksums map[string]packageDumper.Checksum) (*fileInstaller, error) {
+	installer := &fileInstaller{uid: -1, gid: -1, fileMode: options.FileMode, dirMode: options.DirMode,
+		move: options.MoveFiles, checksums: checksums}
+	if installer.fileMode == 0 {
+		installer.fileMode = defaultFileMode
+	}
+	if installer.dirMode == 0 {
+		installer.dirMode = defaultDirMode
+	}
+	if owner == "" {
+		return installer, nil
+	}
+	userName, groupName, _ := strings.Cut(owner, ":")
+	if userName != "" {
+		owningUser, err := user.Lookup(userName)
+		if err != nil {
+			return nil, fmt.Errorf("error looking up owner of the files: %w", err)
+		}
+		if installer.uid, err = strconv.Atoi(owningUser.Uid); err != nil {
+			return nil, fmt.Errorf("unsupported user id %s: %w", owningUser.Uid, err)
+		}
+	}
+	if groupName != "" {
+		owningGroup, err := user.LookupGroup(groupName)
+		if err != nil {
+			return nil, fmt.Errorf("error looking up group of the files: %w", err)
+		}
+		if installer.gid, err = strconv.Atoi(owningGroup.Gid); err != nil {
+			return nil, fmt.Errorf("unsupported group id %s: %w", owningGroup.Gid, err)
+		}
+	}
+	return installer, nil
+}
+
+// install puts the regular files of sourceDir in targetDir, except the excluded sub directory if any.
+// Each file is written to a temporary file and renamed in place, after verifying its checksum if known.
+// It returns the files skipped because targetDir already has them with identical content, relative to sourceDir.
+func (installer *fileInstaller) install(ctx context.Context, sourceDir string, targetDir string, excluded string, total int) ([]string, error) {
+	skipped := make([]string, 0)
+	unverified := 0
+	current := 0
+	err := filepath.WalkDir(sourceDir, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() && excluded != "" && filePath == filepath.Join(sourceDir, excluded) {
+			return filepath.SkipDir
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		relativePath, err := filepath.Rel(sourceDir, filePath)
+		if err != nil {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		checksum, verified := installer.checksums[relativePath]
+		if !verified {
+			unverified++
+		}
+		installed, err := installer.installFile(filePath, filepath.Join(targetDir, relativePath), checksum, verified)
+		if err != nil {
+			return err
+		}
+		current++
+		if installed {
+			progress.Report(ctx, progress.Event{Event: progress.FilesCopied, File: relativePath, Bytes: info.Size(),
+				Current: current, Total: total})
+		} else {
+			log.Debug().Msgf("%s already installed", relativePath)
+			skipped = append(skipped, relativePath)
+		}
+		return nil
+	})
+	if err != nil {
+		return skipped, fmt.Errorf("error installing files of %s: %w", sourceDir, err)
+	}
+	if installer.checksums != nil && unverified > 0 {
+		log.Warn().Msgf("%d files of %s have no exported checksum and are not verified", unverified, sourceDir)
+		progress.Warn(ctx, "%d files of %s have no exported checksum and are not verified", unverified, sourceDir)
+	}
+	return skipped, nil
+}
+
+// installFile puts source at target, returning false if target already has the same content.
+// When verified, source must match checksum.
+func (installer *fileInstaller) installFile(source string, target string, checksum packageDumper.Checksum, verified bool) (bool, error) {
+	if !verified {
+		checksum.Type = "sha256"
+	}
+	newHash, ok := checksumTypes[checksum.Type]
+	if !ok {
+		return false, fmt.Errorf("unsupported checksum type %s of %s", checksum.Type, source)
+	}
+	identical, err := installer.isInstalled(source, target, newHash, checksum, verified)
+	if err != nil || identical {
+		return false, err
+	}
+	if err := installer.mkdirAll(filepath.Dir(target)); err != nil {
+		return false, err
+	}
+
+	if installer.move {
+		if verified {
+			if err := verifyChecksum(source, newHash, checksum); err != nil {
+				return false, err
+			}
+		}
+		if err := installer.setOwnerAndMode(source); err != nil {
+			return false, err
+		}
+		if err := os.Rename(source, target); err == nil {
+			return true, nil
+		}
+		// the import directory is on another filesystem: copy the file, then remove it
+		log.Trace().Msgf("unable to move %s, copying it", source)
+	}
+
+	temporary, err := os.CreateTemp(filepath.Dir(target), "."+filepath.Base(target)+".iss-")
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(temporary.Name())
+	written := newHash()
+	err = copyFile(source, io.MultiWriter(temporary, written))
+	if errClose := temporary.Close(); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		return false, fmt.Errorf("error copying %s: %w", source, err)
+	}
+	if verified && hex.EncodeToString(written.Sum(nil)) != checksum.Value {
+		return false, fmt.Errorf("%s does not match its exported %s checksum %s", source, checksum.Type, checksum.Value)
+	}
+	if err := installer.setOwnerAndMode(temporary.Name()); err != nil {
+		return false, err
+	}
+	if err := os.Rename(temporary.Name(), target); err != nil {
+		return false, err
+	}
+	if installer.move {
+		return true, os.Remove(source)
+	}
+	return true, nil
+}
+
+// isInstalled returns true if target has the content of source, known by checksum when verified
+func (installer *fileInstaller) isInstalled(source string, target string, newHash func() hash.Hash,
+	checksum packageDumper.Checksum, verified bool) (bool, error) {
+	sourceStat, err := os.Stat(source)
+	if err != nil {
+		return false, err
+	}
+	targetStat, err := os.Stat(target)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if !targetStat.Mode().IsRegular() || targetStat.Size() != sourceStat.Size() {
+		return false, nil
+	}
+	targetSum, err := hashFile(target, newHash)
+	if err != nil {
+		return false, err
+	}
+	if !verified {
+		if checksum.Value, err = hashFile(source, newHash); err != nil {
+			return false, err
+		}
+	}
+	return targetSum == checksum.Value, nil
+}
+
+// mkdirAll creates dir and its missing parents, with the owner and mode of the installer
+func (installer *fileInstaller) mkdirAll(dir string) error {
+	if _, err := os.Stat(dir); err == nil || !os.IsNotExist(err) {
+		return err
+	}
+	if err := installer.mkdirAll(filepath.Dir(dir)); err != nil {
+		return err
+	}
+	if err := os.Mkdir(dir, installer.dirMode); err != nil {
+		if os.IsExist(err) {
+			return nil
+		}
+		return err
+	}
+	// the mode given to Mkdir is reduced by the umask
+	if err := os.Chmod(dir, installer.dirMode); err != nil {
+		return err
+	}
+	return installer.chown(dir)
+}
+
+func (installer *fileInstaller) setOwnerAndMode(file string) error {
+	if err := os.Chmod(file, installer.fileMode); err != nil {
+		return err
+	}
+	return installer.chown(file)
+}
+
+func (installer *fileInstaller) chown(file string) error {
+	if installer.uid == -1 && installer.gid == -1 {
+		return nil
+	}
+	return os.Lchown(file, installer.uid, installer.gid)
+}
+
+func verifyChecksum(file string, newHash func() hash.Hash, checksum packageDumper.Checksum) error {
+	sum, err := hashFile(file, newHash)
+	if err != nil {
+		return err
+	}
+	if sum != checksum.Value {
+		return fmt.Errorf("%s does not match its exported %s checksum %s", file, checksum.Type, checksum.Value)
+	}
+	return nil
+}
+
+func hashFile(file string, newHash func() hash.Hash) (string, error) {
+	fileHash := newHash()
+	if err := copyFile(file, fileHash); err != nil {
+		return "", fmt.Errorf("error reading %s: %w", file, err)
+	}
+	return hex.EncodeToString(fileHash.Sum(nil)), nil
+}
+
+func copyFile(file string, writer io.Writer) error {
+	reader, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	_, err = io.Copy(writer, reader)
+	return err
+}
@@ -0,0 +1,91 @@
+// SPDX-FileCopyrightText: 2023 SUSE LLC
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package iss
+
+import (
+	"context"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/uyuni-project/inter-server-sync/dumper/packageDumper"
+)
+
+// sha256 of "package"
+const packageSha256 = "bc4a71180870f7945155fbb02f4b0a2e3faa2a62d6d31b7039013055ed19869a"
+
+func writeTestFiles(t *testing.T, dir string, files map[string]string) {
+	for file, content := range files {
+		if err := os.MkdirAll(path.Join(dir, path.Dir(file)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path.Join(dir, file), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestInstallFiles(t *testing.T) {
+	source, target := t.TempDir(), t.TempDir()
+	writeTestFiles(t, source, map[string]string{"1/new.rpm": "package", "1/same.rpm": "package", "pillars/image.sls": ""})
+	writeTestFiles(t, target, map[string]string{"1/same.rpm": "package"})
+	installer, err := newFileInstaller("", ImportOptions{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	skipped, err := installer.install(context.Background(), source, target, "pillars", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(skipped, []string{"1/same.rpm"}) {
+		t.Errorf("unexpected skipped files %v", skipped)
+	}
+	info, err := os.Stat(path.Join(target, "1/new.rpm"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != defaultFileMode {
+		t.Errorf("unexpected mode %v", info.Mode())
+	}
+	if _, err := os.Stat(path.Join(target, "pillars")); !os.IsNotExist(err) {
+		t.Errorf("excluded directory installed")
+	}
+	entries, _ := os.ReadDir(path.Join(target, "1"))
+	if len(entries) != 2 {
+		t.Errorf("unexpected files left in the target directory: %v", entries)
+	}
+}
+
+func TestInstallVerifiedFiles(t *testing.T) {
+	source, target := t.TempDir(), t.TempDir()
+	writeTestFiles(t, source, map[string]string{"1/package.rpm": "package"})
+	checksums := map[string]packageDumper.Checksum{"1/package.rpm": {Type: "sha256", Value: packageSha256}}
+	installer, err := newFileInstaller("", ImportOptions{MoveFiles: true}, checksums)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := installer.install(context.Background(), source, target, "", 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path.Join(source, "1/package.rpm")); !os.IsNotExist(err) {
+		t.Errorf("moved file left in the import directory")
+	}
+	if content, _ := os.ReadFile(path.Join(target, "1/package.rpm")); string(content) != "package" {
+		t.Errorf("unexpected content %q", content)
+	}
+
+	writeTestFiles(t, source, map[string]string{"1/package.rpm": "corrupted"})
+	os.Remove(path.Join(target, "1/package.rpm"))
+	_, err = installer.install(context.Background(), source, target, "", 1)
+	if err == nil || !strings.Contains(err.Error(), "does not match its exported sha256 checksum") {
+		t.Errorf("expected a checksum error, got %v", err)
+	}
+	if _, err := os.Stat(path.Join(target, "1/package.rpm")); !os.IsNotExist(err) {
+		t.Errorf("corrupted file installed")
+	}
+}
@@ -0,0 +1,466 @@
+// SPDX-FileCopyrightText: 2023 SUSE LLC
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package iss
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/uyuni-project/inter-server-sync/dumper/packageDumper"
+	"github.com/uyuni-project/inter-server-sync/dumper/pillarDumper"
+	"github.com/uyuni-project/inter-server-sync/progress"
+	"github.com/uyuni-project/inter-server-sync/sqlUtil"
+	"github.com/uyuni-project/inter-server-sync/utils"
+	"github.com/uyuni-project/inter-server-sync/xmlrpc"
+)
+
+// sqlImportCommand runs the SQL statements read from its standard input in the server database
+var sqlImportCommand = []string{"spacewalk-sql", "-"}
+
+// Target folders of the imported package and image files
+var (
+	packagesTargetDir = "/var/spacewalk/packages"
+	imagesTargetDir   = "/srv/www/os-images"
+)
+
+// Import loads the export found in options.ImportDir into the server.
+// The report is also written to the import folder, even if the import fails.
+func Import(ctx context.Context, options ImportOptions) (ImportReport, error) {
+	report := ImportReport{Report: Report{StartTime: time.Now()}, Phases: make([]PhaseReport, 0),
+		Statements: make([]StatementReport, 0), SkippedPackageFiles: make([]string, 0), SkippedImageFiles: make([]string, 0),
+		ConfigFilesSync: "not needed"}
+	err := runImport(ctx, options, &report)
+	report.EndTime = time.Now()
+	report.Success = err == nil
+	if err != nil {
+		report.Error = err.Error()
+	}
+	if report.Directory != "" {
+		if errWrite := writeImportReport(report.Directory, report); errWrite != nil {
+			log.Error().Err(errWrite).Msg("unable to write the import report")
+		}
+	}
+	return report, err
+}
+
+func runImport(ctx context.Context, options ImportOptions, report *ImportReport) error {
+	absImportDir, err := prepareImport(options)
+	if err != nil {
+		report.FailedPhase = "prepare"
+		return err
+	}
+	report.Directory = absImportDir
+	log.Info().Msg(fmt.Sprintf("starting import from dir %s", absImportDir))
+
+	if report.Channels, err = readExportedLabels(absImportDir, "exportedChannels.txt"); err != nil {
+		return err
+	}
+	if report.ConfigChannels, err = readExportedLabels(absImportDir, "exportedConfigs.txt"); err != nil {
+		return err
+	}
+
+	steps := []struct {
+		phase string
+		run   func() error
+	}{
+		{"rollback", func() error { return writeRollbackBundle(ctx, absImportDir, options, report) }},
+		{"packages", func() error { return runPackageFileSync(ctx, absImportDir, options, report) }},
+		{"images", func() error { return runImageFileSync(ctx, absImportDir, options, report) }},
+		{"sql", func() error { return runImportSql(ctx, absImportDir, report) }},
+		{"pillars", func() error {
+			updatedPillars, err := pillarDumper.UpdateImagePillars(ctx, options.ServerConfig)
+			report.UpdatedPillars = updatedPillars
+			return err
+		}},
+		{"configs", func() error {
+			runConfigFilesSync(absImportDir, options, report)
+			return nil
+		}},
+	}
+	for _, step := range steps {
+		if err := ctx.Err(); err != nil {
+			report.FailedPhase = step.phase
+			return err
+		}
+		start := time.Now()
+		finishPhase := progress.StartPhase(ctx, step.phase)
+		err := step.run()
+		finishPhase(err)
+		phaseReport := PhaseReport{Name: step.phase, DurationSeconds: time.Since(start).Seconds()}
+		if err != nil {
+			phaseReport.Error = err.Error()
+			report.FailedPhase = step.phase
+		}
+		report.Phases = append(report.Phases, phaseReport)
+		if err != nil {
+			return interrupted(ctx, err)
+		}
+	}
+	log.Info().Msg("import finished")
+	return nil
+}
+
+// prepareImport resolves the import directory and checks it can be imported in the server
+func prepareImport(options ImportOptions) (string, error) {
+	absImportDir, err := utils.GetAbsPath(options.ImportDir)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(path.Join(absImportDir, exportCompleteMarker)); err != nil {
+		return "", fmt.Errorf("export in %s is incomplete, no %s marker found: %w", absImportDir, exportCompleteMarker, err)
+	}
+	fversion, fproduct, err := getImportVersionProduct(absImportDir)
+	if err != nil {
+		return "", err
+	}
+	sversion, sproduct, err := utils.GetCurrentServerVersion(options.ServerConfig)
+	if err != nil {
+		return "", err
+	}
+	if fversion != sversion || fproduct != sproduct {
+		return "", fmt.Errorf("wrong version detected. Fileversion = %s ; Serverversion = %s", fversion, sversion)
+	}
+	if err := validateFolder(absImportDir); err != nil {
+		return "", err
+	}
+	return absImportDir, nil
+}
+
+func getImportVersionProduct(path string) (string, string, error) {
+	var versionfile string
+	versionfile = path + "/version.txt"
+	version, err := utils.ScannerFunc(versionfile, "version")
+	if err != nil {
+		log.Error().Msg("Version not found.")
+	}
+	product, err := utils.ScannerFunc(versionfile, "product_name")
+	if err != nil {
+		return "", "", fmt.Errorf("product not found in %s: %w", versionfile, err)
+	}
+	log.Debug().Msgf("Import Product: %s; Version: %s", product, version)
+	return version, product, nil
+}
+
+func validateFolder(absImportDir string) error {
+	_, err := os.Stat(fmt.Sprintf("%s/sql_statements.sql.gz", absImportDir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			_, err = os.Stat(fmt.Sprintf("%s/sql_statements.sql", absImportDir))
+			if err != nil {
+				return fmt.Errorf("no usable .sql or .gz file found in import directory: %w", err)
+			}
+		} else {
+			return err
+		}
+	}
+	return nil
+}
+
+// readExportedLabels returns the labels listed in fileName, or none if the export has no such file
+func readExportedLabels(absImportDir string, fileName string) ([]string, error) {
+	labelsFile := path.Join(absImportDir, fileName)
+	if _, err := os.Stat(labelsFile); os.IsNotExist(err) {
+		return make([]string, 0), nil
+	}
+	return utils.ReadFileByLine(labelsFile)
+}
+
+func hasConfigChannels(absImportDir string) bool {
+	_, err := os.Stat(fmt.Sprintf("%s/exportedConfigs.txt", absImportDir))
+	log.Info().Err(err).Msg(fmt.Sprintf("no export config file found: %s/exportedConfigs.txt", absImportDir))
+	return err == nil || os.IsExist(err)
+}
+
+// runPackageFileSync installs the package files of the import, verifying them with the exported checksums
+func runPackageFileSync(ctx context.Context, absImportDir string, options ImportOptions, report *ImportReport) error {
+	packagesImportDir := path.Join(absImportDir, "packages")
+	err := utils.FolderExists(packagesImportDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			log.Info().Msg("no package files to import")
+			return nil
+		} else {
+			return fmt.Errorf("error getting import packages folder: %w", err)
+		}
+	}
+
+	if report.PackageFiles, err = countFiles(packagesImportDir, ""); err != nil {
+		return err
+	}
+	checksums, err := readPackageChecksums(ctx, absImportDir)
+	if err != nil {
+		return err
+	}
+	installer, err := newFileInstaller(options.PackageOwner, options, checksums)
+	if err != nil {
+		return err
+	}
+	log.Info().Msg("starting importing package files")
+	report.SkippedPackageFiles, err = installer.install(ctx, packagesImportDir, packagesTargetDir, "", report.PackageFiles)
+	if err != nil {
+		return fmt.Errorf("error importing package files: %w", err)
+	}
+	return nil
+}
+
+// readPackageChecksums returns the exported checksums of the package files, by path relative to the packages folder.
+// Exports without checksums are imported without verification.
+func readPackageChecksums(ctx context.Context, absImportDir string) (map[string]packageDumper.Checksum, error) {
+	checksumsFile := path.Join(absImportDir, packageDumper.ChecksumsFile)
+	if _, err := os.Stat(checksumsFile); os.IsNotExist(err) {
+		log.Warn().Msg("the export has no package checksums, the package files are not verified")
+		progress.Warn(ctx, "the export has no package checksums, the package files are not verified")
+		return nil, nil
+	}
+	exportedChecksums, err := packageDumper.ReadChecksums(checksumsFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading package checksums: %w", err)
+	}
+	checksums := make(map[string]packageDumper.Checksum, len(exportedChecksums))
+	for packagePath, checksum := range exportedChecksums {
+		checksums[filepath.Clean(strings.TrimPrefix(packagePath, "packages/"))] = checksum
+	}
+	return checksums, nil
+}
+
+// runConfigFilesSync recreates the files of the imported configuration channels on disk.
+// A failure is only reported, the configuration channels are already imported in the database.
+func runConfigFilesSync(absImportDir string, options ImportOptions, report *ImportReport) {
+	if !hasConfigChannels(absImportDir) {
+		log.Debug().Msg("No configuration channels, NO CALL to xml-rpc API")
+		return
+	}
+	labels, err := utils.ReadFileByLine(fmt.Sprintf("%s/exportedConfigs.txt", absImportDir))
+	if err == nil {
+		log.Debug().Msg("Will call xml-rpc API to update filesystem")
+		client := xmlrpc.NewClient(options.XmlRpcUser, options.XmlRpcPassword)
+		_, err = client.SyncConfigFiles(labels)
+	}
+	if err != nil {
+		log.Error().Err(err).Msgf(
+			"Error recreating configuration files. Please run spacecmd api configchannel.syncSaltFilesOnDisk -A '[[%s]]'",
+			strings.Join(labels, ", "),
+		)
+		report.ConfigFilesSync = "failed: " + err.Error()
+		return
+	}
+	report.ConfigFilesSync = "done"
+}
+
+// countFiles returns the number of regular files in dir, excluding the excluded sub directory if any
+func countFiles(dir string, excluded string) (int, error) {
+	count := 0
+	err := filepath.WalkDir(dir, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() && excluded != "" && filePath == filepath.Join(dir, excluded) {
+			return filepath.SkipDir
+		}
+		if entry.Type().IsRegular() {
+			count++
+		}
+		return nil
+	})
+	if err != nil {
+		return count, fmt.Errorf("error counting files in %s: %w", dir, err)
+	}
+	return count, nil
+}
+
+func runImageFileSync(ctx context.Context, absImportDir string, options ImportOptions, report *ImportReport) error {
+	imagesImportDir := path.Join(absImportDir, "images")
+	err := utils.FolderExists(imagesImportDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			log.Info().Msg("No image files to import")
+			return nil
+		} else {
+			return fmt.Errorf("error reading import folder for images: %w", err)
+		}
+	}
+
+	if report.ImageFiles, err = countFiles(imagesImportDir, "pillars"); err != nil {
+		return err
+	}
+	installer, err := newFileInstaller(options.ImageOwner, options, nil)
+	if err != nil {
+		return err
+	}
+	log.Info().Msg("Copying image files")
+	report.SkippedImageFiles, err = installer.install(ctx, imagesImportDir, imagesTargetDir, "pillars", report.ImageFiles)
+	if err != nil {
+		return fmt.Errorf("error importing image files: %w", err)
+	}
+
+	pillarImportDir := path.Join(absImportDir, "images", "pillars")
+	err = utils.FolderExists(pillarImportDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			log.Debug().Msg("No pillar files to import")
+			return nil
+		} else {
+			return fmt.Errorf("error reading import folder for pillars: %w", err)
+		}
+	}
+
+	log.Info().Msg("Copying image pillar files")
+	return pillarDumper.ImportImagePillars(pillarImportDir, utils.GetCurrentServerFQDN(options.ServerConfig))
+}
+
+// runImportSql runs the exported SQL statements with spacewalk-sql, counting the affected rows from its output
+func runImportSql(ctx context.Context, absImportDir string, report *ImportReport) error {
+	sqlStatements, err := openSqlStatements(absImportDir)
+	if err != nil {
+		return err
+	}
+	defer sqlStatements.Close()
+
+	cImport := exec.CommandContext(ctx, sqlImportCommand[0], sqlImportCommand[1:]...)
+	cImport.Stderr = os.Stderr
+	stdin, err := cImport.StdinPipe()
+	if err != nil {
+		return fmt.Errorf("error running the SQL script: %w", err)
+	}
+	stdout, err := cImport.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("error running the SQL script: %w", err)
+	}
+	log.Info().Msg("Starting SQL import")
+	if err := cImport.Start(); err != nil {
+		return fmt.Errorf("error running the SQL script: %w", err)
+	}
+
+	sent := &sentStatements{}
+	sendErr := make(chan error, 1)
+	go func() {
+		defer stdin.Close()
+		sendErr <- sent.send(sqlStatements, stdin)
+	}()
+	counter := make(statementCounter)
+	countErr := countCommandTags(stdout, sent, counter)
+	if err := cImport.Wait(); err != nil {
+		return fmt.Errorf("error running the SQL script: %w", err)
+	}
+	if err := <-sendErr; err != nil {
+		return fmt.Errorf("error reading the SQL script: %w", err)
+	}
+	if countErr != nil {
+		return fmt.Errorf("error reading the SQL script output: %w", countErr)
+	}
+	report.Statements = counter.reports()
+	return nil
+}
+
+// sentStatements holds the statements sent to the SQL command whose command tag was not read yet
+type sentStatements struct {
+	mutex      sync.Mutex
+	statements []string
+}
+
+// send writes the statements read from reader to writer, one after the other
+func (sent *sentStatements) send(reader io.Reader, writer io.Writer) error {
+	scanner := sqlUtil.NewStatementScanner(reader)
+	for scanner.Scan() {
+		sent.mutex.Lock()
+		sent.statements = append(sent.statements, scanner.Statement())
+		sent.mutex.Unlock()
+		if _, err := io.WriteString(writer, scanner.Statement()+"\n"); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// next returns the oldest statement sent, false if none is left
+func (sent *sentStatements) next() (string, bool) {
+	sent.mutex.Lock()
+	defer sent.mutex.Unlock()
+	if len(sent.statements) == 0 {
+		return "", false
+	}
+	statement := sent.statements[0]
+	sent.statements = sent.statements[1:]
+	return statement, true
+}
+
+// commandTag matches the lines psql prints after each statement but SELECT, like "INSERT 0 1" or "DELETE 3".
+// The lines of the SELECT results are indented or framed.
+var commandTag = regexp.MustCompile(`^[A-Z]+( [A-Z]+)*( [0-9]+)*$`)
+
+// countCommandTags reads the output of the SQL command and counts each statement sent with the rows affected given by
+// its command tag, in order. SELECT statements print their result instead of a tag and count no row.
+func countCommandTags(output io.Reader, sent *sentStatements, counter statementCounter) error {
+	add := func(statement string, rowsAffected int64) {
+		switch class, _ := classifyStatement(statement); strings.TrimRight(class, ";") {
+		case "BEGIN", "COMMIT", "":
+		default:
+			counter.add(statement, rowsAffected)
+		}
+	}
+	scanner := bufio.NewScanner(output)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !commandTag.MatchString(line) {
+			if strings.TrimSpace(line) != "" {
+				log.Debug().Msg(line)
+			}
+			continue
+		}
+		for {
+			statement, ok := sent.next()
+			if !ok {
+				break
+			}
+			if class, _ := classifyStatement(statement); class == "SELECT" {
+				add(statement, 0)
+				continue
+			}
+			fields := strings.Fields(line)
+			rowsAffected, _ := strconv.ParseInt(fields[len(fields)-1], 10, 64)
+			add(statement, rowsAffected)
+			break
+		}
+	}
+	for statement, ok := sent.next(); ok; statement, ok = sent.next() {
+		add(statement, 0)
+	}
+	return scanner.Err()
+}
+
+// openSqlStatements returns a reader for the exported SQL file, uncompressing it if needed
+func openSqlStatements(absImportDir string) (io.ReadCloser, error) {
+	gzFile, err := os.Open(path.Join(absImportDir, "sql_statements.sql.gz"))
+	if err == nil {
+		gzReader, err := gzip.NewReader(gzFile)
+		if err != nil {
+			gzFile.Close()
+			return nil, fmt.Errorf("error reading the compressed SQL file: %w", err)
+		}
+		return struct {
+			io.Reader
+			io.Closer
+		}{gzReader, gzFile}, nil
+	}
+	sqlFile, err := os.Open(path.Join(absImportDir, "sql_statements.sql"))
+	if err != nil {
+		return nil, fmt.Errorf("no usable .sql or .gz file found in import directory: %w", err)
+	}
+	return sqlFile, nil
+}
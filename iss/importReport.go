@@ -0,0 +1,148 @@
+// SPDX-FileCopyrightText: 2023 SUSE LLC
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package iss
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// importReportFile is written in the import folder, describing what the import changed
+const importReportFile = "import-report.json"
+
+// ImportReport details what an import applied, up to the failing phase if any
+type ImportReport struct {
+	Report
+	Success      bool              `json:"success"`
+	FailedPhase  string            `json:"failed_phase,omitempty"`
+	Error        string            `json:"error,omitempty"`
+	Phases       []PhaseReport     `json:"phases"`
+	Statements   []StatementReport `json:"statements"`
+	PackageFiles int               `json:"package_files"`
+	ImageFiles   int               `json:"image_files"`
+	// SkippedPackageFiles and SkippedImageFiles were already on the server with the same content
+	SkippedPackageFiles []string `json:"skipped_package_files"`
+	SkippedImageFiles   []string `json:"skipped_image_files"`
+	UpdatedPillars      int64    `json:"updated_pillars"`
+	ConfigFilesSync     string   `json:"config_files_sync"`
+	// RollbackBundle restores the channels and images as they were before the import
+	RollbackBundle string `json:"rollback_bundle,omitempty"`
+}
+
+// PhaseReport records the duration of a phase of the import and its error, if any
+type PhaseReport struct {
+	Name            string  `json:"name"`
+	DurationSeconds float64 `json:"duration_seconds"`
+	Error           string  `json:"error,omitempty"`
+}
+
+// StatementReport counts the statements of a Class executed on a Table and the rows they affected
+type StatementReport struct {
+	Class        string `json:"class"`
+	Table        string `json:"table"`
+	Statements   int    `json:"statements"`
+	RowsAffected int64  `json:"rows_affected"`
+}
+
+// statementCounter accumulates the executed statements per class and table
+type statementCounter map[[2]string]*StatementReport
+
+func (counter statementCounter) add(statement string, rowsAffected int64) {
+	class, table := classifyStatement(statement)
+	key := [2]string{class, table}
+	statementReport, ok := counter[key]
+	if !ok {
+		statementReport = &StatementReport{Class: class, Table: table}
+		counter[key] = statementReport
+	}
+	statementReport.Statements++
+	statementReport.RowsAffected += rowsAffected
+}
+
+func (counter statementCounter) reports() []StatementReport {
+	result := make([]StatementReport, 0, len(counter))
+	for _, statementReport := range counter {
+		result = append(result, *statementReport)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Table != result[j].Table {
+			return result[i].Table < result[j].Table
+		}
+		return result[i].Class < result[j].Class
+	})
+	return result
+}
+
+// classifyStatement returns the class of a statement written by the export and the table it changes:
+// DELETE for the clean of the tables, INSERT or INSERT ON CONFLICT, UPDATE parent_channel for the child channel links,
+// UPDATE, and SELECT for the function calls, without table.
+func classifyStatement(statement string) (string, string) {
+	fields := strings.Fields(statement)
+	if len(fields) == 0 {
+		return "", ""
+	}
+	upperStatement := strings.ToUpper(statement)
+	switch strings.ToUpper(fields[0]) {
+	case "DELETE":
+		return "DELETE", tableField(fields, 2)
+	case "INSERT":
+		if strings.Contains(upperStatement, " ON CONFLICT ") {
+			return "INSERT ON CONFLICT", tableField(fields, 2)
+		}
+		return "INSERT", tableField(fields, 2)
+	case "UPDATE":
+		if strings.HasPrefix(strings.ToLower(strings.Join(fields[2:], " ")), "set parent_channel ") {
+			return "UPDATE parent_channel", tableField(fields, 1)
+		}
+		return "UPDATE", tableField(fields, 1)
+	}
+	return strings.ToUpper(fields[0]), ""
+}
+
+func tableField(fields []string, index int) string {
+	if index >= len(fields) {
+		return ""
+	}
+	return strings.ToLower(strings.TrimRight(fields[index], "(;"))
+}
+
+func writeImportReport(absImportDir string, report ImportReport) error {
+	content, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding import report: %w", err)
+	}
+	if err := os.WriteFile(path.Join(absImportDir, importReportFile), append(content, '\n'), 0644); err != nil {
+		return fmt.Errorf("error writing import report: %w", err)
+	}
+	return nil
+}
+
+// PrintSummary writes a human readable summary of the import report
+func (report ImportReport) PrintSummary(writer io.Writer) {
+	if report.Success {
+		fmt.Fprintf(writer, "Import of %s succeeded in %s\n", report.Directory, report.EndTime.Sub(report.StartTime).Round(time.Millisecond))
+	} else {
+		fmt.Fprintf(writer, "Import of %s failed in phase %s: %s\n", report.Directory, report.FailedPhase, report.Error)
+	}
+	if report.RollbackBundle != "" {
+		fmt.Fprintf(writer, "  rollback bundle: %s\n", report.RollbackBundle)
+	}
+	for _, phase := range report.Phases {
+		fmt.Fprintf(writer, "  phase %s: %.1fs\n", phase.Name, phase.DurationSeconds)
+	}
+	fmt.Fprintf(writer, "  package files: %d (%d already installed), image files: %d (%d already installed), updated pillars: %d, config files sync: %s\n",
+		report.PackageFiles, len(report.SkippedPackageFiles), report.ImageFiles, len(report.SkippedImageFiles),
+		report.UpdatedPillars, report.ConfigFilesSync)
+	for _, statementReport := range report.Statements {
+		fmt.Fprintf(writer, "  %s %s: %d statements, %d rows\n", statementReport.Class, statementReport.Table,
+			statementReport.Statements, statementReport.RowsAffected)
+	}
+}
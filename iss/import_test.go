@@ -0,0 +1,125 @@
+// SPDX-FileCopyrightText: 2023 SUSE LLC
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package iss
+
+import (
+	"context"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestClassifyStatement(t *testing.T) {
+	cases := []struct {
+		statement string
+		class     string
+		table     string
+	}{
+		{"DELETE FROM rhnchannelpackage WHERE (channel_id) IN (SELECT id FROM rhnchannel);", "DELETE", "rhnchannelpackage"},
+		{"INSERT INTO rhnpackage (id, name_id)\tVALUES (1, 2) ON CONFLICT (id) DO UPDATE SET name_id = excluded.name_id;",
+			"INSERT ON CONFLICT", "rhnpackage"},
+		{"INSERT INTO rhnchannelcloned (original_id, id)\tSELECT 1, 2 WHERE NOT EXISTS (SELECT 1 FROM rhnchannelcloned);",
+			"INSERT", "rhnchannelcloned"},
+		{"update rhnchannel set parent_channel = (select id from rhnchannel where label = 'base') where label in ('child');",
+			"UPDATE parent_channel", "rhnchannel"},
+		{"update rhnchannel set modified = current_timestamp where label = 'base';", "UPDATE", "rhnchannel"},
+		{"select rhn_channel.update_needed_cache((select id from rhnchannel where label ='base'));", "SELECT", ""},
+	}
+	for _, c := range cases {
+		class, table := classifyStatement(c.statement)
+		if class != c.class || table != c.table {
+			t.Errorf("%s: expected %s %s, got %s %s", c.statement, c.class, c.table, class, table)
+		}
+	}
+}
+
+func TestStatementCounter(t *testing.T) {
+	counter := make(statementCounter)
+	counter.add("DELETE FROM rhnchannelpackage WHERE channel_id = 1;", 3)
+	counter.add("DELETE FROM rhnchannelpackage WHERE channel_id = 2;", 2)
+	counter.add("update rhnchannel set modified = current_timestamp where label = 'base';", 1)
+
+	expected := []StatementReport{
+		{Class: "UPDATE", Table: "rhnchannel", Statements: 1, RowsAffected: 1},
+		{Class: "DELETE", Table: "rhnchannelpackage", Statements: 2, RowsAffected: 5},
+	}
+	if reports := counter.reports(); !reflect.DeepEqual(reports, expected) {
+		t.Errorf("expected %+v, got %+v", expected, reports)
+	}
+}
+
+func TestCountCommandTags(t *testing.T) {
+	sent := &sentStatements{statements: []string{
+		"BEGIN;",
+		"DELETE FROM rhnchannelpackage WHERE channel_id = 1;",
+		"SELECT rhn_channel.update_needed_cache(1);",
+		"INSERT INTO rhnchannelpackage (channel_id, package_id) VALUES (1, 2) ON CONFLICT DO NOTHING;",
+		"UPDATE rhnchannel SET parent_channel = 1 WHERE id = 2;",
+		"COMMIT;",
+	}}
+	output := "BEGIN\nDELETE 3\n update_needed_cache \n---------------------\n \n(1 row)\n\nINSERT 0 1\nUPDATE 1\nCOMMIT\n"
+
+	counter := make(statementCounter)
+	if err := countCommandTags(strings.NewReader(output), sent, counter); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []StatementReport{
+		{Class: "SELECT", Table: "", Statements: 1, RowsAffected: 0},
+		{Class: "UPDATE parent_channel", Table: "rhnchannel", Statements: 1, RowsAffected: 1},
+		{Class: "DELETE", Table: "rhnchannelpackage", Statements: 1, RowsAffected: 3},
+		{Class: "INSERT ON CONFLICT", Table: "rhnchannelpackage", Statements: 1, RowsAffected: 1},
+	}
+	if reports := counter.reports(); !reflect.DeepEqual(reports, expected) {
+		t.Errorf("expected %+v, got %+v", expected, reports)
+	}
+}
+
+func TestRunImportSql(t *testing.T) {
+	importDir := t.TempDir()
+	statements := "BEGIN;\nDELETE FROM rhnchannelpackage\nWHERE channel_id = 1;\nCOMMIT;\n"
+	if err := os.WriteFile(path.Join(importDir, "sql_statements.sql"), []byte(statements), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer func(command []string) { sqlImportCommand = command }(sqlImportCommand)
+	sqlImportCommand = []string{"sh", "-c", "cat >/dev/null; printf 'BEGIN\\nDELETE 2\\nCOMMIT\\n'"}
+
+	report := &ImportReport{}
+	if err := runImportSql(context.Background(), importDir, report); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []StatementReport{{Class: "DELETE", Table: "rhnchannelpackage", Statements: 1, RowsAffected: 2}}
+	if !reflect.DeepEqual(report.Statements, expected) {
+		t.Errorf("expected %+v, got %+v", expected, report.Statements)
+	}
+
+	sqlImportCommand = []string{"sh", "-c", "cat >/dev/null; exit 3"}
+	if err := runImportSql(context.Background(), importDir, &ImportReport{}); err == nil {
+		t.Errorf("expected an error when the SQL command fails")
+	}
+}
+
+func TestCountFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, file := range []string{"1/image.tar.xz", "1/image.sha256", "pillars/image.sls"} {
+		if err := os.MkdirAll(path.Join(dir, path.Dir(file)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path.Join(dir, file), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	count, err := countFiles(dir, "pillars")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("expected 2 files, got %d", count)
+	}
+}
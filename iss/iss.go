@@ -0,0 +1,27 @@
+// SPDX-FileCopyrightText: 2023 SUSE LLC
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package iss exposes the inter server sync export and import operations to other programs.
+// Functions return errors instead of terminating the process, and stop as soon as the context is cancelled.
+package iss
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/uyuni-project/inter-server-sync/entityDumper"
+)
+
+// ErrInvalidOptions is returned when the options of an operation are invalid, retrying cannot succeed
+var ErrInvalidOptions = entityDumper.ErrInvalidOptions
+
+// interrupted wraps err with the context error when the failure is due to a cancellation,
+// so callers can tell an interrupted run apart from a failed one with errors.Is
+func interrupted(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); err != nil && ctxErr != nil && !errors.Is(err, ctxErr) {
+		return fmt.Errorf("%w: %w", ctxErr, err)
+	}
+	return err
+}
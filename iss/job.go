@@ -0,0 +1,183 @@
+// SPDX-FileCopyrightText: 2023 SUSE LLC
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package iss
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/uyuni-project/inter-server-sync/utils"
+	"gopkg.in/yaml.v2"
+)
+
+// jobDatePlaceholder in the output directory of a job is replaced by the start time of the run.
+// Scheduled jobs need it: an export never overwrites the output directory of a previous run.
+const jobDatePlaceholder = "{date}"
+
+// jobDateFormat is the format of the start time replacing jobDatePlaceholder
+const jobDateFormat = "20060102-150405"
+
+// stateDateFormat is the format of the date stored in the state file of incremental jobs
+const stateDateFormat = "2006-01-02 15:04:05"
+
+// Job is a declarative export, read from a YAML job file
+type Job struct {
+	Name                      string   `yaml:"name"`
+	ServerConfig              string   `yaml:"serverConfig"`
+	Channels                  []string `yaml:"channels"`
+	ChannelsWithChildren      []string `yaml:"channelsWithChildren"`
+	Products                  []string `yaml:"products"`
+	ChannelFamilies           []string `yaml:"channelFamilies"`
+	ClmEnvironments           []string `yaml:"clmEnvironments"`
+	AllVendorChannels         bool     `yaml:"allVendorChannels"`
+	VendorChannelsWithContent bool     `yaml:"vendorChannelsWithContent"`
+	AllCustomChannels         bool     `yaml:"allCustomChannels"`
+	ResolveDependencies       bool     `yaml:"resolveDependencies"`
+	ConfigChannels            []string `yaml:"configChannels"`
+	Images                    bool     `yaml:"images"`
+	Containers                bool     `yaml:"containers"`
+	Orgs                      []uint   `yaml:"orgs"`
+	MetadataOnly              bool     `yaml:"metadataOnly"`
+	ErrataOnly                bool     `yaml:"errataOnly"`
+	PackageArchs              []string `yaml:"packageArchs"`
+	LatestPackageVersions     int      `yaml:"latestPackageVersions"`
+	ErrataTypes               []string `yaml:"errataTypes"`
+	ErrataSeverities          []string `yaml:"errataSeverities"`
+	ErrataIssuedAfter         string   `yaml:"errataIssuedAfter"`
+	AsOf                      string   `yaml:"asOf"`
+	Slim                      bool     `yaml:"slim"`
+	ExcludeTables             []string `yaml:"excludeTables"`
+	PackagesOnlyAfter         string   `yaml:"packagesOnlyAfter"`
+	OutputDir                 string   `yaml:"outputDir"`
+	Compression               string   `yaml:"compression"`
+	LinkMode                  string   `yaml:"linkMode"`
+	// StateFile makes the job incremental: only packages modified since the last successful run are exported
+	StateFile string `yaml:"stateFile"`
+	// Schedule is the cron expression the daemon runs the job with
+	Schedule string `yaml:"schedule"`
+}
+
+// LoadJob reads the job file at jobPath. The name of the job defaults to the file name.
+func LoadJob(jobPath string) (Job, error) {
+	var job Job
+	content, err := os.ReadFile(jobPath)
+	if err != nil {
+		return job, fmt.Errorf("error reading job file: %w", err)
+	}
+	if err := yaml.UnmarshalStrict(content, &job); err != nil {
+		return job, fmt.Errorf("error parsing job file %s: %w", jobPath, err)
+	}
+	if job.Name == "" {
+		job.Name = strings.TrimSuffix(filepath.Base(jobPath), filepath.Ext(jobPath))
+	}
+	if job.OutputDir == "" {
+		return job, fmt.Errorf("job %s has no outputDir", job.Name)
+	}
+	if job.Schedule != "" && !strings.Contains(job.OutputDir, jobDatePlaceholder) {
+		return job, fmt.Errorf("job %s has a schedule, its outputDir must contain %s", job.Name, jobDatePlaceholder)
+	}
+	if len(job.Channels) == 0 && len(job.ChannelsWithChildren) == 0 && len(job.Products) == 0 &&
+		len(job.ChannelFamilies) == 0 && len(job.ClmEnvironments) == 0 && !job.AllVendorChannels && !job.AllCustomChannels &&
+		len(job.ConfigChannels) == 0 && !job.Images && !job.Containers {
+		return job, fmt.Errorf("job %s exports nothing", job.Name)
+	}
+	return job, nil
+}
+
+// OutputFolder returns the absolute output folder of the run of the job started at startTime
+func (job Job) OutputFolder(startTime time.Time) (string, error) {
+	outputFolder, err := utils.GetAbsPath(strings.ReplaceAll(job.OutputDir, jobDatePlaceholder, startTime.Format(jobDateFormat)))
+	if err != nil {
+		return "", err
+	}
+	return filepath.Abs(outputFolder)
+}
+
+// exportOptions returns the options exporting the job started at startTime, with serverConfig as default server configuration
+func (job Job) exportOptions(serverConfig string, startTime time.Time) (Options, error) {
+	outputFolder, err := job.OutputFolder(startTime)
+	if err != nil {
+		return Options{}, err
+	}
+	options := Options{
+		ServerConfig:              serverConfig,
+		ChannelLabels:             job.Channels,
+		ConfigLabels:              job.ConfigChannels,
+		ChannelWithChildrenLabels: job.ChannelsWithChildren,
+		OutputFolder:              outputFolder,
+		MetadataOnly:              job.MetadataOnly,
+		ErrataOnly:                job.ErrataOnly,
+		PackageArchs:              job.PackageArchs,
+		LatestPackageVersions:     job.LatestPackageVersions,
+		ErrataTypes:               job.ErrataTypes,
+		ErrataSeverities:          job.ErrataSeverities,
+		ErrataIssuedAfter:         job.ErrataIssuedAfter,
+		AsOf:                      job.AsOf,
+		Slim:                      job.Slim,
+		ExcludedTables:            job.ExcludeTables,
+		StartingDate:              job.PackagesOnlyAfter,
+		OSImages:                  job.Images,
+		Containers:                job.Containers,
+		Orgs:                      job.Orgs,
+		Compression:               job.Compression,
+		LinkMode:                  job.LinkMode,
+		Products:                  job.Products,
+		ChannelFamilies:           job.ChannelFamilies,
+		ClmEnvironments:           job.ClmEnvironments,
+		AllVendorChannels:         job.AllVendorChannels,
+		VendorChannelsWithContent: job.VendorChannelsWithContent,
+		AllCustomChannels:         job.AllCustomChannels,
+		ResolveDependencies:       job.ResolveDependencies,
+	}
+	if job.ServerConfig != "" {
+		options.ServerConfig = job.ServerConfig
+	}
+	if job.StateFile != "" {
+		lastRun, err := os.ReadFile(job.StateFile)
+		if err == nil {
+			options.StartingDate = strings.TrimSpace(string(lastRun))
+		} else if !os.IsNotExist(err) {
+			return options, fmt.Errorf("error reading state file of job %s: %w", job.Name, err)
+		}
+	}
+	return options, nil
+}
+
+// RunJob exports the job started at startTime, using serverConfig unless the job defines its own server configuration.
+// Incremental jobs record the start of a successful run in their state file, for the next run.
+func RunJob(ctx context.Context, job Job, serverConfig string, startTime time.Time) (Report, error) {
+	options, err := job.exportOptions(serverConfig, startTime)
+	if err != nil {
+		return Report{StartTime: startTime}, err
+	}
+	log.Info().Msgf("Running export job %s", job.Name)
+	report, err := Export(ctx, options)
+	if err != nil {
+		return report, fmt.Errorf("job %s: %w", job.Name, err)
+	}
+	if job.StateFile != "" {
+		if err := writeJobState(job.StateFile, startTime); err != nil {
+			return report, fmt.Errorf("job %s: %w", job.Name, err)
+		}
+	}
+	return report, nil
+}
+
+// writeJobState replaces the state file atomically, so an interrupted write never loses the last run date
+func writeJobState(stateFile string, lastRun time.Time) error {
+	tmpFile := stateFile + ".tmp"
+	if err := os.WriteFile(tmpFile, []byte(lastRun.Format(stateDateFormat)+"\n"), 0644); err != nil {
+		return fmt.Errorf("error writing state file: %w", err)
+	}
+	if err := os.Rename(tmpFile, stateFile); err != nil {
+		return fmt.Errorf("error writing state file: %w", err)
+	}
+	return nil
+}
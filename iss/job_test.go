@@ -0,0 +1,99 @@
+// SPDX-FileCopyrightText: 2023 SUSE LLC
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package iss
+
+import (
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeJobFile(t *testing.T, name string, content string) string {
+	jobPath := path.Join(t.TempDir(), name)
+	if err := os.WriteFile(jobPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return jobPath
+}
+
+func TestLoadJob(t *testing.T) {
+	jobPath := writeJobFile(t, "branch-east.yaml", `
+channels:
+  - sles15-sp4-pool
+channelsWithChildren:
+  - sles15-sp4-updates
+configChannels: [salt-states]
+orgs: [1, 2]
+images: true
+outputDir: /var/iss/branch-east/{date}
+compression: none
+stateFile: /var/lib/iss/branch-east.state
+`)
+	job, err := LoadJob(jobPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Job{
+		Name:                 "branch-east",
+		Channels:             []string{"sles15-sp4-pool"},
+		ChannelsWithChildren: []string{"sles15-sp4-updates"},
+		ConfigChannels:       []string{"salt-states"},
+		Orgs:                 []uint{1, 2},
+		Images:               true,
+		OutputDir:            "/var/iss/branch-east/{date}",
+		Compression:          "none",
+		StateFile:            "/var/lib/iss/branch-east.state",
+	}
+	if !reflect.DeepEqual(job, expected) {
+		t.Errorf("expected %+v, got %+v", expected, job)
+	}
+}
+
+func TestLoadInvalidJob(t *testing.T) {
+	cases := map[string]string{
+		"unknown field":          "channel: [base]\noutputDir: /tmp/export\n",
+		"missing outputDir":      "channels: [base]\n",
+		"empty selection":        "outputDir: /tmp/export\n",
+		"scheduled without date": "channels: [base]\noutputDir: /tmp/export\nschedule: '@daily'\n",
+	}
+	for name, content := range cases {
+		if _, err := LoadJob(writeJobFile(t, "job.yaml", content)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestJobExportOptions(t *testing.T) {
+	stateFile := path.Join(t.TempDir(), "job.state")
+	job := Job{Name: "job", Channels: []string{"base"}, OutputDir: "/var/iss/{date}", StateFile: stateFile,
+		PackagesOnlyAfter: "2023-01-01"}
+	startTime := time.Date(2023, 5, 4, 3, 2, 1, 0, time.Local)
+
+	options, err := job.exportOptions("/etc/rhn/rhn.conf", startTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if options.OutputFolder != "/var/iss/20230504-030201" || options.StartingDate != "2023-01-01" ||
+		options.ServerConfig != "/etc/rhn/rhn.conf" {
+		t.Errorf("unexpected options of the first run %+v", options)
+	}
+
+	if err := writeJobState(stateFile, startTime); err != nil {
+		t.Fatal(err)
+	}
+	options, err = job.exportOptions("/etc/rhn/rhn.conf", startTime.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if options.StartingDate != "2023-05-04 03:02:01" {
+		t.Errorf("expected the date of the last run, got %s", options.StartingDate)
+	}
+	if strings.Contains(options.OutputFolder, jobDatePlaceholder) {
+		t.Errorf("placeholder not replaced in %s", options.OutputFolder)
+	}
+}
@@ -0,0 +1,196 @@
+// SPDX-FileCopyrightText: 2023 SUSE LLC
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package iss
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/uyuni-project/inter-server-sync/entityDumper"
+	"github.com/uyuni-project/inter-server-sync/schemareader"
+	"github.com/uyuni-project/inter-server-sync/sqlUtil"
+	"github.com/uyuni-project/inter-server-sync/utils"
+)
+
+// rollbackBundleFile describes a rollback bundle, it is written last to mark the bundle complete
+const rollbackBundleFile = "bundle.json"
+
+// DefaultRollbackDir receives the rollback bundles when the import options name no folder
+const DefaultRollbackDir = "/var/lib/inter-server-sync/rollback"
+
+// rollbackStatementsFile holds the statements restoring the content of a rollback bundle
+const rollbackStatementsFile = "rollback.sql.gz"
+
+// RollbackBundle describes the channels and images saved before an import, to restore them if the import result is wrong
+type RollbackBundle struct {
+	CreationTime   time.Time `json:"creation_time"`
+	ImportDir      string    `json:"import_dir"`
+	Version        string    `json:"version"`
+	Product        string    `json:"product"`
+	Channels       []string  `json:"channels"`
+	ConfigChannels []string  `json:"config_channels"`
+	Images         []string  `json:"images"`
+}
+
+// RollbackOptions describes the rollback bundle to restore and the server to restore it in
+type RollbackOptions struct {
+	ServerConfig string
+	Bundle       string
+}
+
+// writeRollbackBundle saves the current content of the channels and images of the import in a bundle of
+// options.RollbackDir, DefaultRollbackDir by default
+func writeRollbackBundle(ctx context.Context, absImportDir string, options ImportOptions, report *ImportReport) error {
+	images, err := readExportedImages(absImportDir)
+	if err != nil {
+		return err
+	}
+	if len(report.Channels) == 0 && len(report.ConfigChannels) == 0 && len(images) == 0 {
+		log.Info().Msg("no channels or images to import, no rollback bundle needed")
+		return nil
+	}
+	rollbackDir, err := rollbackDirectory(options.RollbackDir, absImportDir)
+	if err != nil {
+		return err
+	}
+	bundle := RollbackBundle{CreationTime: time.Now(), ImportDir: absImportDir, Channels: report.Channels,
+		ConfigChannels: report.ConfigChannels, Images: images}
+	if bundle.Version, bundle.Product, err = utils.GetCurrentServerVersion(options.ServerConfig); err != nil {
+		return err
+	}
+	bundleDir := path.Join(rollbackDir, "rollback-"+bundle.CreationTime.Format("20060102-150405"))
+	if err := os.MkdirAll(bundleDir, 0700); err != nil {
+		return fmt.Errorf("error creating rollback bundle folder: %w", err)
+	}
+	log.Info().Msgf("writing rollback bundle %s", bundleDir)
+
+	db, err := schemareader.GetDBconnection(options.ServerConfig)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	content := entityDumper.RollbackContent{Channels: bundle.Channels, ConfigChannels: bundle.ConfigChannels, Images: bundle.Images}
+	if err := writeRollbackStatements(ctx, db, bundleDir, content); err != nil {
+		return err
+	}
+
+	description, err := json.MarshalIndent(bundle, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding rollback bundle: %w", err)
+	}
+	if err := os.WriteFile(path.Join(bundleDir, rollbackBundleFile), append(description, '\n'), 0600); err != nil {
+		return fmt.Errorf("error writing rollback bundle: %w", err)
+	}
+	report.RollbackBundle = bundleDir
+	return nil
+}
+
+// rollbackDirectory returns the absolute folder receiving the rollback bundle, refusing the import directory and its
+// sub folders: the bundle has to survive the removal of the import directory
+func rollbackDirectory(rollbackDir string, absImportDir string) (string, error) {
+	if rollbackDir == "" {
+		rollbackDir = DefaultRollbackDir
+	}
+	rollbackDir, err := utils.GetAbsPath(rollbackDir)
+	if err != nil {
+		return "", err
+	}
+	rollbackDir, err = filepath.Abs(rollbackDir)
+	if err != nil {
+		return "", err
+	}
+	relative, err := filepath.Rel(absImportDir, rollbackDir)
+	if err == nil && relative != ".." && !strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("rollback folder %s is inside the import directory %s", rollbackDir, absImportDir)
+	}
+	return rollbackDir, nil
+}
+
+func writeRollbackStatements(ctx context.Context, db *sql.DB, bundleDir string, content entityDumper.RollbackContent) error {
+	file, err := os.OpenFile(path.Join(bundleDir, rollbackStatementsFile), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return fmt.Errorf("error creating rollback statements file: %w", err)
+	}
+	defer file.Close()
+	gzipWriter := gzip.NewWriter(file)
+	if err := entityDumper.PrintRollbackStatements(ctx, db, content, bufio.NewWriterSize(gzipWriter, 32768)); err != nil {
+		return err
+	}
+	if err := gzipWriter.Close(); err != nil {
+		return fmt.Errorf("error writing rollback statements: %w", err)
+	}
+	return file.Close()
+}
+
+// Rollback restores the channels and images saved in the rollback bundle options.Bundle, in a single transaction
+func Rollback(ctx context.Context, options RollbackOptions) ([]StatementReport, error) {
+	bundle, err := readRollbackBundle(options.Bundle)
+	if err != nil {
+		return nil, err
+	}
+	version, product, err := utils.GetCurrentServerVersion(options.ServerConfig)
+	if err != nil {
+		return nil, err
+	}
+	if version != bundle.Version || product != bundle.Product {
+		return nil, fmt.Errorf("rollback bundle of %s %s cannot be restored in %s %s", bundle.Product, bundle.Version, product, version)
+	}
+
+	file, err := os.Open(path.Join(options.Bundle, rollbackStatementsFile))
+	if err != nil {
+		return nil, fmt.Errorf("error opening rollback statements: %w", err)
+	}
+	defer file.Close()
+	statements, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading rollback statements: %w", err)
+	}
+
+	db, err := schemareader.GetDBconnection(options.ServerConfig)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	log.Info().Msgf("restoring channels %v, configuration channels %v and images %v as they were on %s", bundle.Channels,
+		bundle.ConfigChannels, bundle.Images, bundle.CreationTime.Format(time.RFC3339))
+	counter := make(statementCounter)
+	if _, err := sqlUtil.ExecuteStatements(ctx, tx, statements, counter.add); err != nil {
+		return nil, interrupted(ctx, fmt.Errorf("error running the rollback statements, no change applied: %w", err))
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing the rollback: %w", err)
+	}
+	log.Info().Msg("rollback finished")
+	return counter.reports(), nil
+}
+
+// readRollbackBundle returns the description of the rollback bundle in bundleDir, failing if the bundle is incomplete
+func readRollbackBundle(bundleDir string) (RollbackBundle, error) {
+	var bundle RollbackBundle
+	content, err := os.ReadFile(path.Join(bundleDir, rollbackBundleFile))
+	if err != nil {
+		return bundle, fmt.Errorf("rollback bundle %s is incomplete or missing: %w", bundleDir, err)
+	}
+	if err := json.Unmarshal(content, &bundle); err != nil {
+		return bundle, fmt.Errorf("error parsing rollback bundle %s: %w", bundleDir, err)
+	}
+	return bundle, nil
+}
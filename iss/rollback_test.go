@@ -0,0 +1,66 @@
+// SPDX-FileCopyrightText: 2023 SUSE LLC
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package iss
+
+import (
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestReadRollbackBundle(t *testing.T) {
+	bundleDir := t.TempDir()
+	if _, err := readRollbackBundle(bundleDir); err == nil {
+		t.Errorf("expected an error for a bundle without %s", rollbackBundleFile)
+	}
+	content := `{"version": "4.3.8", "product": "SUSE Manager", "channels": ["sles15-sp4-pool"]}`
+	if err := os.WriteFile(path.Join(bundleDir, rollbackBundleFile), []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	bundle, err := readRollbackBundle(bundleDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := RollbackBundle{Version: "4.3.8", Product: "SUSE Manager", Channels: []string{"sles15-sp4-pool"}}
+	if !reflect.DeepEqual(bundle, expected) {
+		t.Errorf("expected %+v, got %+v", expected, bundle)
+	}
+}
+
+func TestRollbackDirectory(t *testing.T) {
+	importDir := t.TempDir()
+	rollbackDir, err := rollbackDirectory("", importDir)
+	if err != nil || rollbackDir != DefaultRollbackDir {
+		t.Errorf("expected %s by default, got %s, %v", DefaultRollbackDir, rollbackDir, err)
+	}
+	sibling := importDir + "-rollback"
+	if rollbackDir, err := rollbackDirectory(sibling, importDir); err != nil || rollbackDir != sibling {
+		t.Errorf("expected %s, got %s, %v", sibling, rollbackDir, err)
+	}
+	for _, dir := range []string{importDir, path.Join(importDir, "rollback"), importDir + "/rollback/../"} {
+		if _, err := rollbackDirectory(dir, importDir); err == nil {
+			t.Errorf("expected an error for %s inside the import directory", dir)
+		}
+	}
+}
+
+func TestReadExportedImages(t *testing.T) {
+	importDir := t.TempDir()
+	if images, err := readExportedImages(importDir); err != nil || len(images) != 0 {
+		t.Errorf("expected no images without export report, got %v, %v", images, err)
+	}
+	content := `{"images": ["sles15:1.0.0"]}`
+	if err := os.WriteFile(path.Join(importDir, exportReportFile), []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	images, err := readExportedImages(importDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(images, []string{"sles15:1.0.0"}) {
+		t.Errorf("expected the images of the export report, got %v", images)
+	}
+}
@@ -0,0 +1,53 @@
+// SPDX-FileCopyrightText: 2023 SUSE LLC
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package iss
+
+import (
+	"os"
+	"time"
+
+	"github.com/uyuni-project/inter-server-sync/entityDumper"
+)
+
+// Options describes what Export writes and where
+type Options = entityDumper.DumperOptions
+
+// ImportOptions describes the export directory to import and how to reach the target server
+type ImportOptions struct {
+	ServerConfig   string
+	ImportDir      string
+	XmlRpcUser     string
+	XmlRpcPassword string
+	// PackageOwner and ImageOwner, as user:group, own the installed package and image files, unchanged when empty
+	PackageOwner string
+	ImageOwner   string
+	// FileMode and DirMode are the permissions of the installed files and of the directories created for them,
+	// 0644 and 0755 when not set
+	FileMode os.FileMode
+	DirMode  os.FileMode
+	// MoveFiles moves the files of the import directory in place instead of copying them
+	MoveFiles bool
+	// RollbackDir receives the rollback bundle written before the import, DefaultRollbackDir when empty
+	RollbackDir string
+}
+
+// CompareOptions describes the channels to compare between the server and a target server
+type CompareOptions struct {
+	ServerConfig  string
+	TargetConfig  string
+	ChannelLabels []string
+}
+
+// Report summarizes an export or an import
+type Report struct {
+	Directory      string    `json:"directory"`
+	StartTime      time.Time `json:"start_time"`
+	EndTime        time.Time `json:"end_time"`
+	Channels       []string  `json:"channels"`
+	ConfigChannels []string  `json:"config_channels"`
+	// DroppedRelations describes the channel relations left out of an export, the import drops them unless the
+	// target server has the related channels
+	DroppedRelations []string `json:"dropped_relations,omitempty"`
+}
@@ -0,0 +1,145 @@
+// SPDX-FileCopyrightText: 2023 SUSE LLC
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// metricPrefix names every metric; each sample also has the operation label, so the textfiles
+// of different operations do not define the same series
+const metricPrefix = "iss_"
+
+type sample struct {
+	labels string
+	value  float64
+}
+
+// Write writes the collected metrics in the Prometheus text exposition format
+func (c *Collector) Write(w io.Writer) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var buffer bytes.Buffer
+	end := c.end
+	if !c.finished {
+		end = time.Now()
+	}
+
+	writeFamily(&buffer, c.operation, "run_start_timestamp_seconds", "gauge", "Start time of the run",
+		[]sample{{"", float64(c.start.UnixNano()) / 1e9}})
+	writeFamily(&buffer, c.operation, "run_duration_seconds", "gauge", "Duration of the run, so far if still running",
+		[]sample{{"", end.Sub(c.start).Seconds()}})
+	if c.finished {
+		writeFamily(&buffer, c.operation, "run_end_timestamp_seconds", "gauge", "End time of the run",
+			[]sample{{"", float64(end.UnixNano()) / 1e9}})
+		writeFamily(&buffer, c.operation, "run_success", "gauge", "Whether the run succeeded (1) or failed (0)",
+			[]sample{{"", boolValue(c.succeeded)}})
+	}
+
+	phases := make([]sample, 0, len(c.phaseDurations))
+	for phase, seconds := range c.phaseDurations {
+		phases = append(phases, sample{label("phase", phase), seconds})
+	}
+	writeFamily(&buffer, c.operation, "phase_duration_seconds", "gauge", "Duration of each finished phase", phases)
+
+	channels := make([]sample, 0, len(c.channelDurations))
+	for key, seconds := range c.channelDurations {
+		channels = append(channels, sample{label("phase", key.phase) + "," + label("channel", key.channel), seconds})
+	}
+	writeFamily(&buffer, c.operation, "channel_duration_seconds", "gauge", "Duration of the processing of each channel", channels)
+
+	writeFamily(&buffer, c.operation, "table_rows_total", "counter", "Rows written per table", countSamples("table", c.tableRows))
+	writeFamily(&buffer, c.operation, "copied_files_total", "counter", "Files copied", []sample{{"", float64(c.copiedFiles)}})
+	writeFamily(&buffer, c.operation, "copied_bytes_total", "counter", "Bytes copied", []sample{{"", float64(c.copiedBytes)}})
+	writeFamily(&buffer, c.operation, "reference_cache_hits_total", "counter", "Foreign key references resolved from the cache, per referenced table",
+		countSamples("table", c.cacheHits))
+	writeFamily(&buffer, c.operation, "reference_cache_misses_total", "counter", "Foreign key references resolved with a query, per referenced table",
+		countSamples("table", c.cacheMisses))
+	writeFamily(&buffer, c.operation, "db_queries_total", "counter", "Database queries executed", []sample{{"", float64(c.queries)}})
+	writeFamily(&buffer, c.operation, "db_query_errors_total", "counter", "Database queries failed", []sample{{"", float64(c.queryErrors)}})
+	writeFamily(&buffer, c.operation, "db_query_duration_seconds_total", "counter", "Time spent executing database queries",
+		[]sample{{"", c.querySeconds}})
+
+	_, err := buffer.WriteTo(w)
+	return err
+}
+
+// WriteTextfile writes the metrics to path for the node_exporter textfile collector.
+// The file is replaced atomically, so the collector never reads a partial file.
+func (c *Collector) WriteTextfile(path string) error {
+	tmpFile, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("error creating metrics file: %w", err)
+	}
+	defer os.Remove(tmpFile.Name())
+	if err := c.Write(tmpFile); err != nil {
+		tmpFile.Close()
+		return fmt.Errorf("error writing metrics file: %w", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		return fmt.Errorf("error writing metrics file: %w", err)
+	}
+	if err := os.Chmod(tmpFile.Name(), 0644); err != nil {
+		return fmt.Errorf("error writing metrics file: %w", err)
+	}
+	if err := os.Rename(tmpFile.Name(), path); err != nil {
+		return fmt.Errorf("error writing metrics file: %w", err)
+	}
+	return nil
+}
+
+// ServeHTTP exposes the current metrics to a Prometheus scrape
+func (c *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := c.Write(w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func writeFamily(buffer *bytes.Buffer, operation string, name string, kind string, help string, samples []sample) {
+	if len(samples) == 0 {
+		return
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i].labels < samples[j].labels })
+	fmt.Fprintf(buffer, "# HELP %s%s %s\n", metricPrefix, name, help)
+	fmt.Fprintf(buffer, "# TYPE %s%s %s\n", metricPrefix, name, kind)
+	for _, s := range samples {
+		labels := label("operation", operation)
+		if s.labels != "" {
+			labels += "," + s.labels
+		}
+		fmt.Fprintf(buffer, "%s%s{%s} %g\n", metricPrefix, name, labels, s.value)
+	}
+}
+
+func countSamples(labelName string, counts map[string]int64) []sample {
+	samples := make([]sample, 0, len(counts))
+	for value, count := range counts {
+		samples = append(samples, sample{label(labelName, value), float64(count)})
+	}
+	return samples
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func label(name string, value string) string {
+	return fmt.Sprintf(`%s="%s"`, name, labelValueEscaper.Replace(value))
+}
+
+func boolValue(value bool) float64 {
+	if value {
+		return 1
+	}
+	return 0
+}
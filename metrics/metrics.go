@@ -0,0 +1,162 @@
+// SPDX-FileCopyrightText: 2023 SUSE LLC
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package metrics collects statistics of an export or import run and exposes them in the Prometheus text format.
+// The Collector travels in the context, like the progress reporters, and receives the progress events.
+package metrics
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/uyuni-project/inter-server-sync/progress"
+)
+
+// Collector accumulates the metrics of one run of operation
+type Collector struct {
+	mutex     sync.Mutex
+	operation string
+	start     time.Time
+	end       time.Time
+	finished  bool
+	succeeded bool
+
+	phaseStart     map[string]time.Time
+	phaseDurations map[string]float64
+
+	channel          channelKey
+	channelStart     time.Time
+	channelDurations map[channelKey]float64
+
+	tableRows    map[string]int64
+	copiedFiles  int64
+	copiedBytes  int64
+	cacheHits    map[string]int64
+	cacheMisses  map[string]int64
+	queries      int64
+	queryErrors  int64
+	querySeconds float64
+}
+
+type channelKey struct {
+	phase   string
+	channel string
+}
+
+func NewCollector(operation string) *Collector {
+	return &Collector{
+		operation:        operation,
+		start:            time.Now(),
+		phaseStart:       make(map[string]time.Time),
+		phaseDurations:   make(map[string]float64),
+		channelDurations: make(map[channelKey]float64),
+		tableRows:        make(map[string]int64),
+		cacheHits:        make(map[string]int64),
+		cacheMisses:      make(map[string]int64),
+	}
+}
+
+// Finish records the end of the run and its result
+func (c *Collector) Finish(err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.end = time.Now()
+	c.finished = true
+	c.succeeded = err == nil
+}
+
+// Report derives the phase and channel durations and the copied files from the progress events
+func (c *Collector) Report(event progress.Event) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	switch event.Event {
+	case progress.PhaseStarted:
+		c.phaseStart[event.Phase] = event.Time
+	case progress.PhaseFinished:
+		if start, ok := c.phaseStart[event.Phase]; ok {
+			c.phaseDurations[event.Phase] += event.Time.Sub(start).Seconds()
+			delete(c.phaseStart, event.Phase)
+		}
+		if c.channel.phase == event.Phase {
+			c.finishChannel(event.Time)
+		}
+	case progress.ChannelStarted:
+		c.finishChannel(event.Time)
+		c.channel = channelKey{phase: event.Phase, channel: event.Channel}
+		c.channelStart = event.Time
+	case progress.FilesCopied:
+		c.copiedFiles++
+		c.copiedBytes += event.Bytes
+	}
+}
+
+func (c *Collector) finishChannel(now time.Time) {
+	if c.channel.channel == "" {
+		return
+	}
+	c.channelDurations[c.channel] += now.Sub(c.channelStart).Seconds()
+	c.channel = channelKey{}
+}
+
+type collectorKey struct{}
+
+// WithCollector returns a context collecting the metrics, and the progress events, in collector
+func WithCollector(ctx context.Context, collector *Collector) context.Context {
+	ctx = context.WithValue(ctx, collectorKey{}, collector)
+	return progress.WithReporter(ctx, collector)
+}
+
+func fromContext(ctx context.Context) *Collector {
+	collector, _ := ctx.Value(collectorKey{}).(*Collector)
+	return collector
+}
+
+// ObserveQuery records a database query, its duration and whether it failed
+func ObserveQuery(ctx context.Context, duration time.Duration, err error) {
+	c := fromContext(ctx)
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.queries++
+	c.querySeconds += duration.Seconds()
+	if err != nil {
+		c.queryErrors++
+	}
+}
+
+// ReferenceCacheHit records a foreign key reference of table resolved from the cache
+func ReferenceCacheHit(ctx context.Context, table string) {
+	c := fromContext(ctx)
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.cacheHits[table]++
+}
+
+// ReferenceCacheMiss records a foreign key reference of table resolved with a query
+func ReferenceCacheMiss(ctx context.Context, table string) {
+	c := fromContext(ctx)
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.cacheMisses[table]++
+}
+
+// AddTableRows records rows written for table
+func AddTableRows(ctx context.Context, table string, rows int) {
+	c := fromContext(ctx)
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.tableRows[table] += int64(rows)
+}
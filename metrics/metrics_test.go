@@ -0,0 +1,88 @@
+// SPDX-FileCopyrightText: 2023 SUSE LLC
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/uyuni-project/inter-server-sync/progress"
+)
+
+func TestCollectorExposition(t *testing.T) {
+	collector := NewCollector("export")
+	ctx := WithCollector(context.Background(), collector)
+
+	start := time.Now()
+	progress.Report(ctx, progress.Event{Time: start, Event: progress.PhaseStarted, Phase: "channels"})
+	progress.Report(ctx, progress.Event{Time: start, Event: progress.ChannelStarted, Phase: "channels", Channel: "test-channel"})
+	progress.Report(ctx, progress.Event{Event: progress.FilesCopied, File: "package.rpm", Bytes: 1024})
+	progress.Report(ctx, progress.Event{Time: start.Add(2 * time.Second), Event: progress.PhaseFinished, Phase: "channels"})
+	ObserveQuery(ctx, 500*time.Millisecond, nil)
+	ObserveQuery(ctx, 500*time.Millisecond, errors.New("failure"))
+	ReferenceCacheHit(ctx, "rhnchannel")
+	ReferenceCacheMiss(ctx, "rhnchannel")
+	ReferenceCacheMiss(ctx, "rhnchannel")
+	AddTableRows(ctx, "rhnpackage", 10)
+	collector.Finish(errors.New("failure"))
+
+	var buffer bytes.Buffer
+	if err := collector.Write(&buffer); err != nil {
+		t.Fatal(err)
+	}
+	output := buffer.String()
+	expected := []string{
+		"# TYPE iss_run_success gauge",
+		`iss_run_success{operation="export"} 0`,
+		`iss_phase_duration_seconds{operation="export",phase="channels"} 2`,
+		`iss_channel_duration_seconds{operation="export",phase="channels",channel="test-channel"} 2`,
+		`iss_table_rows_total{operation="export",table="rhnpackage"} 10`,
+		`iss_copied_files_total{operation="export"} 1`,
+		`iss_copied_bytes_total{operation="export"} 1024`,
+		`iss_reference_cache_hits_total{operation="export",table="rhnchannel"} 1`,
+		`iss_reference_cache_misses_total{operation="export",table="rhnchannel"} 2`,
+		`iss_db_queries_total{operation="export"} 2`,
+		`iss_db_query_errors_total{operation="export"} 1`,
+		`iss_db_query_duration_seconds_total{operation="export"} 1`,
+	}
+	for _, line := range expected {
+		if !strings.Contains(output, line+"\n") {
+			t.Errorf("expected line %q in:\n%s", line, output)
+		}
+	}
+}
+
+func TestWriteTextfile(t *testing.T) {
+	collector := NewCollector("import")
+	collector.Finish(nil)
+	path := filepath.Join(t.TempDir(), "iss.prom")
+
+	if err := collector.WriteTextfile(path); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), `iss_run_success{operation="import"} 1`) {
+		t.Errorf("unexpected metrics file content:\n%s", content)
+	}
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("expected only the metrics file, found %d entries", len(entries))
+	}
+}
+
+func TestLabelEscaping(t *testing.T) {
+	if got := label("channel", "a\"b\\c\nd"); got != `channel="a\"b\\c\nd"` {
+		t.Errorf("unexpected escaped label %s", got)
+	}
+}
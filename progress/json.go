@@ -0,0 +1,28 @@
+// SPDX-FileCopyrightText: 2023 SUSE LLC
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package progress
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// JSONReporter writes each event as a JSON object on its own line
+type JSONReporter struct {
+	mutex   sync.Mutex
+	encoder *json.Encoder
+}
+
+func NewJSONReporter(writer io.Writer) *JSONReporter {
+	return &JSONReporter{encoder: json.NewEncoder(writer)}
+}
+
+func (reporter *JSONReporter) Report(event Event) {
+	reporter.mutex.Lock()
+	defer reporter.mutex.Unlock()
+	// progress is best effort, a closed stream must not interrupt the export
+	_ = reporter.encoder.Encode(event)
+}
@@ -0,0 +1,99 @@
+// SPDX-FileCopyrightText: 2023 SUSE LLC
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package progress reports the progress of exports and imports as structured events.
+// The Reporter travels in the context, so every step receiving the context can report its progress.
+package progress
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	// PhaseStarted and PhaseFinished surround each step of an export or import. Error is set if the phase failed.
+	PhaseStarted  = "phase_started"
+	PhaseFinished = "phase_finished"
+	// ChannelStarted is sent before processing channel Current of Total
+	ChannelStarted = "channel_started"
+	// TableStarted is sent before writing the data of table Current of Total
+	TableStarted = "table_started"
+	// RowsCrawled reports the number of Rows found so far, starting from Table
+	RowsCrawled = "rows_crawled"
+	// TableCrawled is sent at the end of a crawl for each Table found, with its number of Rows
+	TableCrawled = "table_crawled"
+	// RowsWritten reports the Rows written for Table, Current of Total rows being written so far
+	RowsWritten = "rows_written"
+	// FilesCopied is sent for each copied File, with its size in Bytes and the LinkMode used to put it in the export.
+	// Current and Total are set when known.
+	FilesCopied = "files_copied"
+	// ImageExported is sent for each exported Image
+	ImageExported = "image_exported"
+	// Warning reports a Message about a problem which does not stop the export or import
+	Warning = "warning"
+)
+
+// Event describes a step of the progress, fields not relevant for the Event type are left empty
+type Event struct {
+	Time     time.Time `json:"time"`
+	Event    string    `json:"event"`
+	Phase    string    `json:"phase,omitempty"`
+	Channel  string    `json:"channel,omitempty"`
+	Table    string    `json:"table,omitempty"`
+	File     string    `json:"file,omitempty"`
+	Image    string    `json:"image,omitempty"`
+	Current  int       `json:"current,omitempty"`
+	Total    int       `json:"total,omitempty"`
+	Rows     int       `json:"rows,omitempty"`
+	Bytes    int64     `json:"bytes,omitempty"`
+	LinkMode string    `json:"link_mode,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	Message  string    `json:"message,omitempty"`
+}
+
+// Reporter receives the progress events. It may be called from several goroutines.
+type Reporter interface {
+	Report(event Event)
+}
+
+type reporterKey struct{}
+
+// WithReporter returns a context reporting the progress to reporter, in addition to the reporters already in ctx
+func WithReporter(ctx context.Context, reporter Reporter) context.Context {
+	reporters, _ := ctx.Value(reporterKey{}).([]Reporter)
+	reporters = append(reporters[:len(reporters):len(reporters)], reporter)
+	return context.WithValue(ctx, reporterKey{}, reporters)
+}
+
+// Report sends the event to the Reporters of the context, if any
+func Report(ctx context.Context, event Event) {
+	reporters, _ := ctx.Value(reporterKey{}).([]Reporter)
+	if len(reporters) == 0 {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	for _, reporter := range reporters {
+		reporter.Report(event)
+	}
+}
+
+// Warn reports a Warning event with the formatted message
+func Warn(ctx context.Context, format string, args ...interface{}) {
+	Report(ctx, Event{Event: Warning, Message: fmt.Sprintf(format, args...)})
+}
+
+// StartPhase reports the start of phase and returns a function reporting its end with the resulting error
+func StartPhase(ctx context.Context, phase string) func(err error) {
+	Report(ctx, Event{Event: PhaseStarted, Phase: phase})
+	return func(err error) {
+		event := Event{Event: PhaseFinished, Phase: phase}
+		if err != nil {
+			event.Error = err.Error()
+		}
+		Report(ctx, event)
+	}
+}
@@ -0,0 +1,63 @@
+// SPDX-FileCopyrightText: 2023 SUSE LLC
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package progress
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestJSONReporter(t *testing.T) {
+	var buffer bytes.Buffer
+	ctx := WithReporter(context.Background(), NewJSONReporter(&buffer))
+
+	finish := StartPhase(ctx, "channels")
+	Report(ctx, Event{Event: ChannelStarted, Channel: "test-channel", Current: 1, Total: 2})
+	finish(errors.New("failure"))
+
+	lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 events, got %d: %s", len(lines), buffer.String())
+	}
+	expected := []Event{
+		{Event: PhaseStarted, Phase: "channels"},
+		{Event: ChannelStarted, Channel: "test-channel", Current: 1, Total: 2},
+		{Event: PhaseFinished, Phase: "channels", Error: "failure"},
+	}
+	for i, line := range lines {
+		var event Event
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatalf("invalid JSON %s: %v", line, err)
+		}
+		if event.Time.IsZero() {
+			t.Errorf("event %d has no time", i)
+		}
+		event.Time = expected[i].Time
+		if event != expected[i] {
+			t.Errorf("event %d: expected %+v, got %+v", i, expected[i], event)
+		}
+	}
+}
+
+func TestReportWithoutReporter(t *testing.T) {
+	// must not panic
+	Report(context.Background(), Event{Event: RowsCrawled, Rows: 1})
+}
+
+func TestReportToSeveralReporters(t *testing.T) {
+	var first, second bytes.Buffer
+	ctx := WithReporter(context.Background(), NewJSONReporter(&first))
+	ctx = WithReporter(ctx, NewJSONReporter(&second))
+
+	Report(ctx, Event{Event: RowsWritten, Rows: 1})
+
+	if first.Len() == 0 || first.String() != second.String() {
+		t.Errorf("expected the same event on both reporters, got %q and %q", first.String(), second.String())
+	}
+}
@@ -10,8 +10,6 @@ import (
 	"fmt"
 	"os"
 	"strings"
-
-	"github.com/rs/zerolog/log"
 )
 
 type dataSource struct {
@@ -23,10 +21,10 @@ type dataSource struct {
 }
 
 // GetConnectionString return the connection string for the database after reading config file for
-func GetConnectionString(configFilePath string) string {
+func GetConnectionString(configFilePath string) (string, error) {
 	file, err := os.Open(configFilePath)
 	if err != nil {
-		log.Panic().Err(err).Msg("error loading configuration file")
+		return "", fmt.Errorf("error loading configuration file: %w", err)
 	}
 	defer file.Close()
 
@@ -56,14 +54,21 @@ func GetConnectionString(configFilePath string) string {
 			}
 		}
 	}
-	return fmt.Sprintf("user='%s' password='%s' dbname='%s' host='%s' port='%s' sslmode=disable", dataSource.user, dataSource.password, dataSource.dbname, dataSource.host, dataSource.port)
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("error reading configuration file: %w", err)
+	}
+	return fmt.Sprintf("user='%s' password='%s' dbname='%s' host='%s' port='%s' sslmode=disable", dataSource.user, dataSource.password, dataSource.dbname, dataSource.host, dataSource.port), nil
 }
 
 //GetDBconnection return the database connection
-func GetDBconnection(configFilePath string) *sql.DB {
-	db, err := sql.Open("postgres", GetConnectionString(configFilePath))
+func GetDBconnection(configFilePath string) (*sql.DB, error) {
+	connectionString, err := GetConnectionString(configFilePath)
+	if err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("postgres", connectionString)
 	if err != nil {
-		log.Panic().Err(err).Msg("error getting connection to the database")
+		return nil, fmt.Errorf("error getting connection to the database: %w", err)
 	}
-	return db
+	return db, nil
 }
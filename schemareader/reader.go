@@ -6,12 +6,13 @@ package schemareader
 
 import (
 	"database/sql"
+	"fmt"
 	"strings"
 
 	"github.com/rs/zerolog/log"
 )
 
-func readTableNames(db *sql.DB) []string {
+func readTableNames(db *sql.DB) ([]string, error) {
 	sql := `SELECT table_name
 		FROM information_schema.tables
 		WHERE table_schema = 'public'
@@ -19,23 +20,24 @@ func readTableNames(db *sql.DB) []string {
 
 	rows, err := db.Query(sql)
 	if err != nil {
-		log.Panic().Err(err).Msg("error executing database query")
+		return nil, fmt.Errorf("error executing database query: %w", err)
 	}
+	defer rows.Close()
 
 	result := make([]string, 0)
 	for rows.Next() {
 		var tableName string
 		err := rows.Scan(&tableName)
 		if err != nil {
-			log.Panic().Err(err).Msg("error extracting row")
+			return nil, fmt.Errorf("error extracting row: %w", err)
 		}
 		result = append(result, tableName)
 	}
 
-	return result
+	return result, rows.Err()
 }
 
-func readColumnNames(db *sql.DB, tableName string) []string {
+func readColumnNames(db *sql.DB, tableName string) ([]string, error) {
 	sql := `SELECT column_name
 		FROM information_schema.columns
 		WHERE table_schema = 'public' AND table_name = $1
@@ -43,7 +45,7 @@ func readColumnNames(db *sql.DB, tableName string) []string {
 
 	rows, err := db.Query(sql, tableName)
 	if err != nil {
-		log.Panic().Err(err).Msg("error accessing the database")
+		return nil, fmt.Errorf("error accessing the database: %w", err)
 	}
 	defer rows.Close()
 
@@ -52,15 +54,15 @@ func readColumnNames(db *sql.DB, tableName string) []string {
 		var columnName string
 		err := rows.Scan(&columnName)
 		if err != nil {
-			log.Panic().Err(err).Msg("error extracting row")
+			return nil, fmt.Errorf("error extracting row: %w", err)
 		}
 		result = append(result, columnName)
 	}
 
-	return result
+	return result, rows.Err()
 }
 
-func readPKColumnNames(db *sql.DB, tableName string) []string {
+func readPKColumnNames(db *sql.DB, tableName string) ([]string, error) {
 	// https://wiki.postgresql.org/wiki/Retrieve_primary_key_columns
 	sql := `SELECT a.attname
 		FROM pg_index i
@@ -71,7 +73,7 @@ func readPKColumnNames(db *sql.DB, tableName string) []string {
 
 	rows, err := db.Query(sql, tableName)
 	if err != nil {
-		log.Panic().Err(err).Msg("error executing query")
+		return nil, fmt.Errorf("error executing query: %w", err)
 	}
 	defer rows.Close()
 
@@ -80,15 +82,15 @@ func readPKColumnNames(db *sql.DB, tableName string) []string {
 		var columnName string
 		err := rows.Scan(&columnName)
 		if err != nil {
-			log.Panic().Err(err).Msg("error getting row data")
+			return nil, fmt.Errorf("error getting row data: %w", err)
 		}
 		result = append(result, columnName)
 	}
 
-	return result
+	return result, rows.Err()
 }
 
-func readUniqueIndexNames(db *sql.DB, tableName string) []string {
+func readUniqueIndexNames(db *sql.DB, tableName string) ([]string, error) {
 	sql := `SELECT DISTINCT indexrelid::regclass
 		FROM pg_index i
 		JOIN pg_attribute a ON a.attrelid = i.indrelid
@@ -98,7 +100,7 @@ func readUniqueIndexNames(db *sql.DB, tableName string) []string {
 
 	rows, err := db.Query(sql, tableName)
 	if err != nil {
-		log.Panic().Err(err).Msg("error executing query")
+		return nil, fmt.Errorf("error executing query: %w", err)
 	}
 	defer rows.Close()
 
@@ -107,15 +109,15 @@ func readUniqueIndexNames(db *sql.DB, tableName string) []string {
 		var name string
 		err := rows.Scan(&name)
 		if err != nil {
-			log.Panic().Err(err).Msg("error getting column data")
+			return nil, fmt.Errorf("error getting column data: %w", err)
 		}
 		result = append(result, name)
 	}
 
-	return result
+	return result, rows.Err()
 }
 
-func readIndexColumns(db *sql.DB, indexName string) []string {
+func readIndexColumns(db *sql.DB, indexName string) ([]string, error) {
 	sql := `SELECT DISTINCT a.attname
 		FROM pg_index i
 		JOIN pg_attribute a ON a.attrelid = i.indrelid
@@ -124,7 +126,7 @@ func readIndexColumns(db *sql.DB, indexName string) []string {
 
 	rows, err := db.Query(sql, indexName)
 	if err != nil {
-		log.Panic().Err(err).Msg("error executing query")
+		return nil, fmt.Errorf("error executing query: %w", err)
 	}
 	defer rows.Close()
 
@@ -133,15 +135,15 @@ func readIndexColumns(db *sql.DB, indexName string) []string {
 		var name string
 		err := rows.Scan(&name)
 		if err != nil {
-			log.Panic().Err(err).Msg("error getting column data")
+			return nil, fmt.Errorf("error getting column data: %w", err)
 		}
 		result = append(result, name)
 	}
 
-	return result
+	return result, rows.Err()
 }
 
-func readReferenceConstraintNames(db *sql.DB, tableName string) []string {
+func readReferenceConstraintNames(db *sql.DB, tableName string) ([]string, error) {
 	sql := `SELECT DISTINCT tc.constraint_name
 		FROM information_schema.table_constraints AS tc
 			JOIN information_schema.constraint_column_usage AS ccu ON ccu.constraint_name = tc.constraint_name
@@ -150,7 +152,7 @@ func readReferenceConstraintNames(db *sql.DB, tableName string) []string {
 
 	rows, err := db.Query(sql, tableName)
 	if err != nil {
-		log.Panic().Err(err).Msg("error executing query")
+		return nil, fmt.Errorf("error executing query: %w", err)
 	}
 	defer rows.Close()
 
@@ -159,15 +161,15 @@ func readReferenceConstraintNames(db *sql.DB, tableName string) []string {
 		var name string
 		err := rows.Scan(&name)
 		if err != nil {
-			log.Panic().Err(err).Msg("error getting column data")
+			return nil, fmt.Errorf("error getting column data: %w", err)
 		}
 		result = append(result, name)
 	}
 
-	return result
+	return result, rows.Err()
 }
 
-func readReferencedByConstraintNames(db *sql.DB, tableName string) []string {
+func readReferencedByConstraintNames(db *sql.DB, tableName string) ([]string, error) {
 	sql := `SELECT DISTINCT tc.constraint_name
 		FROM information_schema.table_constraints AS tc
 			JOIN information_schema.constraint_column_usage AS ccu ON ccu.constraint_name = tc.constraint_name
@@ -176,7 +178,7 @@ func readReferencedByConstraintNames(db *sql.DB, tableName string) []string {
 
 	rows, err := db.Query(sql, tableName)
 	if err != nil {
-		log.Panic().Err(err).Msg("error executing query")
+		return nil, fmt.Errorf("error executing query: %w", err)
 	}
 	defer rows.Close()
 
@@ -185,51 +187,57 @@ func readReferencedByConstraintNames(db *sql.DB, tableName string) []string {
 		var name string
 		err := rows.Scan(&name)
 		if err != nil {
-			log.Panic().Err(err).Msg("error getting column data")
+			return nil, fmt.Errorf("error getting column data: %w", err)
 		}
 		result = append(result, name)
 	}
 
-	return result
+	return result, rows.Err()
 }
 
-func readReferencedTable(db *sql.DB, referenceConstraintName string) string {
+func readReferencedTable(db *sql.DB, referenceConstraintName string) (string, error) {
 	sql := `SELECT DISTINCT ccu.table_name
 	FROM information_schema.constraint_column_usage AS ccu
 	WHERE ccu.constraint_name = $1;`
 
 	rows, err := db.Query(sql, referenceConstraintName)
 	if err != nil {
-		log.Panic().Err(err).Msg("error executing query")
+		return "", fmt.Errorf("error executing query: %w", err)
 	}
 	defer rows.Close()
 
 	var name string
-	rows.Next()
-	rows.Scan(&name)
+	if rows.Next() {
+		if err := rows.Scan(&name); err != nil {
+			return "", fmt.Errorf("error getting column data: %w", err)
+		}
+	}
 
-	return name
+	return name, rows.Err()
 }
 
-func readReferencedByTable(db *sql.DB, referenceConstraintName string) string {
+func readReferencedByTable(db *sql.DB, referenceConstraintName string) (string, error) {
 	sql := `SELECT DISTINCT table_name
 	FROM information_schema.table_constraints as tc 
 	WHERE tc.constraint_name = $1;`
 
 	rows, err := db.Query(sql, referenceConstraintName)
 	if err != nil {
-		log.Panic().Err(err).Msg("error executing query")
+		return "", fmt.Errorf("error executing query: %w", err)
 	}
 	defer rows.Close()
 
 	var name string
-	rows.Next()
-	rows.Scan(&name)
+	if rows.Next() {
+		if err := rows.Scan(&name); err != nil {
+			return "", fmt.Errorf("error getting column data: %w", err)
+		}
+	}
 
-	return name
+	return name, rows.Err()
 }
 
-func readReferenceConstraints(db *sql.DB, tableName string, referenceConstraintName string) map[string]string {
+func readReferenceConstraints(db *sql.DB, tableName string, referenceConstraintName string) (map[string]string, error) {
 	sql := `SELECT DISTINCT kcu.column_name, ccu.column_name AS foreign_column_name
 		FROM information_schema.table_constraints AS tc
 		JOIN information_schema.key_column_usage AS kcu ON tc.constraint_name = kcu.constraint_name
@@ -243,7 +251,7 @@ func readReferenceConstraints(db *sql.DB, tableName string, referenceConstraintN
 
 	rows, err := db.Query(sql, tableName, referenceConstraintName)
 	if err != nil {
-		log.Panic().Err(err).Msg("error executing query")
+		return nil, fmt.Errorf("error executing query: %w", err)
 	}
 	defer rows.Close()
 
@@ -253,12 +261,12 @@ func readReferenceConstraints(db *sql.DB, tableName string, referenceConstraintN
 		var foreignColumnName string
 		err := rows.Scan(&columnName, &foreignColumnName)
 		if err != nil {
-			log.Panic().Err(err).Msg("error getting column data")
+			return nil, fmt.Errorf("error getting column data: %w", err)
 		}
 		result[columnName] = foreignColumnName
 	}
 
-	return result
+	return result, rows.Err()
 }
 
 func findIndex(indexes map[string]UniqueIndex, columnName string) string {
@@ -285,7 +293,7 @@ func findIndexMostColumns(indexes map[string]UniqueIndex) string {
 	return result
 }
 
-func readPKSequence(db *sql.DB, tableName string) string {
+func readPKSequence(db *sql.DB, tableName string) (string, error) {
 	sql := `WITH sequences AS (
 		SELECT sequence_name
 			FROM information_schema.sequences
@@ -313,28 +321,38 @@ func readPKSequence(db *sql.DB, tableName string) string {
 
 	rows, err := db.Query(sql, tableName)
 	if err != nil {
-		log.Panic().Err(err).Msg("error executing query")
+		return "", fmt.Errorf("error executing query: %w", err)
 	}
 	defer rows.Close()
 
 	var name string
-	rows.Next()
-	rows.Scan(&name)
+	if rows.Next() {
+		if err := rows.Scan(&name); err != nil {
+			return "", fmt.Errorf("error getting column data: %w", err)
+		}
+	}
 
-	return name
+	return name, rows.Err()
 }
 
 // ReadTablesSchema inspects the DB and returns a list of tables
-func ReadAllTablesSchema(db *sql.DB) map[string]Table {
-	return ReadTablesSchema(db, readTableNames(db))
+func ReadAllTablesSchema(db *sql.DB) (map[string]Table, error) {
+	tableNames, err := readTableNames(db)
+	if err != nil {
+		return nil, err
+	}
+	return ReadTablesSchema(db, tableNames)
 }
 
-func ReadTablesSchema(db *sql.DB, tableNames []string) map[string]Table {
+func ReadTablesSchema(db *sql.DB, tableNames []string) (map[string]Table, error) {
 
 	result := make(map[string]Table, 0)
 	for _, tableName := range tableNames {
-		table, err := processTable(db, strings.ToLower(tableName), true)
-		if err {
+		table, ignored, err := processTable(db, strings.ToLower(tableName), true)
+		if err != nil {
+			return nil, err
+		}
+		if ignored {
 			continue
 		}
 		result[table.Name] = table
@@ -342,31 +360,45 @@ func ReadTablesSchema(db *sql.DB, tableNames []string) map[string]Table {
 
 	//Load all reference tables not loaded yet
 	for _, table := range result {
-		result = processReferenceTables(db, table, result)
+		var err error
+		result, err = processReferenceTables(db, table, result)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	return result
+	return result, nil
 }
 
-func processReferenceTables(db *sql.DB, table Table, currentTables map[string]Table) map[string]Table {
+func processReferenceTables(db *sql.DB, table Table, currentTables map[string]Table) (map[string]Table, error) {
 	for _, reference := range table.References {
 		_, ok := currentTables[reference.TableName]
 		if ok {
 			continue
 		}
-		tableProcessed, _ := processTable(db, reference.TableName, false)
+		tableProcessed, _, err := processTable(db, reference.TableName, false)
+		if err != nil {
+			return nil, err
+		}
 		currentTables[reference.TableName] = tableProcessed
-		currentTables = processReferenceTables(db, tableProcessed, currentTables)
+		currentTables, err = processReferenceTables(db, tableProcessed, currentTables)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	return currentTables
+	return currentTables, nil
 }
 
-func processTable(db *sql.DB, tableName string, exportable bool) (Table, bool) {
-	columns := readColumnNames(db, tableName)
+// processTable reads the table metadata, returning true if the table does not exist and should be ignored
+func processTable(db *sql.DB, tableName string, exportable bool) (Table, bool, error) {
+	columns, err := readColumnNames(db, tableName)
+	if err != nil {
+		return Table{}, false, fmt.Errorf("error reading columns of table %s: %w", tableName, err)
+	}
 	if len(columns) == 0 {
 		log.Info().Msgf("Ignoring nonexisting table %s", tableName)
-		return Table{}, true
+		return Table{}, true, nil
 	}
 
 	columnIndexes := make(map[string]int)
@@ -374,18 +406,30 @@ func processTable(db *sql.DB, tableName string, exportable bool) (Table, bool) {
 		columnIndexes[columnName] = i
 	}
 
-	pkColumns := readPKColumnNames(db, tableName)
+	pkColumns, err := readPKColumnNames(db, tableName)
+	if err != nil {
+		return Table{}, false, fmt.Errorf("error reading primary key of table %s: %w", tableName, err)
+	}
 	pkColumnMap := make(map[string]bool)
 	for _, column := range pkColumns {
 		pkColumnMap[column] = true
 	}
 
-	pkSequence := readPKSequence(db, tableName)
+	pkSequence, err := readPKSequence(db, tableName)
+	if err != nil {
+		return Table{}, false, fmt.Errorf("error reading primary key sequence of table %s: %w", tableName, err)
+	}
 
-	indexNames := readUniqueIndexNames(db, tableName)
+	indexNames, err := readUniqueIndexNames(db, tableName)
+	if err != nil {
+		return Table{}, false, fmt.Errorf("error reading unique indexes of table %s: %w", tableName, err)
+	}
 	indexes := make(map[string]UniqueIndex)
 	for _, indexName := range indexNames {
-		indexColumns := readIndexColumns(db, indexName)
+		indexColumns, err := readIndexColumns(db, indexName)
+		if err != nil {
+			return Table{}, false, fmt.Errorf("error reading columns of index %s: %w", indexName, err)
+		}
 		indexes[indexName] = UniqueIndex{Name: indexName, Columns: indexColumns}
 	}
 
@@ -405,19 +449,37 @@ func processTable(db *sql.DB, tableName string, exportable bool) (Table, bool) {
 		}
 	}
 
-	constraintNames := readReferenceConstraintNames(db, tableName)
+	constraintNames, err := readReferenceConstraintNames(db, tableName)
+	if err != nil {
+		return Table{}, false, fmt.Errorf("error reading references of table %s: %w", tableName, err)
+	}
 	references := make([]Reference, 0)
 	for _, constraintName := range constraintNames {
-		columnMap := readReferenceConstraints(db, tableName, constraintName)
-		referencedTable := readReferencedTable(db, constraintName)
+		columnMap, err := readReferenceConstraints(db, tableName, constraintName)
+		if err != nil {
+			return Table{}, false, fmt.Errorf("error reading constraint %s: %w", constraintName, err)
+		}
+		referencedTable, err := readReferencedTable(db, constraintName)
+		if err != nil {
+			return Table{}, false, fmt.Errorf("error reading constraint %s: %w", constraintName, err)
+		}
 		references = append(references, Reference{TableName: referencedTable, ColumnMapping: columnMap})
 	}
 
-	referencedByConstraintNames := readReferencedByConstraintNames(db, tableName)
+	referencedByConstraintNames, err := readReferencedByConstraintNames(db, tableName)
+	if err != nil {
+		return Table{}, false, fmt.Errorf("error reading references to table %s: %w", tableName, err)
+	}
 	referencedBy := make([]Reference, 0)
 	for _, constraintName := range referencedByConstraintNames {
-		referencedTable := readReferencedByTable(db, constraintName)
-		columnMap := readReferenceConstraints(db, referencedTable, constraintName)
+		referencedTable, err := readReferencedByTable(db, constraintName)
+		if err != nil {
+			return Table{}, false, fmt.Errorf("error reading constraint %s: %w", constraintName, err)
+		}
+		columnMap, err := readReferenceConstraints(db, referencedTable, constraintName)
+		if err != nil {
+			return Table{}, false, fmt.Errorf("error reading constraint %s: %w", constraintName, err)
+		}
 		referencedBy = append(referencedBy, Reference{TableName: referencedTable, ColumnMapping: columnMap})
 	}
 
@@ -433,5 +495,5 @@ func processTable(db *sql.DB, tableName string, exportable bool) (Table, bool) {
 		References:          references,
 		ReferencedBy:        referencedBy}
 	table = applyTableFilters(table)
-	return table, false
+	return table, false, nil
 }
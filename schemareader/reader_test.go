@@ -31,7 +31,10 @@ func TestProcessTable(t *testing.T) {
 	UniqueIndexMostColumnsCase(repo)
 
 	// Act
-	table, _ := processTable(repo.DB, TableName, true)
+	table, _, err := processTable(repo.DB, TableName, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
 
 	// Assert
 	indexesEqual := reflect.DeepEqual(table.MainUniqueIndexName, UniqueIndexName03)
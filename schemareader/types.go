@@ -4,7 +4,11 @@
 
 package schemareader
 
-import "github.com/uyuni-project/inter-server-sync/sqlUtil"
+import (
+	"fmt"
+
+	"github.com/uyuni-project/inter-server-sync/sqlUtil"
+)
 
 // Table represents a DB table to dump
 type Table struct {
@@ -21,6 +25,11 @@ type Table struct {
 	References          []Reference
 	ReferencedBy        []Reference
 	RowModCallback      TableCallback
+	// RowFilter is an SQL condition, qualified with the table name, limiting the rows crawled and cleaned
+	RowFilter string
+	// CrawlFilter is an SQL condition, qualified with the table name, limiting the rows crawled only:
+	// the clean statements remove the rows it excludes from the target
+	CrawlFilter string
 }
 
 // UniqueIndex represents an index among columns of a Table
@@ -38,6 +47,23 @@ type Reference struct {
 // Row modification callback function
 type TableCallback func(value []sqlUtil.RowDataStructure, table Table) []sqlUtil.RowDataStructure
 
+// AddRowFilter restricts the rows of the table to the ones matching condition as well
+func (table *Table) AddRowFilter(condition string) {
+	table.RowFilter = andCondition(table.RowFilter, condition)
+}
+
+// AddCrawlFilter restricts the rows of the table crawled to the ones matching condition as well
+func (table *Table) AddCrawlFilter(condition string) {
+	table.CrawlFilter = andCondition(table.CrawlFilter, condition)
+}
+
+func andCondition(conditions string, condition string) string {
+	if conditions == "" {
+		return condition
+	}
+	return fmt.Sprintf("%s AND %s", conditions, condition)
+}
+
 // we are returning just one reference, the first one which uses the column we want
 func (table *Table) GetFirstReferenceFromColumn(columnName string) Reference {
 	for _, reference := range table.References {
@@ -5,10 +5,13 @@
 package sqlUtil
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
 	"reflect"
+	"time"
 
-	"github.com/rs/zerolog/log"
+	"github.com/uyuni-project/inter-server-sync/metrics"
 )
 
 type RowDataStructure struct {
@@ -22,20 +25,31 @@ func (row RowDataStructure) GetInitialValue() interface{} {
 	return row.initialValue
 }
 
-func ExecuteQueryWithResults(db *sql.DB, sql string, scanParameters ...interface{}) [][]RowDataStructure {
+// Querier is satisfied by both database connections and transactions
+type Querier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func ExecuteQueryWithResults(ctx context.Context, db Querier, sql string, scanParameters ...interface{}) ([][]RowDataStructure, error) {
+	start := time.Now()
+	rows, err := executeQueryWithResults(ctx, db, sql, scanParameters...)
+	metrics.ObserveQuery(ctx, time.Since(start), err)
+	return rows, err
+}
+
+func executeQueryWithResults(ctx context.Context, db Querier, sql string, scanParameters ...interface{}) ([][]RowDataStructure, error) {
 
-	rows, err := db.Query(sql, scanParameters...)
+	rows, err := db.QueryContext(ctx, sql, scanParameters...)
 
 	if err != nil {
-		log.Printf("Error : While executing '%s', with parameters %s", sql, scanParameters)
-		log.Panic().Err(err).Msg("error executing query")
+		return nil, fmt.Errorf("error executing query '%s' with parameters %s: %w", sql, scanParameters, err)
 	}
 	defer rows.Close()
 
 	// get column type info
 	columnTypes, err := rows.ColumnTypes()
 	if err != nil {
-		log.Panic().Err(err).Msg("error getting column types")
+		return nil, fmt.Errorf("error getting column types: %w", err)
 	}
 
 	// used for allocation & dereferencing
@@ -57,7 +71,7 @@ func ExecuteQueryWithResults(db *sql.DB, sql string, scanParameters ...interface
 
 		// scan each column Value into the corresponding **T Value
 		if err := rows.Scan(rowResult...); err != nil {
-			log.Panic().Err(err).Msg("error getting rows")
+			return nil, fmt.Errorf("error getting rows: %w", err)
 		}
 
 		// dereference pointers
@@ -78,5 +92,5 @@ func ExecuteQueryWithResults(db *sql.DB, sql string, scanParameters ...interface
 
 		computedValues = append(computedValues, rowComputedValues)
 	}
-	return computedValues
+	return computedValues, rows.Err()
 }
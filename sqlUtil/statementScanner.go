@@ -0,0 +1,228 @@
+// SPDX-FileCopyrightText: 2023 SUSE LLC
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package sqlUtil
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// scanState tells which part of a SQL script the scanner is in
+type scanState int
+
+const (
+	stateCode scanState = iota
+	// stateQuote is a standard string literal, where a quote is escaped by doubling it
+	stateQuote
+	// stateEscapeQuote is an E'...' string literal, where backslash escapes the next character
+	stateEscapeQuote
+	stateIdentifier
+	stateDollarQuote
+	stateLineComment
+	stateBlockComment
+)
+
+// StatementScanner splits a SQL script, as generated by the export, into single statements.
+// Statements are terminated by a semicolon outside of literals, quoted identifiers, dollar-quoted bodies and comments.
+// Comments are removed from the statements.
+type StatementScanner struct {
+	reader    *bufio.Reader
+	pending   string
+	statement string
+	err       error
+
+	state scanState
+	// dollarTag is the opening tag of the current dollar-quoted body, e.g. $body$
+	dollarTag string
+	// commentDepth counts the nested block comments
+	commentDepth int
+	// previous holds the last two characters of code, to recognize E'...' literals
+	previous [2]byte
+}
+
+func NewStatementScanner(reader io.Reader) *StatementScanner {
+	return &StatementScanner{reader: bufio.NewReaderSize(reader, 65536)}
+}
+
+// Scan advances to the next statement, returning false at the end of the input or on error
+func (s *StatementScanner) Scan() bool {
+	var statement strings.Builder
+	for {
+		if len(s.pending) == 0 {
+			if s.err != nil {
+				break
+			}
+			s.pending, s.err = s.reader.ReadString('\n')
+			if s.err != nil && s.err != io.EOF {
+				return false
+			}
+		}
+		line := s.pending
+		s.pending = ""
+		for i := 0; i < len(line); i++ {
+			c := line[i]
+			switch s.state {
+			case stateCode:
+				switch {
+				case c == '-' && strings.HasPrefix(line[i:], "--"):
+					s.state = stateLineComment
+					i++
+					continue
+				case c == '/' && strings.HasPrefix(line[i:], "/*"):
+					s.state = stateBlockComment
+					s.commentDepth = 1
+					i++
+					continue
+				case c == '\'':
+					s.state = stateQuote
+					if (s.previous[1] == 'E' || s.previous[1] == 'e') && !isIdentifierChar(s.previous[0]) {
+						s.state = stateEscapeQuote
+					}
+				case c == '"':
+					s.state = stateIdentifier
+				case c == '$' && !isIdentifierChar(s.previous[1]):
+					if tag := dollarQuoteTag(line[i:]); tag != "" {
+						s.state = stateDollarQuote
+						s.dollarTag = tag
+						statement.WriteString(tag)
+						i += len(tag) - 1
+						continue
+					}
+				case c == ';':
+					s.previous = [2]byte{' ', ' '}
+					if strings.TrimSpace(statement.String()) == "" {
+						// an empty statement, e.g. what is left of a commented out one
+						statement.Reset()
+						continue
+					}
+					statement.WriteByte(c)
+					s.pending = line[i+1:]
+					s.statement = strings.TrimSpace(statement.String())
+					return true
+				}
+				s.previous = [2]byte{s.previous[1], c}
+			case stateQuote:
+				if c == '\'' {
+					s.state = stateCode
+				}
+			case stateEscapeQuote:
+				if c == '\\' && i+1 < len(line) {
+					statement.WriteByte(c)
+					i++
+					c = line[i]
+				} else if c == '\'' {
+					s.state = stateCode
+				}
+			case stateIdentifier:
+				if c == '"' {
+					s.state = stateCode
+				}
+			case stateDollarQuote:
+				if c == '$' && strings.HasPrefix(line[i:], s.dollarTag) {
+					s.state = stateCode
+					statement.WriteString(s.dollarTag)
+					i += len(s.dollarTag) - 1
+					continue
+				}
+			case stateLineComment:
+				if c == '\n' {
+					s.state = stateCode
+					statement.WriteByte(c)
+				}
+				continue
+			case stateBlockComment:
+				if c == '/' && strings.HasPrefix(line[i:], "/*") {
+					s.commentDepth++
+					i++
+				} else if c == '*' && strings.HasPrefix(line[i:], "*/") {
+					s.commentDepth--
+					i++
+					if s.commentDepth == 0 {
+						s.state = stateCode
+						statement.WriteByte(' ')
+					}
+				}
+				continue
+			}
+			// a quoted literal is closed, e.g. 'a', as much as reopened, e.g. 'a''b', by a quote
+			if s.state != stateCode || c == '\'' || c == '"' {
+				s.previous = [2]byte{' ', ' '}
+			}
+			statement.WriteByte(c)
+		}
+	}
+	// a trailing statement without semicolon is returned as is
+	s.statement = strings.TrimSpace(statement.String())
+	return len(s.statement) > 0
+}
+
+// dollarQuoteTag returns the tag starting text, e.g. $$ or $body$, or an empty string if text does not start with one
+func dollarQuoteTag(text string) string {
+	for i := 1; i < len(text); i++ {
+		c := text[i]
+		if c == '$' {
+			return text[:i+1]
+		}
+		// the tag follows the rules of identifiers, without dollar signs: $1 is a parameter
+		if !isIdentifierChar(c) || c == '$' || (i == 1 && c >= '0' && c <= '9') {
+			return ""
+		}
+	}
+	return ""
+}
+
+func isIdentifierChar(c byte) bool {
+	return c == '_' || c == '$' || c >= 0x80 || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// Statement returns the most recent statement found by Scan
+func (s *StatementScanner) Statement() string {
+	return s.statement
+}
+
+// Err returns the first non-EOF error found while reading
+func (s *StatementScanner) Err() error {
+	if s.err == io.EOF {
+		return nil
+	}
+	return s.err
+}
+
+// ExecuteStatements runs all statements read from the SQL script in the given transaction,
+// skipping the transaction control statements written by the export.
+// If onExecuted is not nil, it is called after each statement with the number of rows it affected.
+func ExecuteStatements(ctx context.Context, tx *sql.Tx, reader io.Reader, onExecuted func(statement string, rowsAffected int64)) (int, error) {
+	scanner := NewStatementScanner(reader)
+	count := 0
+	for scanner.Scan() {
+		statement := scanner.Statement()
+		if isTransactionControl(statement) {
+			continue
+		}
+		result, err := tx.ExecContext(ctx, statement)
+		if err != nil {
+			return count, fmt.Errorf("error executing statement %d: %w", count+1, err)
+		}
+		count++
+		if onExecuted != nil {
+			// not all statements report affected rows, those count as none
+			rowsAffected, _ := result.RowsAffected()
+			onExecuted(statement, rowsAffected)
+		}
+	}
+	return count, scanner.Err()
+}
+
+func isTransactionControl(statement string) bool {
+	switch strings.ToUpper(strings.TrimSuffix(statement, ";")) {
+	case "BEGIN", "COMMIT", "ROLLBACK":
+		return true
+	}
+	return false
+}
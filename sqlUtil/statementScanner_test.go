@@ -0,0 +1,81 @@
+// SPDX-FileCopyrightText: 2023 SUSE LLC
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package sqlUtil
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStatementScanner(t *testing.T) {
+	script := "BEGIN;\n" +
+		"-- end of clean tables\n" +
+		"\nDELETE FROM rhnchannelpackage WHERE (channel_id) IN (SELECT 1);\n" +
+		"INSERT INTO rhnpackagechangelogdata (name, text)\tVALUES ('user', 'line one;\n-- not a comment\nline '' two;');\n" +
+		"\n\t\tINSERT INTO rhnRepoRegenQueue\n\t\t(id)\n\t\tVALUES (null);\n\t\n" +
+		"COMMIT;"
+	expected := []string{
+		"BEGIN;",
+		"DELETE FROM rhnchannelpackage WHERE (channel_id) IN (SELECT 1);",
+		"INSERT INTO rhnpackagechangelogdata (name, text)\tVALUES ('user', 'line one;\n-- not a comment\nline '' two;');",
+		"INSERT INTO rhnRepoRegenQueue\n\t\t(id)\n\t\tVALUES (null);",
+		"COMMIT;",
+	}
+
+	scanner := NewStatementScanner(strings.NewReader(script))
+	statements := make([]string, 0)
+	for scanner.Scan() {
+		statements = append(statements, scanner.Statement())
+	}
+
+	if scanner.Err() != nil {
+		t.Fatalf("unexpected error: %v", scanner.Err())
+	}
+	if !reflect.DeepEqual(statements, expected) {
+		t.Errorf("statements do not match: expected %q, got %q", expected, statements)
+	}
+}
+
+func TestStatementScannerQuotesAndComments(t *testing.T) {
+	script := "INSERT INTO t (a) VALUES ('x'); -- it's a trailing comment; with a quote\n" +
+		"UPDATE t SET a = E'it\\'s; \\\\' /* it's; /* nested */ a comment */ WHERE b = 'c''d;';\n" +
+		"CREATE FUNCTION f() RETURNS text AS $body$ SELECT 'a;'; -- $$ ; $body$ LANGUAGE sql;\n" +
+		"SELECT $$it's;$$, $1, \"quoted;\"\"id\" FROM t; /* a commented; statement; */ ;\n" +
+		"SELECT e FROM t WHERE e = 'E'';\n"
+	expected := []string{
+		"INSERT INTO t (a) VALUES ('x');",
+		"UPDATE t SET a = E'it\\'s; \\\\'   WHERE b = 'c''d;';",
+		"CREATE FUNCTION f() RETURNS text AS $body$ SELECT 'a;'; -- $$ ; $body$ LANGUAGE sql;",
+		"SELECT $$it's;$$, $1, \"quoted;\"\"id\" FROM t;",
+		"SELECT e FROM t WHERE e = 'E'';",
+	}
+
+	scanner := NewStatementScanner(strings.NewReader(script))
+	statements := make([]string, 0)
+	for scanner.Scan() {
+		statements = append(statements, scanner.Statement())
+	}
+
+	if scanner.Err() != nil {
+		t.Fatalf("unexpected error: %v", scanner.Err())
+	}
+	if !reflect.DeepEqual(statements, expected) {
+		t.Errorf("statements do not match: expected %q, got %q", expected, statements)
+	}
+}
+
+func TestIsTransactionControl(t *testing.T) {
+	for statement, expected := range map[string]bool{
+		"BEGIN;":                 true,
+		"commit;":                true,
+		"SELECT 1;":              false,
+		"BEGIN TRANSACTION ISO;": false,
+	} {
+		if isTransactionControl(statement) != expected {
+			t.Errorf("isTransactionControl(%s) should be %t", statement, expected)
+		}
+	}
+}
@@ -81,6 +81,18 @@ func (repo *DataRepository) ExpectWithRecords(stm string, recs *sqlmock.Rows, ar
 
 }
 
+// ExpectBegin expects a transaction to be started
+func (repo *DataRepository) ExpectBegin() {
+	repo.mock.ExpectBegin()
+}
+
+// ExpectExec expects the statement to be executed, affecting rowsAffected rows
+func (repo *DataRepository) ExpectExec(stm string, rowsAffected int64) {
+	repo.mock.
+		ExpectExec(stm).
+		WillReturnResult(sqlmock.NewResult(0, rowsAffected))
+}
+
 // ExpectationsWereMet checks whether all queued expectations
 // were met in order. If any of them was not met - an error is returned.
 func (repo *DataRepository) ExpectationsWereMet() error {
@@ -44,20 +44,18 @@ func Contains(slice []string, elementToFind string) bool {
 	return false
 }
 
-func GetAbsPath(path string) string {
+func GetAbsPath(path string) (string, error) {
 	result := path
 	if filepath.IsAbs(path) {
 		result, _ = filepath.Abs(path)
-	} else {
+	} else if strings.HasPrefix(path, "~") {
 		homedir, err := os.UserHomeDir()
 		if err != nil {
-			log.Fatal().Msg("Couldn't determine the home directory")
-		}
-		if strings.HasPrefix(path, "~") {
-			result = strings.Replace(path, "~", homedir, -1)
+			return "", fmt.Errorf("couldn't determine the home directory: %w", err)
 		}
+		result = strings.Replace(path, "~", homedir, -1)
 	}
-	return result
+	return result, nil
 }
 
 func FolderExists(path string) error {
@@ -76,7 +74,7 @@ func FolderExists(path string) error {
 	return nil
 }
 
-func GetCurrentServerVersion(serverConfig string) (string, string) {
+func GetCurrentServerVersion(serverConfig string) (string, string, error) {
 	files := []string{serverConfig}
 	files = append(files, getDefaultConfigs()...)
 	property := []string{"product_name", "web.product_name"}
@@ -93,9 +91,9 @@ func GetCurrentServerVersion(serverConfig string) (string, string) {
 	}
 	version, err := getProperty(files, propertyVersion)
 	if err != nil {
-		log.Fatal().Msgf("No version found for product %s", product)
+		return "", "", fmt.Errorf("no version found for product %s", product)
 	}
-	return version, product
+	return version, product, nil
 }
 
 func GetCurrentServerFQDN(serverConfig string) string {
@@ -125,7 +123,7 @@ func getProperty(filePaths []string, names []string) (string, error) {
 func ScannerFunc(path string, search string) (string, error) {
 	f, err := os.Open(path)
 	if err != nil {
-		log.Fatal().Msgf("Couldn't open file: %s", path)
+		return "", fmt.Errorf("couldn't open file %s: %w", path, err)
 	}
 	defer f.Close()
 	scanner := bufio.NewScanner(f)
@@ -158,15 +156,13 @@ func ValidateDate(date string) (string, bool) {
 	return "", false
 }
 
-func ReadFileByLine(path string) []string {
+func ReadFileByLine(path string) ([]string, error) {
 
-	msg := fmt.Sprintf("error opening file at %s", path)
 	file, err := os.Open(path)
-	checkError(err, msg)
-	defer func(file *os.File) {
-		err := file.Close()
-		checkError(err, msg)
-	}(file)
+	if err != nil {
+		return nil, fmt.Errorf("error opening file at %s: %w", path, err)
+	}
+	defer file.Close()
 
 	scanner := bufio.NewScanner(file)
 	scanner.Split(bufio.ScanLines)
@@ -174,7 +170,10 @@ func ReadFileByLine(path string) []string {
 	for scanner.Scan() {
 		labels = append(labels, scanner.Text())
 	}
-	return labels
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading file at %s: %w", path, err)
+	}
+	return labels, nil
 }
 
 // ExecInteractivePrompt calls a command, expects an interactive prompt to start, passes the given input into it.
@@ -190,9 +189,3 @@ func ExecInteractivePrompt(name string, input string) error {
 
 	return cmd.Run()
 }
-
-func checkError(err error, msg string) {
-	if err != nil {
-		log.Fatal().Err(err).Msg(msg)
-	}
-}